@@ -0,0 +1,596 @@
+// Package accounttest provides a conformance suite that every
+// account.Repository implementation must pass.
+package accounttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/segmentio/ksuid"
+)
+
+// TestRepository runs the conformance suite. newRepository must return an
+// empty repository on every call.
+func TestRepository(t *testing.T, newRepository func(t *testing.T) account.Repository) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		a := newAccount("Alice")
+		if err := r.PutAccount(ctx, a); err != nil {
+			t.Fatalf("PutAccount: %v", err)
+		}
+
+		got, err := r.GetAccountByID(ctx, a.ID)
+		if err != nil {
+			t.Fatalf("GetAccountByID: %v", err)
+		}
+		if got.ID != a.ID || got.Name != a.Name || got.Email != a.Email || got.Role != a.Role || got.Status != a.Status {
+			t.Errorf("GetAccountByID = %+v, want %+v", got, a)
+		}
+		if got.PasswordHash != "" {
+			t.Errorf("GetAccountByID exposed the password hash")
+		}
+
+		got, err = r.GetAccountByEmail(ctx, a.Email)
+		if err != nil {
+			t.Fatalf("GetAccountByEmail: %v", err)
+		}
+		if got.ID != a.ID || got.PasswordHash != a.PasswordHash {
+			t.Errorf("GetAccountByEmail = %+v, want %+v", got, a)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		id := ksuid.New().String()
+		if _, err := r.GetAccountByID(ctx, id); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByID error = %v, want account.ErrNotFound", err)
+		}
+		if _, err := r.GetAccountByEmail(ctx, "nobody@example.com"); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByEmail error = %v, want account.ErrNotFound", err)
+		}
+		if _, err := r.UpdateAccount(ctx, id, "x"); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("UpdateAccount error = %v, want account.ErrNotFound", err)
+		}
+		if err := r.DeleteAccount(ctx, id); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("DeleteAccount error = %v, want account.ErrNotFound", err)
+		}
+	})
+
+	t.Run("DuplicateEmail", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		a := newAccount("Alice")
+		if err := r.PutAccount(ctx, a); err != nil {
+			t.Fatalf("PutAccount: %v", err)
+		}
+		b := newAccount("Bob")
+		b.Email = a.Email
+		if err := r.PutAccount(ctx, b); !errors.Is(err, account.ErrEmailTaken) {
+			t.Errorf("PutAccount with a duplicate email error = %v, want account.ErrEmailTaken", err)
+		}
+
+		// Deleting an account frees its email.
+		if err := r.DeleteAccount(ctx, a.ID); err != nil {
+			t.Fatalf("DeleteAccount: %v", err)
+		}
+		if err := r.PutAccount(ctx, b); err != nil {
+			t.Fatalf("PutAccount with the email of a deleted account: %v", err)
+		}
+		c := newAccount("Carol")
+		c.Email = a.Email
+		rowErrs, err := r.PutAccounts(ctx, []account.Account{c})
+		if err != nil {
+			t.Fatalf("PutAccounts: %v", err)
+		}
+		if !errors.Is(rowErrs[0], account.ErrEmailTaken) {
+			t.Errorf("PutAccounts with the email of the new account error = %v, want account.ErrEmailTaken", rowErrs[0])
+		}
+	})
+
+	t.Run("PutAccountsSkipsTakenEmails", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		existing := putAccounts(t, r, 1)[0]
+
+		fresh := newAccount("Fresh")
+		taken := newAccount("Taken")
+		taken.Email = existing.Email
+		repeated := newAccount("Repeated")
+		repeated.Email = fresh.Email
+		rowErrs, err := r.PutAccounts(ctx, []account.Account{fresh, taken, repeated})
+		if err != nil {
+			t.Fatalf("PutAccounts: %v", err)
+		}
+		if len(rowErrs) != 3 || rowErrs[0] != nil ||
+			!errors.Is(rowErrs[1], account.ErrEmailTaken) || !errors.Is(rowErrs[2], account.ErrEmailTaken) {
+			t.Errorf("PutAccounts row errors = %v, want [nil ErrEmailTaken ErrEmailTaken]", rowErrs)
+		}
+		if _, err := r.GetAccountByID(ctx, fresh.ID); err != nil {
+			t.Errorf("GetAccountByID of the imported account: %v", err)
+		}
+		if _, err := r.GetAccountByID(ctx, repeated.ID); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByID of a skipped account error = %v, want account.ErrNotFound", err)
+		}
+	})
+
+	t.Run("ListPaginatesByIDDescending", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		want := putAccounts(t, r, 5)
+
+		first, err := r.ListAccounts(ctx, "", 3)
+		if err != nil {
+			t.Fatalf("ListAccounts: %v", err)
+		}
+		assertIDs(t, *first, want[:3])
+
+		rest, err := r.ListAccounts(ctx, (*first)[2].ID, 3)
+		if err != nil {
+			t.Fatalf("ListAccounts: %v", err)
+		}
+		assertIDs(t, *rest, want[3:])
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		for _, name := range []string{"Johnny", "Bo John", "Alice", "50%_off"} {
+			if err := r.PutAccount(ctx, newAccount(name)); err != nil {
+				t.Fatalf("PutAccount: %v", err)
+			}
+		}
+
+		found, err := r.SearchAccounts(ctx, "JOHN", "", 10)
+		if err != nil {
+			t.Fatalf("SearchAccounts: %v", err)
+		}
+		if len(*found) != 2 {
+			t.Errorf("SearchAccounts(JOHN) returned %d accounts, want 2", len(*found))
+		}
+
+		found, err = r.SearchAccounts(ctx, "%_", "", 10)
+		if err != nil {
+			t.Fatalf("SearchAccounts: %v", err)
+		}
+		if len(*found) != 1 || (*found)[0].Name != "50%_off" {
+			t.Errorf("SearchAccounts(%%_) = %+v, want only 50%%_off", *found)
+		}
+	})
+
+	t.Run("UpdateAndDelete", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		accounts := putAccounts(t, r, 2)
+
+		updated, err := r.UpdateAccount(ctx, accounts[0].ID, "Renamed")
+		if err != nil {
+			t.Fatalf("UpdateAccount: %v", err)
+		}
+		if updated.Name != "Renamed" || updated.Email != accounts[0].Email {
+			t.Errorf("UpdateAccount = %+v", updated)
+		}
+
+		if err := r.DeleteAccount(ctx, accounts[1].ID); err != nil {
+			t.Fatalf("DeleteAccount: %v", err)
+		}
+		if _, err := r.GetAccountByID(ctx, accounts[1].ID); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByID after delete error = %v, want account.ErrNotFound", err)
+		}
+		if err := r.DeleteAccount(ctx, accounts[1].ID); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("second DeleteAccount error = %v, want account.ErrNotFound", err)
+		}
+		listed, err := r.ListAccounts(ctx, "", 10)
+		if err != nil {
+			t.Fatalf("ListAccounts: %v", err)
+		}
+		assertIDs(t, *listed, accounts[:1])
+	})
+
+	t.Run("UpdateStatus", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		a := putAccounts(t, r, 1)[0]
+
+		updated, err := r.UpdateAccountStatus(ctx, a.ID, account.StatusActive, account.StatusSuspended)
+		if err != nil {
+			t.Fatalf("UpdateAccountStatus: %v", err)
+		}
+		if updated.Status != account.StatusSuspended {
+			t.Errorf("UpdateAccountStatus returned status %q", updated.Status)
+		}
+		// The account is no longer active, so a second identical update loses.
+		_, err = r.UpdateAccountStatus(ctx, a.ID, account.StatusActive, account.StatusClosed)
+		if !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("stale UpdateAccountStatus error = %v, want account.ErrNotFound", err)
+		}
+		got, err := r.GetAccountByID(ctx, a.ID)
+		if err != nil {
+			t.Fatalf("GetAccountByID: %v", err)
+		}
+		if got.Status != account.StatusSuspended {
+			t.Errorf("GetAccountByID status = %q, want %q", got.Status, account.StatusSuspended)
+		}
+	})
+
+	t.Run("Erase", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		a := putAccounts(t, r, 1)[0]
+		if err := r.PutAddress(ctx, newAddress(a.ID, true, true)); err != nil {
+			t.Fatalf("PutAddress: %v", err)
+		}
+
+		erased, err := r.EraseAccount(ctx, a.ID)
+		if err != nil {
+			t.Fatalf("EraseAccount: %v", err)
+		}
+		if erased.ID != a.ID || erased.Name == a.Name || erased.Email == a.Email || erased.Status != account.StatusClosed {
+			t.Errorf("EraseAccount = %+v, want the account anonymized and closed", erased)
+		}
+		if _, err := r.EraseAccount(ctx, a.ID); err != nil {
+			t.Errorf("second EraseAccount: %v", err)
+		}
+		if _, err := r.GetAccountByID(ctx, a.ID); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByID after erase error = %v, want account.ErrNotFound", err)
+		}
+		if _, err := r.GetAccountByEmail(ctx, a.Email); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByEmail after erase error = %v, want account.ErrNotFound", err)
+		}
+		addresses, err := r.ListAddresses(ctx, a.ID)
+		if err != nil {
+			t.Fatalf("ListAddresses: %v", err)
+		}
+		if len(*addresses) != 0 {
+			t.Errorf("ListAddresses after erase = %+v, want none", *addresses)
+		}
+		// The email is no longer held by the erased account.
+		again := newAccount("Again")
+		again.Email = a.Email
+		if err := r.PutAccount(ctx, again); err != nil {
+			t.Errorf("PutAccount with the erased email: %v", err)
+		}
+		if _, err := r.EraseAccount(ctx, ksuid.New().String()); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("EraseAccount of a missing account error = %v, want account.ErrNotFound", err)
+		}
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		r := newRepository(t)
+		a := putAccounts(t, r, 1)[0]
+		admin := ksuid.New().String()
+		ctx := authz.ContextWithIdentity(context.Background(), authz.Identity{AccountID: admin, Roles: []string{"admin"}})
+
+		if _, err := r.UpdateAccount(ctx, a.ID, "Renamed"); err != nil {
+			t.Fatalf("UpdateAccount: %v", err)
+		}
+		if _, err := r.UpdateAccountStatus(ctx, a.ID, account.StatusActive, account.StatusSuspended); err != nil {
+			t.Fatalf("UpdateAccountStatus: %v", err)
+		}
+		home := newAddress(a.ID, true, true)
+		if err := r.PutAddress(ctx, home); err != nil {
+			t.Fatalf("PutAddress: %v", err)
+		}
+		home.City = "Elsewhere"
+		if _, err := r.UpdateAddress(ctx, home); err != nil {
+			t.Fatalf("UpdateAddress: %v", err)
+		}
+		if err := r.DeleteAddress(ctx, a.ID, home.ID); err != nil {
+			t.Fatalf("DeleteAddress: %v", err)
+		}
+		if err := r.DeleteAccount(ctx, a.ID); err != nil {
+			t.Fatalf("DeleteAccount: %v", err)
+		}
+		// Failed changes leave no trace.
+		if _, err := r.UpdateAccount(ctx, a.ID, "Again"); !errors.Is(err, account.ErrNotFound) {
+			t.Fatalf("UpdateAccount of a deleted account error = %v, want account.ErrNotFound", err)
+		}
+
+		want := []string{
+			account.AuditAccountDeleted,
+			account.AuditAddressDeleted,
+			account.AuditAddressUpdated,
+			account.AuditAddressCreated,
+			account.AuditStatusChanged,
+			account.AuditAccountUpdated,
+			account.AuditAccountCreated,
+		}
+		entries := []account.AuditEntry{}
+		after := ""
+		for {
+			page, err := r.ListAccountAudit(ctx, a.ID, after, 3)
+			if err != nil {
+				t.Fatalf("ListAccountAudit: %v", err)
+			}
+			entries = append(entries, *page...)
+			if len(*page) < 3 {
+				break
+			}
+			after = (*page)[len(*page)-1].ID
+		}
+		if len(entries) != len(want) {
+			t.Fatalf("ListAccountAudit returned %d entries, want %d", len(entries), len(want))
+		}
+		for i, e := range entries {
+			if e.Action != want[i] || e.AccountID != a.ID {
+				t.Errorf("entry %d = %s on %s, want %s on %s", i, e.Action, e.AccountID, want[i], a.ID)
+			}
+		}
+
+		created, updated, deleted := entries[6], entries[5], entries[0]
+		if created.ActorID != "" {
+			t.Errorf("anonymous sign-up has actor %q, want none", created.ActorID)
+		}
+		if updated.ActorID != admin {
+			t.Errorf("update has actor %q, want %q", updated.ActorID, admin)
+		}
+		if created.Before != nil || snapshot(t, created.After)["name"] != a.Name {
+			t.Errorf("created entry = %s -> %s, want nothing -> the account", created.Before, created.After)
+		}
+		if snapshot(t, updated.Before)["name"] != a.Name || snapshot(t, updated.After)["name"] != "Renamed" {
+			t.Errorf("updated entry = %s -> %s, want the name changed", updated.Before, updated.After)
+		}
+		if deleted.Before == nil || deleted.After != nil {
+			t.Errorf("deleted entry = %s -> %s, want the account -> nothing", deleted.Before, deleted.After)
+		}
+		for _, e := range entries {
+			if _, ok := snapshot(t, e.After)["passwordHash"]; ok || strings.Contains(string(e.After), a.PasswordHash) {
+				t.Errorf("entry %s exposed the password hash", e.Action)
+			}
+		}
+
+		// Erasing strips the personal data from the log but keeps the rest.
+		if _, err := r.EraseAccount(ctx, a.ID); err != nil {
+			t.Fatalf("EraseAccount: %v", err)
+		}
+		page, err := r.ListAccountAudit(ctx, a.ID, "", 100)
+		if err != nil {
+			t.Fatalf("ListAccountAudit: %v", err)
+		}
+		if len(*page) != len(want)+1 || (*page)[0].Action != account.AuditAccountErased {
+			t.Fatalf("ListAccountAudit after erase = %+v, want the erasure on top", *page)
+		}
+		for _, e := range *page {
+			for _, raw := range []json.RawMessage{e.Before, e.After} {
+				if strings.Contains(string(raw), a.Email) || strings.Contains(string(raw), "Springfield") {
+					t.Errorf("entry %s kept personal data: %s", e.Action, raw)
+				}
+			}
+		}
+		if status := snapshot(t, (*page)[5].After)["status"]; status != account.StatusSuspended {
+			t.Errorf("status change after erase has status %v, want %q", status, account.StatusSuspended)
+		}
+	})
+
+	t.Run("APIKeys", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		owner, other := putAccounts(t, r, 2)[0], putAccounts(t, r, 1)[0]
+		key := account.APIKey{
+			ID:        ksuid.New().String(),
+			AccountID: owner.ID,
+			Name:      "CI",
+			Prefix:    "ak_abcdefgh",
+			CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+			Hash:      "hash-" + owner.ID,
+		}
+		if err := r.PutAPIKey(ctx, key); err != nil {
+			t.Fatalf("PutAPIKey: %v", err)
+		}
+		missing := key
+		missing.ID, missing.AccountID, missing.Hash = ksuid.New().String(), ksuid.New().String(), "hash-missing"
+		if err := r.PutAPIKey(ctx, missing); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("PutAPIKey for a missing account error = %v, want account.ErrNotFound", err)
+		}
+
+		keys, err := r.ListAPIKeys(ctx, owner.ID)
+		if err != nil {
+			t.Fatalf("ListAPIKeys: %v", err)
+		}
+		if len(*keys) != 1 {
+			t.Fatalf("ListAPIKeys returned %d keys, want 1", len(*keys))
+		}
+		got := (*keys)[0]
+		if got.ID != key.ID || got.Name != key.Name || got.Prefix != key.Prefix || !got.CreatedAt.Equal(key.CreatedAt) {
+			t.Errorf("ListAPIKeys = %+v, want %+v", got, key)
+		}
+		if got.Hash != "" {
+			t.Errorf("ListAPIKeys exposed the key hash")
+		}
+
+		a, err := r.GetAccountByAPIKey(ctx, key.Hash)
+		if err != nil {
+			t.Fatalf("GetAccountByAPIKey: %v", err)
+		}
+		if a.ID != owner.ID || a.Role != owner.Role || a.PasswordHash != "" {
+			t.Errorf("GetAccountByAPIKey = %+v, want %+v without the password hash", a, owner)
+		}
+
+		if err := r.RevokeAPIKey(ctx, other.ID, key.ID); !errors.Is(err, account.ErrAPIKeyNotFound) {
+			t.Errorf("RevokeAPIKey by another account error = %v, want account.ErrAPIKeyNotFound", err)
+		}
+		if err := r.RevokeAPIKey(ctx, owner.ID, key.ID); err != nil {
+			t.Fatalf("RevokeAPIKey: %v", err)
+		}
+		if err := r.RevokeAPIKey(ctx, owner.ID, key.ID); !errors.Is(err, account.ErrAPIKeyNotFound) {
+			t.Errorf("second RevokeAPIKey error = %v, want account.ErrAPIKeyNotFound", err)
+		}
+		if _, err := r.GetAccountByAPIKey(ctx, key.Hash); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByAPIKey of a revoked key error = %v, want account.ErrNotFound", err)
+		}
+		if keys, err = r.ListAPIKeys(ctx, owner.ID); err != nil || len(*keys) != 0 {
+			t.Errorf("ListAPIKeys after revoking = %v, %v, want none", keys, err)
+		}
+
+		// Keys stop working while their account is suspended, and when it is
+		// deleted.
+		key.ID, key.Hash = ksuid.New().String(), "hash-2-"+owner.ID
+		if err := r.PutAPIKey(ctx, key); err != nil {
+			t.Fatalf("PutAPIKey: %v", err)
+		}
+		if _, err := r.UpdateAccountStatus(ctx, owner.ID, account.StatusActive, account.StatusSuspended); err != nil {
+			t.Fatalf("UpdateAccountStatus: %v", err)
+		}
+		if _, err := r.GetAccountByAPIKey(ctx, key.Hash); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByAPIKey of a suspended account error = %v, want account.ErrNotFound", err)
+		}
+		if _, err := r.UpdateAccountStatus(ctx, owner.ID, account.StatusSuspended, account.StatusActive); err != nil {
+			t.Fatalf("UpdateAccountStatus: %v", err)
+		}
+		if _, err := r.GetAccountByAPIKey(ctx, key.Hash); err != nil {
+			t.Errorf("GetAccountByAPIKey after reactivating: %v", err)
+		}
+		if err := r.DeleteAccount(ctx, owner.ID); err != nil {
+			t.Fatalf("DeleteAccount: %v", err)
+		}
+		if _, err := r.GetAccountByAPIKey(ctx, key.Hash); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("GetAccountByAPIKey of a deleted account error = %v, want account.ErrNotFound", err)
+		}
+	})
+
+	t.Run("Addresses", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		owner := putAccounts(t, r, 1)[0]
+
+		home := newAddress(owner.ID, true, true)
+		work := newAddress(owner.ID, false, false)
+		for _, a := range []account.Address{home, work} {
+			if err := r.PutAddress(ctx, a); err != nil {
+				t.Fatalf("PutAddress: %v", err)
+			}
+		}
+
+		// Making work the default shipping address takes the flag from home.
+		work.DefaultShipping = true
+		work.City = "Elsewhere"
+		updated, err := r.UpdateAddress(ctx, work)
+		if err != nil {
+			t.Fatalf("UpdateAddress: %v", err)
+		}
+		if updated != work {
+			t.Errorf("UpdateAddress = %+v, want %+v", updated, work)
+		}
+		addresses, err := r.ListAddresses(ctx, owner.ID)
+		if err != nil {
+			t.Fatalf("ListAddresses: %v", err)
+		}
+		byID := map[string]account.Address{}
+		for _, a := range *addresses {
+			byID[a.ID] = a
+		}
+		if len(byID) != 2 {
+			t.Fatalf("ListAddresses returned %d addresses, want 2", len(byID))
+		}
+		if byID[home.ID].DefaultShipping || !byID[home.ID].DefaultBilling {
+			t.Errorf("home address = %+v, want only the billing default", byID[home.ID])
+		}
+		if !byID[work.ID].DefaultShipping {
+			t.Errorf("work address = %+v, want the shipping default", byID[work.ID])
+		}
+
+		stranger := ksuid.New().String()
+		if _, err := r.UpdateAddress(ctx, newAddress(owner.ID, false, false)); !errors.Is(err, account.ErrAddressNotFound) {
+			t.Errorf("UpdateAddress of a missing address error = %v, want account.ErrAddressNotFound", err)
+		}
+		if _, err := r.UpdateAddress(ctx, newAddress(stranger, false, false)); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("UpdateAddress of a missing account error = %v, want account.ErrNotFound", err)
+		}
+		if err := r.DeleteAddress(ctx, stranger, home.ID); !errors.Is(err, account.ErrAddressNotFound) {
+			t.Errorf("DeleteAddress by another account error = %v, want account.ErrAddressNotFound", err)
+		}
+		if err := r.DeleteAddress(ctx, owner.ID, home.ID); err != nil {
+			t.Fatalf("DeleteAddress: %v", err)
+		}
+		addresses, err = r.ListAddresses(ctx, owner.ID)
+		if err != nil {
+			t.Fatalf("ListAddresses: %v", err)
+		}
+		if len(*addresses) != 1 || (*addresses)[0].ID != work.ID {
+			t.Errorf("ListAddresses after delete = %+v, want only the work address", *addresses)
+		}
+
+		if err := r.DeleteAccount(ctx, owner.ID); err != nil {
+			t.Fatalf("DeleteAccount: %v", err)
+		}
+		if err := r.PutAddress(ctx, newAddress(owner.ID, false, false)); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("PutAddress of a deleted account error = %v, want account.ErrNotFound", err)
+		}
+		if _, err := r.UpdateAddress(ctx, work); !errors.Is(err, account.ErrNotFound) {
+			t.Errorf("UpdateAddress of a deleted account error = %v, want account.ErrNotFound", err)
+		}
+	})
+}
+
+func newAddress(accountID string, defaultShipping, defaultBilling bool) account.Address {
+	return account.Address{
+		ID:              ksuid.New().String(),
+		AccountID:       accountID,
+		Recipient:       "Alice",
+		Line1:           "1 Main St",
+		City:            "Springfield",
+		Country:         "US",
+		DefaultShipping: defaultShipping,
+		DefaultBilling:  defaultBilling,
+	}
+}
+
+func newAccount(name string) account.Account {
+	id := ksuid.New().String()
+	return account.Account{
+		ID:           id,
+		Name:         name,
+		Email:        fmt.Sprintf("%s@example.com", id),
+		Role:         "customer",
+		Status:       account.StatusActive,
+		PasswordHash: "hash-" + id,
+	}
+}
+
+// putAccounts stores n accounts and returns them ordered by id descending.
+func putAccounts(t *testing.T, r account.Repository, n int) []account.Account {
+	t.Helper()
+	accounts := make([]account.Account, n)
+	for i := range accounts {
+		accounts[i] = newAccount(fmt.Sprintf("Account %d", i))
+		if err := r.PutAccount(context.Background(), accounts[i]); err != nil {
+			t.Fatalf("PutAccount: %v", err)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID > accounts[j].ID })
+	return accounts
+}
+
+// snapshot decodes an audit snapshot.
+func snapshot(t *testing.T, raw json.RawMessage) map[string]any {
+	t.Helper()
+	if raw == nil {
+		return nil
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatalf("decoding snapshot %s: %v", raw, err)
+	}
+	return fields
+}
+
+func assertIDs(t *testing.T, got []account.Account, want []account.Account) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d accounts, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Errorf("account %d has id %s, want %s", i, got[i].ID, want[i].ID)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/segmentio/ksuid"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrAPIKeyNotFound    = errs.New(errs.NotFound, "api key not found")
+	ErrInvalidAPIKey     = errs.New(errs.Unauthenticated, "invalid api key")
+	ErrInvalidAPIKeyName = errs.New(errs.InvalidArgument, "api key needs a name of at most 64 characters")
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot.
+const apiKeyPrefix = "ak_"
+
+// APIKey lets its account call the API without logging in. The key itself
+// is only handed out on creation; Hash is its SHA-256 and Prefix its first
+// characters, enough to tell keys apart.
+type APIKey struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"accountId"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	CreatedAt time.Time `json:"createdAt"`
+	Hash      string    `json:"-"`
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey creates a key for the account and returns it along with the
+// key itself, which cannot be retrieved later.
+func (s *service) CreateAPIKey(ctx context.Context, accountID string, name string) (APIKey, string, error) {
+	if n := utf8.RuneCountInString(strings.TrimSpace(name)); n == 0 || n > 64 {
+		return APIKey{}, "", ErrInvalidAPIKeyName
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	apiKey := APIKey{
+		ID:        ksuid.New().String(),
+		AccountID: accountID,
+		Name:      strings.TrimSpace(name),
+		Prefix:    key[:len(apiKeyPrefix)+8],
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		Hash:      hashAPIKey(key),
+	}
+	if err := s.repository.PutAPIKey(ctx, apiKey); err != nil {
+		return APIKey{}, "", err
+	}
+	apiKey.Hash = ""
+	return apiKey, key, nil
+}
+
+// ListAPIKeys returns the account's keys that have not been revoked.
+func (s *service) ListAPIKeys(ctx context.Context, accountID string) (*[]APIKey, error) {
+	return s.repository.ListAPIKeys(ctx, accountID)
+}
+
+func (s *service) RevokeAPIKey(ctx context.Context, accountID string, id string) error {
+	return s.repository.RevokeAPIKey(ctx, accountID, id)
+}
+
+// AuthenticateAPIKey returns the account owning key, as long as neither the
+// key has been revoked nor the account deleted.
+func (s *service) AuthenticateAPIKey(ctx context.Context, key string) (Account, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return Account{}, ErrInvalidAPIKey
+	}
+	a, err := s.repository.GetAccountByAPIKey(ctx, hashAPIKey(key))
+	if errors.Is(err, ErrNotFound) {
+		return Account{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	// Keys stop working while their account is suspended or closed.
+	if a.Status != StatusActive {
+		return Account{}, ErrInvalidAPIKey
+	}
+	return a, nil
+}
@@ -2,9 +2,14 @@ package account
 
 import (
 	"context"
+	"encoding/json"
 	pb "github.com/Mostbesep/microservice-com-temp/account/pb/microservice-com-temp.account.pb"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"io"
 )
 
 type Client struct {
@@ -12,9 +17,18 @@ type Client struct {
 	service pb.AccountServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
+func NewClient(url string, key authz.Key) (*Client, error) {
 
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(
+		url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			authz.UnaryClientInterceptor(key),
+			idempotency.UnaryClientInterceptor(),
+			errs.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(authz.StreamClientInterceptor(key), errs.StreamClientInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -30,15 +44,16 @@ func (c *Client) Close() error {
 	return nil
 }
 
-func (c *Client) PostAccount(ctx context.Context, name string) (Account, error) {
-	response, err := c.service.PostAccount(ctx, &pb.PostAccountRequest{Name: name})
+func (c *Client) PostAccount(ctx context.Context, name, email, password string) (Account, error) {
+	response, err := c.service.PostAccount(ctx, &pb.PostAccountRequest{
+		Name:     name,
+		Email:    email,
+		Password: password,
+	})
 	if err != nil {
 		return Account{}, err
 	}
-	return Account{
-		ID:   response.Account.Id,
-		Name: response.Account.Name,
-	}, nil
+	return accountFromProto(response.Account), nil
 }
 
 func (c *Client) GetAccount(ctx context.Context, id string) (Account, error) {
@@ -46,23 +61,259 @@ func (c *Client) GetAccount(ctx context.Context, id string) (Account, error) {
 	if err != nil {
 		return Account{}, err
 	}
-	return Account{
-		ID:   response.Account.Id,
-		Name: response.Account.Name,
-	}, nil
+	return accountFromProto(response.Account), nil
 }
 
-func (c *Client) GetAccounts(ctx context.Context, skip uint64, take uint64) (*[]Account, error) {
-	response, err := c.service.GetAccounts(ctx, &pb.GetAccountsRequest{Skip: skip, Take: take})
+func (c *Client) GetAccounts(ctx context.Context, cursor string, take uint64, query string) (*[]Account, string, error) {
+	response, err := c.service.GetAccounts(ctx, &pb.GetAccountsRequest{
+		Cursor: cursor,
+		Take:   take,
+		Query:  query,
+	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	accounts := make([]Account, len(response.Accounts))
 	for i, account := range response.Accounts {
-		accounts[i] = Account{
-			ID:   account.Id,
-			Name: account.Name,
+		accounts[i] = accountFromProto(account)
+	}
+	return &accounts, response.NextCursor, nil
+}
+
+func (c *Client) Authenticate(ctx context.Context, email, password string) (Account, error) {
+	response, err := c.service.Authenticate(ctx, &pb.AuthenticateRequest{
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+func (c *Client) UpdateAccount(ctx context.Context, id, name string) (Account, error) {
+	response, err := c.service.UpdateAccount(ctx, &pb.UpdateAccountRequest{Id: id, Name: name})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+func (c *Client) DeleteAccount(ctx context.Context, id string) error {
+	_, err := c.service.DeleteAccount(ctx, &pb.DeleteAccountRequest{Id: id})
+	return err
+}
+
+func (c *Client) PostAddress(ctx context.Context, address Address) (Address, error) {
+	response, err := c.service.PostAddress(ctx, &pb.PostAddressRequest{Address: addressToProto(address)})
+	if err != nil {
+		return Address{}, err
+	}
+	return addressFromProto(response.Address), nil
+}
+
+func (c *Client) GetAddresses(ctx context.Context, accountID string) ([]Address, error) {
+	response, err := c.service.GetAddresses(ctx, &pb.GetAddressesRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]Address, len(response.Addresses))
+	for i, a := range response.Addresses {
+		addresses[i] = addressFromProto(a)
+	}
+	return addresses, nil
+}
+
+func (c *Client) UpdateAddress(ctx context.Context, address Address) (Address, error) {
+	response, err := c.service.UpdateAddress(ctx, &pb.UpdateAddressRequest{Address: addressToProto(address)})
+	if err != nil {
+		return Address{}, err
+	}
+	return addressFromProto(response.Address), nil
+}
+
+func (c *Client) DeleteAddress(ctx context.Context, accountID, id string) error {
+	_, err := c.service.DeleteAddress(ctx, &pb.DeleteAddressRequest{AccountId: accountID, Id: id})
+	return err
+}
+
+func (c *Client) SuspendAccount(ctx context.Context, id string) (Account, error) {
+	response, err := c.service.SuspendAccount(ctx, &pb.SuspendAccountRequest{Id: id})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+func (c *Client) ReactivateAccount(ctx context.Context, id string) (Account, error) {
+	response, err := c.service.ReactivateAccount(ctx, &pb.ReactivateAccountRequest{Id: id})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+func (c *Client) CloseAccount(ctx context.Context, id string) (Account, error) {
+	response, err := c.service.CloseAccount(ctx, &pb.CloseAccountRequest{Id: id})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+// ExportAccountData returns the JSON document holding the account, its
+// addresses and its orders.
+func (c *Client) ExportAccountData(ctx context.Context, id string) ([]byte, error) {
+	response, err := c.service.ExportAccountData(ctx, &pb.ExportAccountDataRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+	return response.Document, nil
+}
+
+func (c *Client) EraseAccount(ctx context.Context, id string) (Account, error) {
+	response, err := c.service.EraseAccount(ctx, &pb.EraseAccountRequest{Id: id})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+// ListAccountAudit returns a page of the account's audit log, newest first,
+// and the cursor of the next page.
+func (c *Client) ListAccountAudit(ctx context.Context, accountID string, cursor string, take uint64) (*[]AuditEntry, string, error) {
+	response, err := c.service.ListAccountAudit(ctx, &pb.ListAccountAuditRequest{
+		AccountId: accountID,
+		Cursor:    cursor,
+		Take:      take,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	entries := make([]AuditEntry, len(response.Entries))
+	for i, e := range response.Entries {
+		entries[i] = AuditEntry{
+			ID:        e.Id,
+			AccountID: e.AccountId,
+			ActorID:   e.ActorId,
+			Action:    e.Action,
+		}
+		if e.Before != "" {
+			entries[i].Before = json.RawMessage(e.Before)
+		}
+		if e.After != "" {
+			entries[i].After = json.RawMessage(e.After)
+		}
+		if err = entries[i].CreatedAt.UnmarshalBinary(e.CreatedAt); err != nil {
+			return nil, "", err
 		}
 	}
-	return &accounts, nil
+	return &entries, response.NextCursor, nil
+}
+
+// CreateAPIKey creates a key for the account and returns it along with the
+// key itself, which cannot be retrieved later.
+func (c *Client) CreateAPIKey(ctx context.Context, accountID string, name string) (APIKey, string, error) {
+	response, err := c.service.CreateApiKey(ctx, &pb.CreateApiKeyRequest{AccountId: accountID, Name: name})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	apiKey, err := apiKeyFromProto(response.ApiKey)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	return apiKey, response.Key, nil
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	response, err := c.service.ListApiKeys(ctx, &pb.ListApiKeysRequest{AccountId: accountID})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKey, len(response.ApiKeys))
+	for i, k := range response.ApiKeys {
+		if keys[i], err = apiKeyFromProto(k); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (c *Client) RevokeAPIKey(ctx context.Context, accountID string, id string) error {
+	_, err := c.service.RevokeApiKey(ctx, &pb.RevokeApiKeyRequest{AccountId: accountID, Id: id})
+	return err
+}
+
+// AuthenticateAPIKey returns the account owning key.
+func (c *Client) AuthenticateAPIKey(ctx context.Context, key string) (Account, error) {
+	response, err := c.service.AuthenticateApiKey(ctx, &pb.AuthenticateApiKeyRequest{Key: key})
+	if err != nil {
+		return Account{}, err
+	}
+	return accountFromProto(response.Account), nil
+}
+
+// ImportAccounts streams the rows returned by next, until it returns io.EOF,
+// to the service and returns the result of every row.
+func (c *Client) ImportAccounts(ctx context.Context, next func() (AccountImport, error)) ([]ImportResult, error) {
+	// Cancelling the call if next fails keeps the server from importing
+	// the rows of the unfinished batch.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.service.ImportAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = stream.Send(&pb.ImportAccountsRequest{Name: row.Name, Email: row.Email, Password: row.Password})
+		if err == io.EOF {
+			// The server ended the call; CloseAndRecv returns its error.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ImportResult, len(response.Results))
+	for i, r := range response.Results {
+		results[i] = ImportResult{Row: int(r.Row)}
+		if r.Account != nil {
+			results[i].Account = accountFromProto(r.Account)
+		} else {
+			results[i].Err = errs.New(errs.Code(r.Code), r.Message)
+		}
+	}
+	return results, nil
+}
+
+func apiKeyFromProto(k *pb.ApiKey) (APIKey, error) {
+	apiKey := APIKey{
+		ID:        k.Id,
+		AccountID: k.AccountId,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+	}
+	err := apiKey.CreatedAt.UnmarshalBinary(k.CreatedAt)
+	return apiKey, err
+}
+
+func accountFromProto(a *pb.Account) Account {
+	return Account{
+		ID:     a.Id,
+		Name:   a.Name,
+		Email:  a.Email,
+		Role:   a.Role,
+		Status: a.Status,
+	}
 }
@@ -0,0 +1,173 @@
+// Command account-import creates accounts in bulk through the ImportAccounts
+// RPC of the account service.
+//
+//	account-import -admin <account id> [-url localhost:8080] [-format csv|jsonl] <file>
+//
+// CSV files start with a header naming the name, email and password columns,
+// in any order. JSON Lines files hold one {"name", "email", "password"}
+// object per line. The format defaults to the file extension; pass - as the
+// file to read standard input.
+//
+// The command calls the service as the given admin account, signing that
+// identity with the key in the IDENTITY_KEY environment variable, which
+// must be the one the services share.
+//
+// Failed rows are listed on standard error and make the command exit with
+// status 1. Running an import again is safe: rows imported the first time
+// fail as taken emails.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	url := flag.String("url", "localhost:8080", "address of the account service")
+	admin := flag.String("admin", "", "id of the admin account to import as (required)")
+	format := flag.String("format", "", "input format, csv or jsonl (default from the file extension)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: account-import -admin <account id> [flags] <file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *admin == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	key, err := authz.ParseKey(os.Getenv("IDENTITY_KEY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := flag.Arg(0)
+	in := os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if *format == "" {
+		*format = formatOf(name)
+	}
+
+	var next func() (account.AccountImport, error)
+	switch *format {
+	case "csv":
+		var err error
+		if next, err = csvRows(in); err != nil {
+			log.Fatal(err)
+		}
+	case "jsonl":
+		next = jsonlRows(in)
+	default:
+		log.Fatalf("unknown format %q, use -format csv or -format jsonl", *format)
+	}
+
+	client, err := account.NewClient(*url, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = authz.ContextWithIdentity(ctx, authz.Identity{AccountID: *admin, Roles: []string{authz.RoleAdmin}})
+
+	results, err := client.ImportAccounts(ctx, next)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "row %d: %v\n", r.Row, r.Err)
+		}
+	}
+	fmt.Printf("imported %d accounts, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func formatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return ""
+}
+
+// csvRows reads the header of r and returns a function that reads the rows
+// after it.
+func csvRows(r io.Reader) (func() (account.AccountImport, error), error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"name", "email", "password"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("csv header has no %q column", column)
+		}
+	}
+	return func() (account.AccountImport, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return account.AccountImport{}, err
+		}
+		return account.AccountImport{
+			Name:     record[columns["name"]],
+			Email:    record[columns["email"]],
+			Password: record[columns["password"]],
+		}, nil
+	}, nil
+}
+
+// jsonlRows returns a function that reads one row per non-blank line of r.
+func jsonlRows(r io.Reader) func() (account.AccountImport, error) {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	return func() (account.AccountImport, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			row := account.AccountImport{}
+			if err := json.Unmarshal(text, &row); err != nil {
+				return account.AccountImport{}, fmt.Errorf("line %d: %w", line, err)
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return account.AccountImport{}, err
+		}
+		return account.AccountImport{}, io.EOF
+	}
+}
@@ -1,33 +1,90 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 	"log"
+	"os"
 	"time"
 )
 
 type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	OrderURL    string `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	// IdentityKey signs and verifies the caller identities passed between
+	// the gateway and the services, which must all share it. At least 32
+	// bytes.
+	IdentityKey authz.Key `envconfig:"IDENTITY_KEY" required:"true"`
+	// IdempotencyWindow is how long the result of a PostAccount call is
+	// replayed to retries with the same idempotency key.
+	IdempotencyWindow time.Duration `envconfig:"IDEMPOTENCY_WINDOW" default:"24h"`
 }
 
 func main() {
+	// account migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	var cfg Config
 	if err := envconfig.Process("", &cfg); err != nil {
 		log.Fatal(err)
 	}
+
 	var r account.Repository
 	retry.ForeverSleep(2*time.Second, func(i int) (err error) {
+		if err = migrateUp(cfg.DatabaseURL); err != nil {
+			log.Println(err)
+			return err
+		}
 		r, err = account.NewPostgresRepository(cfg.DatabaseURL)
 		if err != nil {
 			log.Println(err)
 			return err
 		}
 		defer r.Close()
+		keys, err := idempotency.NewPostgresStore(cfg.DatabaseURL)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+		defer keys.Close()
 		log.Println("server is start at ", time.Now(), " Listening on port 8080...")
 		s := account.NewAccountService(r)
-		log.Fatal(account.ListenGRPC(s, 8080))
+		log.Fatal(account.ListenGRPC(s, keys, cfg.IdempotencyWindow, cfg.IdentityKey, cfg.OrderURL, 8080))
 		return
 	})
 }
+
+func migrateUp(url string) error {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Up(context.Background(), db, account.Migrations)
+}
+
+func runMigrate(args []string) {
+	var cfg struct {
+		DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	}
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err = migrate.Run(context.Background(), db, account.Migrations, args, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,427 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// memoryRepository keeps accounts in process memory. It mirrors
+// postgresRepository, including its not-found errors, so services can be
+// exercised without a database.
+type memoryRepository struct {
+	mu        sync.RWMutex
+	accounts  map[string]Account
+	deleted   map[string]bool
+	addresses map[string]Address
+	audit     []AuditEntry
+	apiKeys   map[string]APIKey
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{
+		accounts:  map[string]Account{},
+		deleted:   map[string]bool{},
+		addresses: map[string]Address{},
+		apiKeys:   map[string]APIKey{},
+	}
+}
+
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+func (r *memoryRepository) PutAccount(ctx context.Context, a Account) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.accounts[a.ID]; ok {
+		return errs.New(errs.AlreadyExists, "account already exists")
+	}
+	for id, existing := range r.accounts {
+		if existing.Email == a.Email && !r.deleted[id] {
+			return ErrEmailTaken
+		}
+	}
+	entry, err := newAuditEntry(ctx, a.ID, AuditAccountCreated, nil, a)
+	if err != nil {
+		return err
+	}
+	r.accounts[a.ID] = a
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) PutAccounts(ctx context.Context, accounts []Account) ([]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Like the transaction of postgresRepository, store all or nothing.
+	for _, a := range accounts {
+		if _, ok := r.accounts[a.ID]; ok {
+			return nil, errs.New(errs.AlreadyExists, "account already exists")
+		}
+	}
+	emails := map[string]bool{}
+	for id, a := range r.accounts {
+		if !r.deleted[id] {
+			emails[a.Email] = true
+		}
+	}
+	rowErrs := make([]error, len(accounts))
+	stored := []Account{}
+	entries := []AuditEntry{}
+	for i, a := range accounts {
+		if emails[a.Email] {
+			rowErrs[i] = ErrEmailTaken
+			continue
+		}
+		emails[a.Email] = true
+		entry, err := newAuditEntry(ctx, a.ID, AuditAccountCreated, nil, a)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, a)
+		entries = append(entries, entry)
+	}
+	for _, a := range stored {
+		r.accounts[a.ID] = a
+	}
+	r.audit = append(r.audit, entries...)
+	return rowErrs, nil
+}
+
+func (r *memoryRepository) GetAccountByID(ctx context.Context, id string) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.accounts[id]
+	if !ok || r.deleted[id] {
+		return Account{}, ErrNotFound
+	}
+	a.PasswordHash = ""
+	return a, nil
+}
+
+func (r *memoryRepository) GetAccountByEmail(ctx context.Context, email string) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for id, a := range r.accounts {
+		if a.Email == email && !r.deleted[id] {
+			return a, nil
+		}
+	}
+	return Account{}, ErrNotFound
+}
+
+func (r *memoryRepository) ListAccounts(ctx context.Context, after string, take uint64) (*[]Account, error) {
+	return r.list(after, take, func(Account) bool { return true }), nil
+}
+
+func (r *memoryRepository) SearchAccounts(ctx context.Context, query string, after string, take uint64) (*[]Account, error) {
+	query = strings.ToLower(query)
+	return r.list(after, take, func(a Account) bool {
+		return strings.Contains(strings.ToLower(a.Name), query)
+	}), nil
+}
+
+// list returns live accounts accepted by match, ordered by id descending and
+// starting after the given id.
+func (r *memoryRepository) list(after string, take uint64, match func(Account) bool) *[]Account {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	accounts := []Account{}
+	for id, a := range r.accounts {
+		if r.deleted[id] || (after != "" && id >= after) || !match(a) {
+			continue
+		}
+		a.PasswordHash = ""
+		accounts = append(accounts, a)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID > accounts[j].ID })
+	if uint64(len(accounts)) > take {
+		accounts = accounts[:take]
+	}
+	return &accounts
+}
+
+func (r *memoryRepository) UpdateAccount(ctx context.Context, id string, name string) (Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.accounts[id]
+	if !ok || r.deleted[id] {
+		return Account{}, ErrNotFound
+	}
+	before := a
+	a.Name = name
+	entry, err := newAuditEntry(ctx, id, AuditAccountUpdated, before, a)
+	if err != nil {
+		return Account{}, err
+	}
+	r.accounts[id] = a
+	r.audit = append(r.audit, entry)
+	a.PasswordHash = ""
+	return a, nil
+}
+
+func (r *memoryRepository) DeleteAccount(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.accounts[id]
+	if !ok || r.deleted[id] {
+		return ErrNotFound
+	}
+	entry, err := newAuditEntry(ctx, id, AuditAccountDeleted, a, nil)
+	if err != nil {
+		return err
+	}
+	r.deleted[id] = true
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) UpdateAccountStatus(ctx context.Context, id string, from string, to string) (Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.accounts[id]
+	if !ok || r.deleted[id] || a.Status != from {
+		return Account{}, ErrNotFound
+	}
+	before := a
+	a.Status = to
+	entry, err := newAuditEntry(ctx, id, AuditStatusChanged, before, a)
+	if err != nil {
+		return Account{}, err
+	}
+	r.accounts[id] = a
+	r.audit = append(r.audit, entry)
+	a.PasswordHash = ""
+	return a, nil
+}
+
+func (r *memoryRepository) EraseAccount(ctx context.Context, id string) (Account, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.accounts[id]
+	if !ok {
+		return Account{}, ErrNotFound
+	}
+	before := a
+	a.Name = erasedName
+	a.Email = erasedEmail(id)
+	a.PasswordHash = ""
+	a.Status = StatusClosed
+	entry, err := newAuditEntry(ctx, id, AuditAccountErased, before, a)
+	if err != nil {
+		return Account{}, err
+	}
+	r.accounts[id] = a
+	r.deleted[id] = true
+	for addressID, address := range r.addresses {
+		if address.AccountID == id {
+			delete(r.addresses, addressID)
+		}
+	}
+	r.audit = append(r.audit, entry)
+	for i, e := range r.audit {
+		if e.AccountID == id {
+			r.audit[i].Before = redact(e.Before)
+			r.audit[i].After = redact(e.After)
+		}
+	}
+	return a, nil
+}
+
+func (r *memoryRepository) PutAddress(ctx context.Context, address Address) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.accounts[address.AccountID]; !ok || r.deleted[address.AccountID] {
+		return ErrNotFound
+	}
+	if _, ok := r.addresses[address.ID]; ok {
+		return errs.New(errs.AlreadyExists, "address already exists")
+	}
+	entry, err := newAuditEntry(ctx, address.AccountID, AuditAddressCreated, nil, address)
+	if err != nil {
+		return err
+	}
+	r.clearDefaultAddresses(address)
+	r.addresses[address.ID] = address
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) ListAddresses(ctx context.Context, accountID string) (*[]Address, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	addresses := []Address{}
+	for _, a := range r.addresses {
+		if a.AccountID == accountID {
+			addresses = append(addresses, a)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool { return addresses[i].ID < addresses[j].ID })
+	return &addresses, nil
+}
+
+func (r *memoryRepository) UpdateAddress(ctx context.Context, address Address) (Address, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.accounts[address.AccountID]; !ok || r.deleted[address.AccountID] {
+		return Address{}, ErrNotFound
+	}
+	existing, ok := r.addresses[address.ID]
+	if !ok || existing.AccountID != address.AccountID {
+		return Address{}, ErrAddressNotFound
+	}
+	entry, err := newAuditEntry(ctx, address.AccountID, AuditAddressUpdated, existing, address)
+	if err != nil {
+		return Address{}, err
+	}
+	r.clearDefaultAddresses(address)
+	r.addresses[address.ID] = address
+	r.audit = append(r.audit, entry)
+	return address, nil
+}
+
+func (r *memoryRepository) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.addresses[id]
+	if !ok || existing.AccountID != accountID {
+		return ErrAddressNotFound
+	}
+	entry, err := newAuditEntry(ctx, accountID, AuditAddressDeleted, existing, nil)
+	if err != nil {
+		return err
+	}
+	delete(r.addresses, id)
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) ListAccountAudit(ctx context.Context, accountID string, after string, take uint64) (*[]AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	// Newest first, like postgresRepository. Entries are appended in order,
+	// which also settles those made in the same microsecond.
+	entries := []AuditEntry{}
+	for i := len(r.audit) - 1; i >= 0; i-- {
+		if r.audit[i].AccountID == accountID {
+			entries = append(entries, r.audit[i])
+		}
+	}
+	if after != "" {
+		i := slices.IndexFunc(entries, func(e AuditEntry) bool { return e.ID == after })
+		if i < 0 {
+			return &[]AuditEntry{}, nil
+		}
+		entries = entries[i+1:]
+	}
+	if uint64(len(entries)) > take {
+		entries = entries[:take]
+	}
+	return &entries, nil
+}
+
+func (r *memoryRepository) PutAPIKey(ctx context.Context, key APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.accounts[key.AccountID]; !ok || r.deleted[key.AccountID] {
+		return ErrNotFound
+	}
+	if _, ok := r.apiKeys[key.ID]; ok {
+		return errs.New(errs.AlreadyExists, "api key already exists")
+	}
+	entry, err := newAuditEntry(ctx, key.AccountID, AuditAPIKeyCreated, nil, key)
+	if err != nil {
+		return err
+	}
+	r.apiKeys[key.ID] = key
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) ListAPIKeys(ctx context.Context, accountID string) (*[]APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := []APIKey{}
+	for _, k := range r.apiKeys {
+		if k.AccountID == accountID {
+			k.Hash = ""
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return &keys, nil
+}
+
+// RevokeAPIKey forgets the key, where postgresRepository keeps it marked as
+// revoked.
+func (r *memoryRepository) RevokeAPIKey(ctx context.Context, accountID string, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.apiKeys[id]
+	if !ok || k.AccountID != accountID {
+		return ErrAPIKeyNotFound
+	}
+	entry, err := newAuditEntry(ctx, accountID, AuditAPIKeyRevoked, k, nil)
+	if err != nil {
+		return err
+	}
+	delete(r.apiKeys, id)
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func (r *memoryRepository) GetAccountByAPIKey(ctx context.Context, hash string) (Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, k := range r.apiKeys {
+		if k.Hash != hash {
+			continue
+		}
+		a, ok := r.accounts[k.AccountID]
+		if !ok || r.deleted[k.AccountID] || a.Status != StatusActive {
+			break
+		}
+		a.PasswordHash = ""
+		return a, nil
+	}
+	return Account{}, ErrNotFound
+}
+
+// redact strips the personal data from an audit snapshot.
+func redact(raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	for _, f := range redactedFields {
+		delete(fields, f)
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func (r *memoryRepository) clearDefaultAddresses(address Address) {
+	for id, a := range r.addresses {
+		if a.AccountID != address.AccountID || id == address.ID {
+			continue
+		}
+		if address.DefaultShipping {
+			a.DefaultShipping = false
+		}
+		if address.DefaultBilling {
+			a.DefaultBilling = false
+		}
+		r.addresses[id] = a
+	}
+}
@@ -0,0 +1,14 @@
+package account_test
+
+import (
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/account/accounttest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	accounttest.TestRepository(t, func(t *testing.T) account.Repository {
+		return account.NewMemoryRepository()
+	})
+}
@@ -0,0 +1,13 @@
+package account
+
+import (
+	"embed"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations is the schema history of the account database, applied by
+// cmd/account on startup.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
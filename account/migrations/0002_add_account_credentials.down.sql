@@ -0,0 +1,3 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE accounts DROP COLUMN IF EXISTS password_hash;
+ALTER TABLE accounts DROP COLUMN IF EXISTS email;
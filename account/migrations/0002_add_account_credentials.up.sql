@@ -0,0 +1,12 @@
+-- Accounts created before credentials existed get a placeholder email they
+-- cannot log in with and an empty password hash, which never matches.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS email VARCHAR(254);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS password_hash VARCHAR(60);
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE accounts SET email = 'unknown-' || id || '@accounts.invalid' WHERE email IS NULL;
+UPDATE accounts SET password_hash = '' WHERE password_hash IS NULL;
+
+ALTER TABLE accounts ALTER COLUMN email SET NOT NULL;
+ALTER TABLE accounts ALTER COLUMN password_hash SET NOT NULL;
+ALTER TABLE accounts ADD CONSTRAINT accounts_email_key UNIQUE (email);
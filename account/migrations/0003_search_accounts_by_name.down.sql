@@ -0,0 +1 @@
+DROP INDEX IF EXISTS accounts_name_trgm_idx;
@@ -0,0 +1,3 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS accounts_name_trgm_idx ON accounts USING gin (lower(name) gin_trgm_ops);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    id CHAR(27) PRIMARY KEY,
+    account_id CHAR(27) NOT NULL REFERENCES accounts (id),
+    recipient VARCHAR(128) NOT NULL,
+    line1 VARCHAR(256) NOT NULL,
+    line2 VARCHAR(256) NOT NULL DEFAULT '',
+    city VARCHAR(128) NOT NULL,
+    region VARCHAR(128) NOT NULL DEFAULT '',
+    postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL,
+    is_default_shipping BOOLEAN NOT NULL DEFAULT false,
+    is_default_billing BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS addresses_account_id_idx ON addresses (account_id);
+
+-- At most one default shipping and one default billing address per account.
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_default_shipping_idx ON addresses (account_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_default_billing_idx ON addresses (account_id) WHERE is_default_billing;
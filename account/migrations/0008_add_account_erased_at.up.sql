@@ -0,0 +1,2 @@
+-- Set once the account's personal data has been erased.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS erased_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS account_audit;
+DROP FUNCTION IF EXISTS account_audit_append_only();
@@ -0,0 +1,30 @@
+-- One row per change to an account or its addresses. before and after hold
+-- snapshots of the changed record; before is NULL when it was created and
+-- after is NULL when it was deleted. actor_id is empty for anonymous sign-ups.
+CREATE TABLE IF NOT EXISTS account_audit (
+    id CHAR(27) PRIMARY KEY,
+    account_id CHAR(27) NOT NULL,
+    actor_id VARCHAR(27) NOT NULL DEFAULT '',
+    action VARCHAR(32) NOT NULL,
+    before JSONB,
+    after JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS account_audit_account_id_idx ON account_audit (account_id, id DESC);
+
+-- The log is append-only. The one exception is erasure, which strips the
+-- personal data from an account's entries after SET LOCAL
+-- account_audit.redact = 'on' in its transaction.
+CREATE OR REPLACE FUNCTION account_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND current_setting('account_audit.redact', true) = 'on' THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'account_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS account_audit_append_only ON account_audit;
+CREATE TRIGGER account_audit_append_only BEFORE UPDATE OR DELETE ON account_audit
+    FOR EACH ROW EXECUTE PROCEDURE account_audit_append_only();
@@ -0,0 +1,13 @@
+-- API keys let an account call the API without logging in. Only the SHA-256
+-- of a key is stored; prefix is the start of the key, to tell keys apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id CHAR(27) PRIMARY KEY,
+    account_id CHAR(27) NOT NULL REFERENCES accounts (id),
+    name VARCHAR(64) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_account_id_idx ON api_keys (account_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS accounts_email_live_idx;
+ALTER TABLE accounts ADD CONSTRAINT accounts_email_key UNIQUE (email);
@@ -0,0 +1,4 @@
+-- Only live accounts need distinct emails, so an email can be registered
+-- again once its account has been deleted.
+ALTER TABLE accounts DROP CONSTRAINT IF EXISTS accounts_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS accounts_email_live_idx ON accounts (email) WHERE deleted_at IS NULL;
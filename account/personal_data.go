@@ -0,0 +1,48 @@
+package account
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"time"
+)
+
+// AccountExport is the document handed out for a personal-data export.
+type AccountExport struct {
+	ExportedAt time.Time       `json:"exportedAt"`
+	Account    Account         `json:"account"`
+	Addresses  []Address       `json:"addresses"`
+	Orders     []ExportedOrder `json:"orders"`
+}
+
+// ExportedOrder is an order as it appears in an AccountExport. Prices are
+// amounts in minor units with their currency.
+type ExportedOrder struct {
+	ID         string                 `json:"id"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	TotalPrice money.Money            `json:"totalPrice"`
+	Products   []ExportedOrderProduct `json:"products"`
+}
+
+type ExportedOrderProduct struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	Quantity    uint32      `json:"quantity"`
+}
+
+// erasedName replaces the name of an erased account.
+const erasedName = "Erased account"
+
+// erasedEmail returns the placeholder email of an erased account. It is
+// unique per account, as emails must be, and cannot receive mail.
+func erasedEmail(id string) string {
+	return "erased-" + id + "@erased.invalid"
+}
+
+// EraseAccount anonymizes the account: its name, email and password are
+// replaced, its addresses deleted and the account closed. Its orders are
+// kept under the same id, so their totals stay available for accounting.
+func (s *service) EraseAccount(ctx context.Context, id string) (Account, error) {
+	return s.repository.EraseAccount(ctx, id)
+}
@@ -3,14 +3,34 @@ package account
 import (
 	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
+	"encoding/json"
+	"errors"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/lib/pq"
+	"strings"
 )
 
 type Repository interface {
 	Close() error
 	PutAccount(ctx context.Context, a Account) error
+	PutAccounts(ctx context.Context, accounts []Account) ([]error, error)
 	GetAccountByID(ctx context.Context, id string) (Account, error)
-	ListAccounts(ctx context.Context, skip uint64, take uint64) (*[]Account, error)
+	GetAccountByEmail(ctx context.Context, email string) (Account, error)
+	ListAccounts(ctx context.Context, after string, take uint64) (*[]Account, error)
+	SearchAccounts(ctx context.Context, query string, after string, take uint64) (*[]Account, error)
+	UpdateAccount(ctx context.Context, id string, name string) (Account, error)
+	DeleteAccount(ctx context.Context, id string) error
+	UpdateAccountStatus(ctx context.Context, id string, from string, to string) (Account, error)
+	EraseAccount(ctx context.Context, id string) (Account, error)
+	PutAddress(ctx context.Context, address Address) error
+	ListAddresses(ctx context.Context, accountID string) (*[]Address, error)
+	UpdateAddress(ctx context.Context, address Address) (Address, error)
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	ListAccountAudit(ctx context.Context, accountID string, after string, take uint64) (*[]AuditEntry, error)
+	PutAPIKey(ctx context.Context, key APIKey) error
+	ListAPIKeys(ctx context.Context, accountID string) (*[]APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID string, id string) error
+	GetAccountByAPIKey(ctx context.Context, hash string) (Account, error)
 }
 
 type postgresRepository struct {
@@ -42,40 +62,648 @@ func (r *postgresRepository) Ping() error {
 }
 
 func (r *postgresRepository) PutAccount(ctx context.Context, a Account) error {
-	_, err := r.db.ExecContext(ctx, "INSERT INTO accounts(id, name) VALUES($1, $2)", a.ID, a.Name)
-	return err
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO accounts(id, name, email, role, status, password_hash) VALUES($1, $2, $3, $4, $5, $6)",
+			a.ID,
+			a.Name,
+			a.Email,
+			a.Role,
+			a.Status,
+			a.PasswordHash,
+		)
+		if err != nil {
+			return err
+		}
+		return audit(ctx, tx, a.ID, AuditAccountCreated, nil, a)
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+		return ErrEmailTaken
+	}
+	return dbError(err, ErrNotFound)
+}
+
+// PutAccounts stores accounts in a single transaction. Accounts whose email
+// is taken, by a live account or one earlier in the batch, are skipped;
+// the returned slice holds ErrEmailTaken at their positions and nil
+// elsewhere.
+func (r *postgresRepository) PutAccounts(ctx context.Context, accounts []Account) ([]error, error) {
+	rowErrs := make([]error, len(accounts))
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(
+			ctx,
+			`INSERT INTO accounts(id, name, email, role, status, password_hash) VALUES($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (email) WHERE deleted_at IS NULL DO NOTHING`,
+		)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for i, a := range accounts {
+			result, err := stmt.ExecContext(ctx, a.ID, a.Name, a.Email, a.Role, a.Status, a.PasswordHash)
+			if err != nil {
+				return err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				rowErrs[i] = ErrEmailTaken
+				continue
+			}
+			if err = audit(ctx, tx, a.ID, AuditAccountCreated, nil, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	return rowErrs, nil
 }
 
 func (r *postgresRepository) GetAccountByID(ctx context.Context, id string) (Account, error) {
-	row := r.db.QueryRowContext(ctx, "SELECT id, name FROM accounts WHERE id = $1", id)
+	row := r.db.QueryRowContext(ctx, "SELECT id, name, email, role, status FROM accounts WHERE id = $1 AND deleted_at IS NULL", id)
 	a := Account{}
-	if err := row.Scan(&a.ID, &a.Name); err != nil {
-		return Account{}, err
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err != nil {
+		return Account{}, dbError(err, ErrNotFound)
 	}
 	return a, nil
 }
 
-func (r *postgresRepository) ListAccounts(ctx context.Context, skip uint64, take uint64) (*[]Account, error) {
+func (r *postgresRepository) GetAccountByEmail(ctx context.Context, email string) (Account, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		"SELECT id, name, email, role, status, password_hash FROM accounts WHERE email = $1 AND deleted_at IS NULL",
+		email,
+	)
+	a := Account{}
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status, &a.PasswordHash); err != nil {
+		return Account{}, dbError(err, ErrNotFound)
+	}
+	return a, nil
+}
+
+// ListAccounts returns up to take accounts ordered by id descending, starting
+// after the given id. KSUIDs sort by creation time, so seeking on the primary
+// key keeps pages stable without scanning skipped rows.
+func (r *postgresRepository) ListAccounts(ctx context.Context, after string, take uint64) (*[]Account, error) {
 	rows, err := r.db.QueryContext(
 		ctx,
-		"SELECT id, name FROM accounts ORDER BY id DESC OFFSET $1 LIMIT $2",
-		skip,
+		`SELECT id, name, email, role, status FROM accounts
+		WHERE deleted_at IS NULL AND ($1 = '' OR id < $1)
+		ORDER BY id DESC LIMIT $2`,
+		after,
 		take,
 	)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err, ErrNotFound)
 	}
 	defer rows.Close()
 
 	accounts := []Account{}
 	for rows.Next() {
 		a := &Account{}
-		if err = rows.Scan(&a.ID, &a.Name); err == nil {
+		if err = rows.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err == nil {
 			accounts = append(accounts, *a)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, dbError(err, ErrNotFound)
+	}
+	return &accounts, nil
+}
+
+// SearchAccounts matches query anywhere in the name, case-insensitively, and
+// pages the same way as ListAccounts.
+func (r *postgresRepository) SearchAccounts(ctx context.Context, query string, after string, take uint64) (*[]Account, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT id, name, email, role, status FROM accounts
+		WHERE deleted_at IS NULL AND lower(name) LIKE $1 AND ($2 = '' OR id < $2)
+		ORDER BY id DESC LIMIT $3`,
+		"%"+likeEscaper.Replace(strings.ToLower(query))+"%",
+		after,
+		take,
+	)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		a := &Account{}
+		if err = rows.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err == nil {
+			accounts = append(accounts, *a)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err, ErrNotFound)
 	}
 	return &accounts, nil
 }
+
+// likeEscaper escapes LIKE wildcards so user input is matched literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (r *postgresRepository) UpdateAccount(ctx context.Context, id string, name string) (Account, error) {
+	a := Account{}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockAccount(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(
+			ctx,
+			"UPDATE accounts SET name = $2 WHERE id = $1 RETURNING id, name, email, role, status",
+			id,
+			name,
+		)
+		if err = row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err != nil {
+			return err
+		}
+		return audit(ctx, tx, id, AuditAccountUpdated, before, a)
+	})
+	if err != nil {
+		return Account{}, dbError(err, ErrNotFound)
+	}
+	return a, nil
+}
+
+// DeleteAccount soft-deletes the account by stamping deleted_at, so it no
+// longer shows up in reads while its orders keep a valid owner.
+func (r *postgresRepository) DeleteAccount(ctx context.Context, id string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockAccount(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "UPDATE accounts SET deleted_at = now() WHERE id = $1", id); err != nil {
+			return err
+		}
+		return audit(ctx, tx, id, AuditAccountDeleted, before, nil)
+	})
+	return dbError(err, ErrNotFound)
+}
+
+// UpdateAccountStatus moves the account from one status to another. It
+// returns ErrNotFound if the account is gone or no longer in status from.
+func (r *postgresRepository) UpdateAccountStatus(ctx context.Context, id string, from string, to string) (Account, error) {
+	a := Account{}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := lockAccount(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if before.Status != from {
+			return ErrNotFound
+		}
+		row := tx.QueryRowContext(
+			ctx,
+			"UPDATE accounts SET status = $2 WHERE id = $1 RETURNING id, name, email, role, status",
+			id,
+			to,
+		)
+		if err = row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err != nil {
+			return err
+		}
+		return audit(ctx, tx, id, AuditStatusChanged, before, a)
+	})
+	if err != nil {
+		return Account{}, dbError(err, ErrNotFound)
+	}
+	return a, nil
+}
+
+// EraseAccount replaces the account's name, email and password with
+// placeholders, deletes its addresses and closes it, deleted or not. The
+// id stays, so the account's orders still add up. The personal data is
+// also stripped from the account's audit entries. Erasing twice is
+// harmless.
+func (r *postgresRepository) EraseAccount(ctx context.Context, id string) (Account, error) {
+	a := Account{}
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before := Account{}
+		row := tx.QueryRowContext(ctx, "SELECT id, name, email, role, status FROM accounts WHERE id = $1 FOR UPDATE", id)
+		if err := row.Scan(&before.ID, &before.Name, &before.Email, &before.Role, &before.Status); err != nil {
+			return err
+		}
+		row = tx.QueryRowContext(
+			ctx,
+			`UPDATE accounts SET
+				name = $2, email = $3, password_hash = '', status = $4,
+				deleted_at = COALESCE(deleted_at, now()), erased_at = COALESCE(erased_at, now())
+			WHERE id = $1
+			RETURNING id, name, email, role, status`,
+			id,
+			erasedName,
+			erasedEmail(id),
+			StatusClosed,
+		)
+		if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM addresses WHERE account_id = $1", id); err != nil {
+			return err
+		}
+		if err := audit(ctx, tx, id, AuditAccountErased, before, a); err != nil {
+			return err
+		}
+		// The audit log is append-only; this setting lets the erasure
+		// through, for the rest of the transaction only.
+		if _, err := tx.ExecContext(ctx, "SET LOCAL account_audit.redact = 'on'"); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE account_audit SET before = before - $2::text[], after = after - $2::text[] WHERE account_id = $1",
+			id,
+			pq.Array(redactedFields),
+		)
+		return err
+	})
+	if err != nil {
+		return Account{}, dbError(err, ErrNotFound)
+	}
+	return a, nil
+}
+
+// PutAddress stores a new address of a live account. If it is a default, the
+// account's previous default of the same kind is cleared in the same
+// transaction.
+func (r *postgresRepository) PutAddress(ctx context.Context, address Address) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := clearDefaultAddresses(ctx, tx, address); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO addresses(
+				id, account_id, recipient, line1, line2, city, region, postal_code, country,
+				is_default_shipping, is_default_billing
+			)
+			SELECT $1, id, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			FROM accounts WHERE id = $2 AND deleted_at IS NULL`,
+			address.ID,
+			address.AccountID,
+			address.Recipient,
+			address.Line1,
+			address.Line2,
+			address.City,
+			address.Region,
+			address.PostalCode,
+			address.Country,
+			address.DefaultShipping,
+			address.DefaultBilling,
+		)
+		if err != nil {
+			return dbError(err, ErrNotFound)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return audit(ctx, tx, address.AccountID, AuditAddressCreated, nil, address)
+	})
+}
+
+func (r *postgresRepository) ListAddresses(ctx context.Context, accountID string) (*[]Address, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+addressColumns+" FROM addresses WHERE account_id = $1 ORDER BY id",
+		accountID,
+	)
+	if err != nil {
+		return nil, dbError(err, ErrAddressNotFound)
+	}
+	defer rows.Close()
+
+	addresses := []Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, dbError(err, ErrAddressNotFound)
+		}
+		addresses = append(addresses, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err, ErrAddressNotFound)
+	}
+	return &addresses, nil
+}
+
+func (r *postgresRepository) UpdateAddress(ctx context.Context, address Address) (Address, error) {
+	var updated Address
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		// Like PutAddress, refuse addresses of deleted accounts.
+		if _, err := lockAccount(ctx, tx, address.AccountID); err != nil {
+			return dbError(err, ErrNotFound)
+		}
+		before, err := scanAddress(tx.QueryRowContext(
+			ctx,
+			"SELECT "+addressColumns+" FROM addresses WHERE id = $1 AND account_id = $2 FOR UPDATE",
+			address.ID,
+			address.AccountID,
+		))
+		if err != nil {
+			return err
+		}
+		if err = clearDefaultAddresses(ctx, tx, address); err != nil {
+			return err
+		}
+		row := tx.QueryRowContext(
+			ctx,
+			`UPDATE addresses SET
+				recipient = $3, line1 = $4, line2 = $5, city = $6, region = $7, postal_code = $8,
+				country = $9, is_default_shipping = $10, is_default_billing = $11
+			WHERE id = $1 AND account_id = $2
+			RETURNING `+addressColumns,
+			address.ID,
+			address.AccountID,
+			address.Recipient,
+			address.Line1,
+			address.Line2,
+			address.City,
+			address.Region,
+			address.PostalCode,
+			address.Country,
+			address.DefaultShipping,
+			address.DefaultBilling,
+		)
+		if updated, err = scanAddress(row); err != nil {
+			return err
+		}
+		return audit(ctx, tx, address.AccountID, AuditAddressUpdated, before, updated)
+	})
+	if err != nil {
+		return Address{}, dbError(err, ErrAddressNotFound)
+	}
+	return updated, nil
+}
+
+func (r *postgresRepository) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := scanAddress(tx.QueryRowContext(
+			ctx,
+			"DELETE FROM addresses WHERE id = $1 AND account_id = $2 RETURNING "+addressColumns,
+			id,
+			accountID,
+		))
+		if err != nil {
+			return err
+		}
+		return audit(ctx, tx, accountID, AuditAddressDeleted, before, nil)
+	})
+	return dbError(err, ErrAddressNotFound)
+}
+
+// ListAccountAudit returns up to take entries of the account's audit log,
+// newest first, starting after the entry with the given id. Entries made in
+// the same second are ordered by their timestamp, which KSUIDs alone do not
+// resolve.
+func (r *postgresRepository) ListAccountAudit(ctx context.Context, accountID string, after string, take uint64) (*[]AuditEntry, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		`SELECT id, account_id, actor_id, action, before, after, created_at FROM account_audit
+		WHERE account_id = $1 AND ($2 = '' OR (created_at, id) < (SELECT created_at, id FROM account_audit WHERE id = $2))
+		ORDER BY created_at DESC, id DESC LIMIT $3`,
+		accountID,
+		after,
+		take,
+	)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		e := AuditEntry{}
+		var before, afterSnapshot []byte
+		if err = rows.Scan(&e.ID, &e.AccountID, &e.ActorID, &e.Action, &before, &afterSnapshot, &e.CreatedAt); err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		e.Before, e.After = before, afterSnapshot
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	return &entries, nil
+}
+
+// PutAPIKey stores a new key for a live account.
+func (r *postgresRepository) PutAPIKey(ctx context.Context, key APIKey) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO api_keys(id, account_id, name, prefix, key_hash, created_at)
+			SELECT $1, id, $3, $4, $5, $6 FROM accounts WHERE id = $2 AND deleted_at IS NULL`,
+			key.ID,
+			key.AccountID,
+			key.Name,
+			key.Prefix,
+			key.Hash,
+			key.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrNotFound
+		}
+		return audit(ctx, tx, key.AccountID, AuditAPIKeyCreated, nil, key)
+	})
+	return dbError(err, ErrNotFound)
+}
+
+func (r *postgresRepository) ListAPIKeys(ctx context.Context, accountID string) (*[]APIKey, error) {
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE account_id = $1 AND revoked_at IS NULL ORDER BY id",
+		accountID,
+	)
+	if err != nil {
+		return nil, dbError(err, ErrAPIKeyNotFound)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, dbError(err, ErrAPIKeyNotFound)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err, ErrAPIKeyNotFound)
+	}
+	return &keys, nil
+}
+
+// RevokeAPIKey stamps revoked_at on the key. The row is kept so the hash
+// can never be issued again.
+func (r *postgresRepository) RevokeAPIKey(ctx context.Context, accountID string, id string) error {
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		before, err := scanAPIKey(tx.QueryRowContext(
+			ctx,
+			`UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND account_id = $2 AND revoked_at IS NULL
+			RETURNING `+apiKeyColumns,
+			id,
+			accountID,
+		))
+		if err != nil {
+			return err
+		}
+		return audit(ctx, tx, accountID, AuditAPIKeyRevoked, before, nil)
+	})
+	return dbError(err, ErrAPIKeyNotFound)
+}
+
+// GetAccountByAPIKey returns the live, active account owning the unrevoked
+// key with the given hash.
+func (r *postgresRepository) GetAccountByAPIKey(ctx context.Context, hash string) (Account, error) {
+	row := r.db.QueryRowContext(
+		ctx,
+		`SELECT a.id, a.name, a.email, a.role, a.status FROM api_keys k JOIN accounts a ON a.id = k.account_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL AND a.deleted_at IS NULL AND a.status = $2`,
+		hash,
+		StatusActive,
+	)
+	a := Account{}
+	if err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status); err != nil {
+		return Account{}, dbError(err, ErrNotFound)
+	}
+	return a, nil
+}
+
+const apiKeyColumns = "id, account_id, name, prefix, created_at"
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (APIKey, error) {
+	k := APIKey{}
+	err := row.Scan(&k.ID, &k.AccountID, &k.Name, &k.Prefix, &k.CreatedAt)
+	return k, err
+}
+
+// lockAccount reads the live account for update, so the snapshot audited
+// before a change is the one the change applies to.
+func lockAccount(ctx context.Context, tx *sql.Tx, id string) (Account, error) {
+	a := Account{}
+	row := tx.QueryRowContext(
+		ctx,
+		"SELECT id, name, email, role, status FROM accounts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	)
+	err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Role, &a.Status)
+	return a, err
+}
+
+// audit appends an entry for a change to accountID to the audit log, in the
+// transaction making the change.
+func audit(ctx context.Context, tx *sql.Tx, accountID, action string, before, after any) error {
+	entry, err := newAuditEntry(ctx, accountID, action, before, after)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO account_audit(id, account_id, actor_id, action, before, after, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7)`,
+		entry.ID,
+		entry.AccountID,
+		entry.ActorID,
+		entry.Action,
+		jsonb(entry.Before),
+		jsonb(entry.After),
+		entry.CreatedAt,
+	)
+	return err
+}
+
+// jsonb passes a snapshot as text, which Postgres casts to JSONB; lib/pq
+// would send a []byte as bytea. An empty snapshot is stored as NULL.
+func jsonb(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+const addressColumns = `id, account_id, recipient, line1, line2, city, region, postal_code, country,
+	is_default_shipping, is_default_billing`
+
+func scanAddress(row interface{ Scan(dest ...any) error }) (Address, error) {
+	a := Address{}
+	err := row.Scan(
+		&a.ID,
+		&a.AccountID,
+		&a.Recipient,
+		&a.Line1,
+		&a.Line2,
+		&a.City,
+		&a.Region,
+		&a.PostalCode,
+		&a.Country,
+		&a.DefaultShipping,
+		&a.DefaultBilling,
+	)
+	return a, err
+}
+
+// clearDefaultAddresses unsets the defaults that address is about to take over.
+func clearDefaultAddresses(ctx context.Context, tx *sql.Tx, address Address) error {
+	if address.DefaultShipping {
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE addresses SET is_default_shipping = false WHERE account_id = $1 AND id <> $2",
+			address.AccountID,
+			address.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if address.DefaultBilling {
+		_, err := tx.ExecContext(
+			ctx,
+			"UPDATE addresses SET is_default_billing = false WHERE account_id = $1 AND id <> $2",
+			address.AccountID,
+			address.ID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *postgresRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return dbError(tx.Commit(), ErrNotFound)
+}
+
+// dbError translates driver errors into the shared error model with
+// errs.FromSQL.
+func dbError(err error, notFound error) error {
+	return errs.FromSQL(err, "account", notFound)
+}
@@ -0,0 +1,40 @@
+package account_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/account/accounttest"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+// TestPostgresRepository runs against the database in ACCOUNT_TEST_DATABASE_URL,
+// migrated and with its tables emptied before every case.
+func TestPostgresRepository(t *testing.T) {
+	url := os.Getenv("ACCOUNT_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ACCOUNT_TEST_DATABASE_URL is not set")
+	}
+	accounttest.TestRepository(t, func(t *testing.T) account.Repository {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err = migrate.Up(context.Background(), db, account.Migrations); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("TRUNCATE accounts, addresses, account_audit, api_keys"); err != nil {
+			t.Fatal(err)
+		}
+		r, err := account.NewPostgresRepository(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return r
+	})
+}
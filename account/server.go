@@ -3,42 +3,124 @@ package account
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	pb "github.com/Mostbesep/microservice-com-temp/account/pb/microservice-com-temp.account.pb"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	orderpb "github.com/Mostbesep/microservice-com-temp/order/pb/microservice-com-temp.order.pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
+	"io"
+	"log"
 	"net"
+	"time"
 )
 
 type grpcServer struct {
 	service Service
+	orders  orderpb.OrderServiceClient
 	pb.UnimplementedAccountServiceServer
 }
 
-func ListenGRPC(s Service, port int) error {
+var policy = authz.Policy{
+	pb.AccountService_PostAccount_FullMethodName:  authz.Public(),
+	pb.AccountService_Authenticate_FullMethodName: authz.Public(),
+	pb.AccountService_GetAccounts_FullMethodName:  authz.RequireRole(authz.RoleAdmin),
+	pb.AccountService_GetAccount_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.GetAccountRequest).Id
+	}),
+	pb.AccountService_UpdateAccount_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.UpdateAccountRequest).Id
+	}),
+	pb.AccountService_DeleteAccount_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.DeleteAccountRequest).Id
+	}),
+	pb.AccountService_PostAddress_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.PostAddressRequest).GetAddress().GetAccountId()
+	}),
+	pb.AccountService_GetAddresses_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.GetAddressesRequest).AccountId
+	}),
+	pb.AccountService_UpdateAddress_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.UpdateAddressRequest).GetAddress().GetAccountId()
+	}),
+	pb.AccountService_DeleteAddress_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.DeleteAddressRequest).AccountId
+	}),
+	pb.AccountService_SuspendAccount_FullMethodName:    authz.RequireRole(authz.RoleAdmin),
+	pb.AccountService_ReactivateAccount_FullMethodName: authz.RequireRole(authz.RoleAdmin),
+	pb.AccountService_CloseAccount_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.CloseAccountRequest).Id
+	}),
+	pb.AccountService_ImportAccounts_FullMethodName: authz.RequireRole(authz.RoleAdmin),
+	pb.AccountService_ExportAccountData_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.ExportAccountDataRequest).Id
+	}),
+	pb.AccountService_EraseAccount_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.EraseAccountRequest).Id
+	}),
+	pb.AccountService_ListAccountAudit_FullMethodName: authz.RequireRole(authz.RoleAdmin),
+	pb.AccountService_CreateApiKey_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.CreateApiKeyRequest).AccountId
+	}),
+	pb.AccountService_ListApiKeys_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.ListApiKeysRequest).AccountId
+	}),
+	pb.AccountService_RevokeApiKey_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.RevokeApiKeyRequest).AccountId
+	}),
+	pb.AccountService_AuthenticateApiKey_FullMethodName: authz.Public(),
+}
+
+// importBatchSize is the number of streamed rows imported per transaction.
+const importBatchSize = 500
+
+func ListenGRPC(s Service, keys idempotency.Store, keyWindow time.Duration, key authz.Key, orderURL string, port int) error {
+	// The order package depends on this one, so the order service is called
+	// through its generated client rather than order.Client.
+	orderConn, err := grpc.NewClient(
+		orderURL,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(authz.UnaryClientInterceptor(key), errs.UnaryClientInterceptor()),
+	)
+	if err != nil {
+		return err
+	}
+	defer orderConn.Close()
+
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	server := grpc.NewServer()
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			errs.UnaryServerInterceptor(),
+			authz.UnaryServerInterceptor(key, policy),
+			idempotency.UnaryServerInterceptor(keys, keyWindow, pb.AccountService_PostAccount_FullMethodName),
+		),
+		grpc.ChainStreamInterceptor(errs.StreamServerInterceptor(), authz.StreamServerInterceptor(key, policy)),
+	)
 	pb.RegisterAccountServiceServer(server, &grpcServer{
 		UnimplementedAccountServiceServer: pb.UnimplementedAccountServiceServer{},
 		service:                           s,
+		orders:                            orderpb.NewOrderServiceClient(orderConn),
 	})
 	reflection.Register(server)
 	return server.Serve(lis)
 }
 
 func (s *grpcServer) PostAccount(ctx context.Context, r *pb.PostAccountRequest) (*pb.PostAccountResponse, error) {
-	a, err := s.service.PostAccount(ctx, r.Name)
+	a, err := s.service.PostAccount(ctx, r.Name, r.Email, r.Password)
 	if err != nil {
 		return nil, err
 	}
 	return &pb.PostAccountResponse{
-		Account: &pb.Account{
-			Id:   a.ID,
-			Name: a.Name,
-		},
+		Account: accountToProto(a),
 	}, nil
 }
 
@@ -48,27 +130,360 @@ func (s *grpcServer) GetAccount(ctx context.Context, r *pb.GetAccountRequest) (*
 		return nil, err
 	}
 	return &pb.GetAccountResponse{
-		Account: &pb.Account{
-			Id:   a.ID,
-			Name: a.Name,
-		},
+		Account: accountToProto(a),
 	}, nil
 }
 
 func (s *grpcServer) GetAccounts(ctx context.Context, r *pb.GetAccountsRequest) (*pb.GetAccountsResponse, error) {
-	accounts, err := s.service.GetAccounts(ctx, r.Skip, r.Take)
+	var accounts *[]Account
+	var nextCursor string
+	var err error
+	if r.Query != "" {
+		accounts, nextCursor, err = s.service.SearchAccounts(ctx, r.Query, r.Cursor, r.Take)
+	} else {
+		accounts, nextCursor, err = s.service.GetAccounts(ctx, r.Cursor, r.Take)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	var packedAccounts []*pb.Account
 	for _, a := range *accounts {
-		packedAccounts = append(packedAccounts, &pb.Account{
-			Id:   a.ID,
-			Name: a.Name,
-		})
+		packedAccounts = append(packedAccounts, accountToProto(a))
 	}
 	return &pb.GetAccountsResponse{
-		Accounts: packedAccounts,
+		Accounts:   packedAccounts,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+func (s *grpcServer) Authenticate(ctx context.Context, r *pb.AuthenticateRequest) (*pb.AuthenticateResponse, error) {
+	a, err := s.service.Authenticate(ctx, r.Email, r.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AuthenticateResponse{
+		Account: accountToProto(a),
+	}, nil
+}
+
+func (s *grpcServer) UpdateAccount(ctx context.Context, r *pb.UpdateAccountRequest) (*pb.UpdateAccountResponse, error) {
+	a, err := s.service.UpdateAccount(ctx, r.Id, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateAccountResponse{
+		Account: accountToProto(a),
+	}, nil
+}
+
+func (s *grpcServer) DeleteAccount(ctx context.Context, r *pb.DeleteAccountRequest) (*pb.DeleteAccountResponse, error) {
+	if err := s.service.DeleteAccount(ctx, r.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteAccountResponse{}, nil
+}
+
+func (s *grpcServer) PostAddress(ctx context.Context, r *pb.PostAddressRequest) (*pb.PostAddressResponse, error) {
+	a, err := s.service.PostAddress(ctx, addressFromProto(r.Address))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.PostAddressResponse{Address: addressToProto(a)}, nil
+}
+
+func (s *grpcServer) GetAddresses(ctx context.Context, r *pb.GetAddressesRequest) (*pb.GetAddressesResponse, error) {
+	addresses, err := s.service.GetAddresses(ctx, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	var packedAddresses []*pb.Address
+	for _, a := range *addresses {
+		packedAddresses = append(packedAddresses, addressToProto(a))
+	}
+	return &pb.GetAddressesResponse{Addresses: packedAddresses}, nil
+}
+
+func (s *grpcServer) UpdateAddress(ctx context.Context, r *pb.UpdateAddressRequest) (*pb.UpdateAddressResponse, error) {
+	a, err := s.service.UpdateAddress(ctx, addressFromProto(r.Address))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateAddressResponse{Address: addressToProto(a)}, nil
+}
+
+func (s *grpcServer) DeleteAddress(ctx context.Context, r *pb.DeleteAddressRequest) (*pb.DeleteAddressResponse, error) {
+	if err := s.service.DeleteAddress(ctx, r.AccountId, r.Id); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteAddressResponse{}, nil
+}
+
+func addressToProto(a Address) *pb.Address {
+	return &pb.Address{
+		Id:              a.ID,
+		AccountId:       a.AccountID,
+		Recipient:       a.Recipient,
+		Line1:           a.Line1,
+		Line2:           a.Line2,
+		City:            a.City,
+		Region:          a.Region,
+		PostalCode:      a.PostalCode,
+		Country:         a.Country,
+		DefaultShipping: a.DefaultShipping,
+		DefaultBilling:  a.DefaultBilling,
+	}
+}
+
+func addressFromProto(a *pb.Address) Address {
+	return Address{
+		ID:              a.GetId(),
+		AccountID:       a.GetAccountId(),
+		Recipient:       a.GetRecipient(),
+		Line1:           a.GetLine1(),
+		Line2:           a.GetLine2(),
+		City:            a.GetCity(),
+		Region:          a.GetRegion(),
+		PostalCode:      a.GetPostalCode(),
+		Country:         a.GetCountry(),
+		DefaultShipping: a.GetDefaultShipping(),
+		DefaultBilling:  a.GetDefaultBilling(),
+	}
+}
+
+func (s *grpcServer) SuspendAccount(ctx context.Context, r *pb.SuspendAccountRequest) (*pb.SuspendAccountResponse, error) {
+	a, err := s.service.SuspendAccount(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SuspendAccountResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) ReactivateAccount(ctx context.Context, r *pb.ReactivateAccountRequest) (*pb.ReactivateAccountResponse, error) {
+	a, err := s.service.ReactivateAccount(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ReactivateAccountResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) CloseAccount(ctx context.Context, r *pb.CloseAccountRequest) (*pb.CloseAccountResponse, error) {
+	a, err := s.service.CloseAccount(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CloseAccountResponse{Account: accountToProto(a)}, nil
+}
+
+func accountToProto(a Account) *pb.Account {
+	return &pb.Account{
+		Id:     a.ID,
+		Name:   a.Name,
+		Email:  a.Email,
+		Role:   a.Role,
+		Status: a.Status,
+	}
+}
+
+// ImportAccounts reads the stream in batches of importBatchSize rows and
+// imports each batch in its own transaction. If a batch fails, the call
+// fails; earlier batches stay imported and show up as taken emails when the
+// import is run again.
+func (s *grpcServer) ImportAccounts(stream pb.AccountService_ImportAccountsServer) error {
+	response := &pb.ImportAccountsResponse{}
+	batch := []AccountImport{}
+	flush := func() error {
+		results, err := s.service.ImportAccounts(stream.Context(), batch)
+		if err != nil {
+			return err
+		}
+		offset := len(response.Results)
+		for _, r := range results {
+			result := &pb.ImportAccountsResponse_Result{Row: uint32(offset + r.Row)}
+			if r.Err != nil {
+				result.Code, result.Message = importError(r.Err)
+				response.Failed++
+			} else {
+				result.Account = accountToProto(r.Account)
+				response.Imported++
+			}
+			response.Results = append(response.Results, result)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, AccountImport{Name: r.Name, Email: r.Email, Password: r.Password})
+		if len(batch) == importBatchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(response)
+}
+
+// ExportAccountData collects the account, its addresses and its orders from
+// the order service into one JSON document.
+func (s *grpcServer) ExportAccountData(ctx context.Context, r *pb.ExportAccountDataRequest) (*pb.ExportAccountDataResponse, error) {
+	a, err := s.service.GetAccount(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	addresses, err := s.service.GetAddresses(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	orders, err := s.orders.GetAccountOrders(ctx, &orderpb.GetAccountOrdersRequest{AccountId: r.Id})
+	if err != nil {
+		log.Println("Error fetching orders for export:", err)
+		return nil, err
+	}
+
+	export := AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Account:    a,
+		Addresses:  *addresses,
+		Orders:     []ExportedOrder{},
+	}
+	for _, o := range orders.Orders {
+		order := ExportedOrder{
+			ID:         o.Id,
+			TotalPrice: money.Money{Amount: o.GetTotalPrice().GetAmount(), Currency: o.GetTotalPrice().GetCurrency()},
+			Products:   []ExportedOrderProduct{},
+		}
+		if err = order.CreatedAt.UnmarshalBinary(o.CreatedAt); err != nil {
+			return nil, err
+		}
+		for _, p := range o.Products {
+			order.Products = append(order.Products, ExportedOrderProduct{
+				ID:          p.Id,
+				Name:        p.Name,
+				Description: p.Description,
+				Price:       money.Money{Amount: p.GetPrice().GetAmount(), Currency: p.GetPrice().GetCurrency()},
+				Quantity:    p.Quantity,
+			})
+		}
+		export.Orders = append(export.Orders, order)
+	}
+
+	document, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ExportAccountDataResponse{Document: document}, nil
+}
+
+func (s *grpcServer) EraseAccount(ctx context.Context, r *pb.EraseAccountRequest) (*pb.EraseAccountResponse, error) {
+	a, err := s.service.EraseAccount(ctx, r.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.EraseAccountResponse{Account: accountToProto(a)}, nil
+}
+
+func (s *grpcServer) ListAccountAudit(ctx context.Context, r *pb.ListAccountAuditRequest) (*pb.ListAccountAuditResponse, error) {
+	entries, nextCursor, err := s.service.ListAccountAudit(ctx, r.AccountId, r.Cursor, r.Take)
+	if err != nil {
+		return nil, err
+	}
+	response := &pb.ListAccountAuditResponse{NextCursor: nextCursor}
+	for _, e := range *entries {
+		createdAt, err := e.CreatedAt.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		response.Entries = append(response.Entries, &pb.AuditEntry{
+			Id:        e.ID,
+			AccountId: e.AccountID,
+			ActorId:   e.ActorID,
+			Action:    e.Action,
+			Before:    string(e.Before),
+			After:     string(e.After),
+			CreatedAt: createdAt,
+		})
+	}
+	return response, nil
+}
+
+func (s *grpcServer) CreateApiKey(ctx context.Context, r *pb.CreateApiKeyRequest) (*pb.CreateApiKeyResponse, error) {
+	apiKey, key, err := s.service.CreateAPIKey(ctx, r.AccountId, r.Name)
+	if err != nil {
+		return nil, err
+	}
+	packed, err := apiKeyToProto(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateApiKeyResponse{ApiKey: packed, Key: key}, nil
+}
+
+func (s *grpcServer) ListApiKeys(ctx context.Context, r *pb.ListApiKeysRequest) (*pb.ListApiKeysResponse, error) {
+	keys, err := s.service.ListAPIKeys(ctx, r.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	response := &pb.ListApiKeysResponse{}
+	for _, k := range *keys {
+		packed, err := apiKeyToProto(k)
+		if err != nil {
+			return nil, err
+		}
+		response.ApiKeys = append(response.ApiKeys, packed)
+	}
+	return response, nil
+}
+
+func (s *grpcServer) RevokeApiKey(ctx context.Context, r *pb.RevokeApiKeyRequest) (*pb.RevokeApiKeyResponse, error) {
+	if err := s.service.RevokeAPIKey(ctx, r.AccountId, r.Id); err != nil {
+		return nil, err
+	}
+	return &pb.RevokeApiKeyResponse{}, nil
+}
+
+func (s *grpcServer) AuthenticateApiKey(ctx context.Context, r *pb.AuthenticateApiKeyRequest) (*pb.AuthenticateApiKeyResponse, error) {
+	a, err := s.service.AuthenticateAPIKey(ctx, r.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AuthenticateApiKeyResponse{Account: accountToProto(a)}, nil
+}
+
+func apiKeyToProto(k APIKey) (*pb.ApiKey, error) {
+	createdAt, err := k.CreatedAt.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ApiKey{
+		Id:        k.ID,
+		AccountId: k.AccountID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		CreatedAt: createdAt,
 	}, nil
 }
+
+// importError returns the code and message reported for a row that failed.
+// Rows only fail with domain errors, but anything else is masked like
+// errs.ToStatus would.
+func importError(err error) (string, string) {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return string(e.Code), e.Message
+	}
+	log.Println(err)
+	return "INTERNAL", "internal error"
+}
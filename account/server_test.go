@@ -0,0 +1,100 @@
+package account
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/Mostbesep/microservice-com-temp/account/pb/microservice-com-temp.account.pb"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	orderpb "github.com/Mostbesep/microservice-com-temp/order/pb/microservice-com-temp.order.pb"
+	"google.golang.org/grpc"
+)
+
+// orderClient answers GetAccountOrders with fixed orders, or fails with err.
+type orderClient struct {
+	orderpb.OrderServiceClient
+	orders []*orderpb.Order
+	err    error
+}
+
+func (c *orderClient) GetAccountOrders(ctx context.Context, r *orderpb.GetAccountOrdersRequest, opts ...grpc.CallOption) (*orderpb.GetAccountOrdersResponse, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	orders := []*orderpb.Order{}
+	for _, o := range c.orders {
+		if o.AccountId == r.AccountId {
+			orders = append(orders, o)
+		}
+	}
+	return &orderpb.GetAccountOrdersResponse{Orders: orders}, nil
+}
+
+func TestExportAccountData(t *testing.T) {
+	s := NewAccountService(NewMemoryRepository())
+	ctx := context.Background()
+	a, err := s.PostAccount(ctx, "Alice", "alice@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := s.PostAddress(ctx, Address{AccountID: a.ID, Recipient: "Alice", Line1: "1 Main St", City: "Springfield", Country: "US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	createdAtBinary, _ := createdAt.MarshalBinary()
+	orders := &orderClient{orders: []*orderpb.Order{{
+		Id:         "order-1",
+		AccountId:  a.ID,
+		CreatedAt:  createdAtBinary,
+		TotalPrice: &orderpb.OrderMoney{Amount: 3998, Currency: "USD"},
+		Products: []*orderpb.Order_OrderProduct{{
+			Id:       "shirt",
+			Name:     "Shirt",
+			Price:    &orderpb.OrderMoney{Amount: 1999, Currency: "USD"},
+			Quantity: 2,
+		}},
+	}, {
+		Id:        "order-of-someone-else",
+		AccountId: "bob",
+	}}}
+	server := &grpcServer{service: s, orders: orders}
+
+	response, err := server.ExportAccountData(ctx, &pb.ExportAccountDataRequest{Id: a.ID})
+	if err != nil {
+		t.Fatalf("ExportAccountData: %v", err)
+	}
+	export := AccountExport{}
+	if err = json.Unmarshal(response.Document, &export); err != nil {
+		t.Fatalf("export is not JSON: %v", err)
+	}
+	if export.Account.ID != a.ID || export.Account.Email != "alice@example.com" {
+		t.Errorf("exported account = %+v, want %+v", export.Account, a)
+	}
+	if len(export.Addresses) != 1 || export.Addresses[0].ID != address.ID {
+		t.Errorf("exported addresses = %+v, want %+v", export.Addresses, address)
+	}
+	if len(export.Orders) != 1 {
+		t.Fatalf("exported %d orders, want 1", len(export.Orders))
+	}
+	o := export.Orders[0]
+	if o.ID != "order-1" || !o.CreatedAt.Equal(createdAt) || o.TotalPrice != (money.Money{Amount: 3998, Currency: "USD"}) {
+		t.Errorf("exported order = %+v", o)
+	}
+	want := ExportedOrderProduct{ID: "shirt", Name: "Shirt", Price: money.Money{Amount: 1999, Currency: "USD"}, Quantity: 2}
+	if len(o.Products) != 1 || o.Products[0] != want {
+		t.Errorf("exported order products = %+v, want [%+v]", o.Products, want)
+	}
+
+	// Without its orders the export would be incomplete, so it fails.
+	orders.err = errs.New(errs.Unavailable, "order database is unavailable")
+	response, err = server.ExportAccountData(ctx, &pb.ExportAccountDataRequest{Id: a.ID})
+	if !errors.Is(err, orders.err) || response != nil {
+		t.Errorf("ExportAccountData with the order service down = %v, %v, want its error", response, err)
+	}
+}
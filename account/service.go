@@ -2,45 +2,385 @@ package account
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
 	"github.com/segmentio/ksuid"
+	"golang.org/x/crypto/bcrypt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
+var (
+	ErrNotFound           = errs.New(errs.NotFound, "account not found")
+	ErrAddressNotFound    = errs.New(errs.NotFound, "address not found")
+	ErrEmailTaken         = errs.New(errs.AlreadyExists, "email is already in use")
+	ErrInvalidCredentials = errs.New(errs.Unauthenticated, "invalid email or password")
+	ErrInvalidCursor      = errs.New(errs.InvalidArgument, "invalid cursor")
+	ErrInvalidAccount     = errs.New(errs.InvalidArgument, "account needs a name of at most 24 characters, an email and a password of at most 72 bytes")
+	ErrInvalidAddress     = errs.New(errs.InvalidArgument, "address needs a recipient, first line, city and two-letter country code")
+	ErrInvalidTransition  = errs.New(errs.FailedPrecondition, "account status does not allow this transition")
+	ErrAccountInactive    = errs.New(errs.FailedPrecondition, "account is not active")
+)
+
+// Account statuses. Active accounts can be suspended and reactivated; both
+// can be closed, which is final.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+	StatusClosed    = "closed"
+)
+
+// transitions lists, for each target status, the statuses it can be reached
+// from.
+var transitions = map[string][]string{
+	StatusActive:    {StatusSuspended},
+	StatusSuspended: {StatusActive},
+	StatusClosed:    {StatusActive, StatusSuspended},
+}
+
 type Service interface {
-	PostAccount(ctx context.Context, name string) (Account, error)
+	PostAccount(ctx context.Context, name, email, password string) (Account, error)
 	GetAccount(ctx context.Context, id string) (Account, error)
-	GetAccounts(ctx context.Context, skip uint64, take uint64) (*[]Account, error)
+	GetAccounts(ctx context.Context, cursor string, take uint64) (*[]Account, string, error)
+	SearchAccounts(ctx context.Context, query string, cursor string, take uint64) (*[]Account, string, error)
+	Authenticate(ctx context.Context, email, password string) (Account, error)
+	UpdateAccount(ctx context.Context, id string, name string) (Account, error)
+	DeleteAccount(ctx context.Context, id string) error
+	PostAddress(ctx context.Context, address Address) (Address, error)
+	GetAddresses(ctx context.Context, accountID string) (*[]Address, error)
+	UpdateAddress(ctx context.Context, address Address) (Address, error)
+	DeleteAddress(ctx context.Context, accountID string, id string) error
+	SuspendAccount(ctx context.Context, id string) (Account, error)
+	ReactivateAccount(ctx context.Context, id string) (Account, error)
+	CloseAccount(ctx context.Context, id string) (Account, error)
+	ImportAccounts(ctx context.Context, rows []AccountImport) ([]ImportResult, error)
+	EraseAccount(ctx context.Context, id string) (Account, error)
+	ListAccountAudit(ctx context.Context, accountID string, cursor string, take uint64) (*[]AuditEntry, string, error)
+	CreateAPIKey(ctx context.Context, accountID string, name string) (APIKey, string, error)
+	ListAPIKeys(ctx context.Context, accountID string) (*[]APIKey, error)
+	RevokeAPIKey(ctx context.Context, accountID string, id string) error
+	AuthenticateAPIKey(ctx context.Context, key string) (Account, error)
 }
 
 type Account struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Role         string `json:"role"`
+	Status       string `json:"status"`
+	PasswordHash string `json:"-"`
+}
+
+// Address is a shipping or billing address owned by an account. Each account
+// has at most one default shipping and one default billing address.
+type Address struct {
+	ID              string `json:"id"`
+	AccountID       string `json:"accountId"`
+	Recipient       string `json:"recipient"`
+	Line1           string `json:"line1"`
+	Line2           string `json:"line2"`
+	City            string `json:"city"`
+	Region          string `json:"region"`
+	PostalCode      string `json:"postalCode"`
+	Country         string `json:"country"`
+	DefaultShipping bool   `json:"defaultShipping"`
+	DefaultBilling  bool   `json:"defaultBilling"`
+}
+
+func (a Address) validate() error {
+	if strings.TrimSpace(a.Recipient) == "" ||
+		strings.TrimSpace(a.Line1) == "" ||
+		strings.TrimSpace(a.City) == "" ||
+		len(a.Country) != 2 {
+		return ErrInvalidAddress
+	}
+	return nil
+}
+
+// AccountImport is one row of a bulk import.
+type AccountImport struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// ImportResult is the outcome of one imported row. Row is the row's 1-based
+// position in the import, and Err says why the row was not imported.
+type ImportResult struct {
+	Row     int
+	Account Account
+	Err     error
+}
+
+// validateAccount checks the fields of a new account. bcrypt ignores
+// anything past 72 bytes of a password, so longer ones are refused rather
+// than silently cut short.
+func validateAccount(name, email, password string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if !strings.Contains(email, "@") || password == "" || len(password) > 72 {
+		return ErrInvalidAccount
+	}
+	return nil
+}
+
+// validateName checks an account name, which has to fit the name column.
+func validateName(name string) error {
+	if n := utf8.RuneCountInString(strings.TrimSpace(name)); n == 0 || n > 24 {
+		return ErrInvalidAccount
+	}
+	return nil
 }
 
 type service struct {
 	repository Repository
 }
 
-func (s *service) PostAccount(ctx context.Context, name string) (Account, error) {
-	a := Account{
-		Name: name,
-		ID:   ksuid.New().String(),
+// dummyHash is compared against when no account matches the email, so that
+// unknown and known emails take roughly the same time to reject.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
 	}
-	err := s.repository.PutAccount(ctx, a)
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	id, err := ksuid.Parse(string(b))
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return id.String(), nil
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// newAccount validates the input and builds an active customer account
+// from it.
+func newAccount(name, email, password string) (Account, error) {
+	if err := validateAccount(name, email, password); err != nil {
+		return Account{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return Account{}, err
+	}
+	return Account{
+		Name:         name,
+		ID:           ksuid.New().String(),
+		Email:        normalizeEmail(email),
+		Role:         authz.RoleCustomer,
+		Status:       StatusActive,
+		PasswordHash: string(hash),
+	}, nil
+}
+
+func (s *service) PostAccount(ctx context.Context, name, email, password string) (Account, error) {
+	a, err := newAccount(name, email, password)
+	if err != nil {
+		return Account{}, err
+	}
+	err = s.repository.PutAccount(ctx, a)
 	if err != nil {
 		return Account{}, err
 	}
 	return a, nil
 }
 
+// ImportAccounts creates an account for every valid row and stores them in
+// one transaction. Rows that are invalid or whose email is taken are
+// reported in their result instead of failing the import; an error means
+// none of the rows were stored.
+func (s *service) ImportAccounts(ctx context.Context, rows []AccountImport) ([]ImportResult, error) {
+	results := make([]ImportResult, len(rows))
+	accounts := make([]Account, len(rows))
+
+	// Hashing dominates the cost of an import, so spread it over the CPUs.
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i, row := range rows {
+		results[i].Row = i + 1
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			accounts[i], results[i].Err = newAccount(row.Name, row.Email, row.Password)
+		}()
+	}
+	wg.Wait()
+
+	valid := []Account{}
+	positions := []int{}
+	for i := range rows {
+		if results[i].Err == nil {
+			valid = append(valid, accounts[i])
+			positions = append(positions, i)
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	rowErrs, err := s.repository.PutAccounts(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		if rowErrs[j] != nil {
+			results[i].Err = rowErrs[j]
+			continue
+		}
+		a := accounts[i]
+		a.PasswordHash = ""
+		results[i].Account = a
+	}
+	return results, nil
+}
+
 func (s *service) GetAccount(ctx context.Context, id string) (Account, error) {
 	return s.repository.GetAccountByID(ctx, id)
 }
 
-func (s *service) GetAccounts(ctx context.Context, skip uint64, take uint64) (*[]Account, error) {
-	if take > 100 || (skip == 0 && take == 0) {
+// GetAccounts returns a page of accounts and the cursor of the next page,
+// which is empty once the last page has been reached.
+func (s *service) GetAccounts(ctx context.Context, cursor string, take uint64) (*[]Account, string, error) {
+	return paginate(cursor, take, func(a Account) string { return a.ID }, func(after string, limit uint64) (*[]Account, error) {
+		return s.repository.ListAccounts(ctx, after, limit)
+	})
+}
+
+// SearchAccounts pages through the accounts whose name contains query,
+// ignoring case.
+func (s *service) SearchAccounts(ctx context.Context, query string, cursor string, take uint64) (*[]Account, string, error) {
+	return paginate(cursor, take, func(a Account) string { return a.ID }, func(after string, limit uint64) (*[]Account, error) {
+		return s.repository.SearchAccounts(ctx, query, after, limit)
+	})
+}
+
+// paginate fetches the page after cursor with list and returns it with the
+// cursor of the next page. list returns the items following the one whose
+// KSUID, as returned by id, is after.
+func paginate[T any](
+	cursor string,
+	take uint64,
+	id func(T) string,
+	list func(after string, limit uint64) (*[]T, error),
+) (*[]T, string, error) {
+	if take > 100 || take == 0 {
 		take = 100
 	}
-	return s.repository.ListAccounts(ctx, skip, take)
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	// Fetch one extra row to find out whether another page follows.
+	items, err := list(after, take+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if uint64(len(*items)) <= take {
+		return items, "", nil
+	}
+	page := (*items)[:take]
+	return &page, encodeCursor(id(page[len(page)-1])), nil
+}
+
+func (s *service) Authenticate(ctx context.Context, email, password string) (Account, error) {
+	a, err := s.repository.GetAccountByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, ErrNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return Account{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Account{}, err
+	}
+	if err = bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)); err != nil {
+		return Account{}, ErrInvalidCredentials
+	}
+	// The status is only revealed to a caller who knows the password.
+	if a.Status != StatusActive {
+		return Account{}, ErrAccountInactive
+	}
+	return a, nil
+}
+
+func (s *service) UpdateAccount(ctx context.Context, id string, name string) (Account, error) {
+	if err := validateName(name); err != nil {
+		return Account{}, err
+	}
+	return s.repository.UpdateAccount(ctx, id, name)
+}
+
+func (s *service) DeleteAccount(ctx context.Context, id string) error {
+	return s.repository.DeleteAccount(ctx, id)
+}
+
+func (s *service) PostAddress(ctx context.Context, address Address) (Address, error) {
+	if err := address.validate(); err != nil {
+		return Address{}, err
+	}
+	if _, err := s.repository.GetAccountByID(ctx, address.AccountID); err != nil {
+		return Address{}, err
+	}
+	address.ID = ksuid.New().String()
+	address.Country = strings.ToUpper(address.Country)
+	if err := s.repository.PutAddress(ctx, address); err != nil {
+		return Address{}, err
+	}
+	return address, nil
+}
+
+func (s *service) GetAddresses(ctx context.Context, accountID string) (*[]Address, error) {
+	return s.repository.ListAddresses(ctx, accountID)
+}
+
+func (s *service) UpdateAddress(ctx context.Context, address Address) (Address, error) {
+	if err := address.validate(); err != nil {
+		return Address{}, err
+	}
+	address.Country = strings.ToUpper(address.Country)
+	return s.repository.UpdateAddress(ctx, address)
+}
+
+func (s *service) DeleteAddress(ctx context.Context, accountID string, id string) error {
+	return s.repository.DeleteAddress(ctx, accountID, id)
+}
+
+func (s *service) SuspendAccount(ctx context.Context, id string) (Account, error) {
+	return s.transition(ctx, id, StatusSuspended)
+}
+
+func (s *service) ReactivateAccount(ctx context.Context, id string) (Account, error) {
+	return s.transition(ctx, id, StatusActive)
+}
+
+func (s *service) CloseAccount(ctx context.Context, id string) (Account, error) {
+	return s.transition(ctx, id, StatusClosed)
+}
+
+func (s *service) transition(ctx context.Context, id string, to string) (Account, error) {
+	a, err := s.repository.GetAccountByID(ctx, id)
+	if err != nil {
+		return Account{}, err
+	}
+	if !slices.Contains(transitions[to], a.Status) {
+		return Account{}, ErrInvalidTransition
+	}
+	return s.repository.UpdateAccountStatus(ctx, id, a.Status, to)
 }
 
 func NewAccountService(repository Repository) Service {
@@ -0,0 +1,198 @@
+package account_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+)
+
+func TestPostAccountValidates(t *testing.T) {
+	s := account.NewAccountService(account.NewMemoryRepository())
+	ctx := context.Background()
+	for _, tc := range []struct {
+		desc                  string
+		name, email, password string
+		valid                 bool
+	}{
+		{"valid", "Alice", "alice@example.com", "secret", true},
+		{"longest name", strings.Repeat("é", 24), "long@example.com", "secret", true},
+		{"longest password", "Bob", "bob@example.com", strings.Repeat("p", 72), true},
+		{"no name", "  ", "nameless@example.com", "secret", false},
+		{"long name", strings.Repeat("é", 25), "longer@example.com", "secret", false},
+		{"no email", "Carol", "", "secret", false},
+		{"email without @", "Carol", "carol.example.com", "secret", false},
+		{"no password", "Dave", "dave@example.com", "", false},
+		{"long password", "Dave", "dave@example.com", strings.Repeat("p", 73), false},
+	} {
+		_, err := s.PostAccount(ctx, tc.name, tc.email, tc.password)
+		if tc.valid && err != nil {
+			t.Errorf("%s: PostAccount: %v", tc.desc, err)
+		}
+		if !tc.valid && !errors.Is(err, account.ErrInvalidAccount) {
+			t.Errorf("%s: PostAccount error = %v, want account.ErrInvalidAccount", tc.desc, err)
+		}
+	}
+}
+
+func TestUpdateAccountValidates(t *testing.T) {
+	s := account.NewAccountService(account.NewMemoryRepository())
+	ctx := context.Background()
+	a, err := s.PostAccount(ctx, "Alice", "alice@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		desc  string
+		name  string
+		valid bool
+	}{
+		{"valid", "Alicia", true},
+		{"longest name", strings.Repeat("é", 24), true},
+		{"no name", "", false},
+		{"blank name", "  ", false},
+		{"long name", strings.Repeat("é", 25), false},
+	} {
+		_, err := s.UpdateAccount(ctx, a.ID, tc.name)
+		if tc.valid && err != nil {
+			t.Errorf("%s: UpdateAccount: %v", tc.desc, err)
+		}
+		if !tc.valid && !errors.Is(err, account.ErrInvalidAccount) {
+			t.Errorf("%s: UpdateAccount error = %v, want account.ErrInvalidAccount", tc.desc, err)
+		}
+	}
+	got, err := s.GetAccount(ctx, a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != strings.Repeat("é", 24) {
+		t.Errorf("name after the rejected updates = %q, want the last valid one", got.Name)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := account.NewAccountService(account.NewMemoryRepository())
+	ctx := context.Background()
+	a, err := s.PostAccount(ctx, "Alice", " Alice@Example.com ", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Authenticate(ctx, "ALICE@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got.ID != a.ID {
+		t.Errorf("Authenticate returned account %s, want %s", got.ID, a.ID)
+	}
+	if _, err := s.Authenticate(ctx, "alice@example.com", "wrong"); !errors.Is(err, account.ErrInvalidCredentials) {
+		t.Errorf("Authenticate with a wrong password error = %v, want account.ErrInvalidCredentials", err)
+	}
+	if _, err := s.Authenticate(ctx, "nobody@example.com", "secret"); !errors.Is(err, account.ErrInvalidCredentials) {
+		t.Errorf("Authenticate of an unknown email error = %v, want account.ErrInvalidCredentials", err)
+	}
+
+	if _, err := s.SuspendAccount(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authenticate(ctx, "alice@example.com", "secret"); !errors.Is(err, account.ErrAccountInactive) {
+		t.Errorf("Authenticate of a suspended account error = %v, want account.ErrAccountInactive", err)
+	}
+}
+
+func TestImportAccounts(t *testing.T) {
+	s := account.NewAccountService(account.NewMemoryRepository())
+	ctx := context.Background()
+	if _, err := s.PostAccount(ctx, "Existing", "existing@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.ImportAccounts(ctx, []account.AccountImport{
+		{Name: "Alice", Email: "Alice@Example.com", Password: "secret"},
+		{Name: "", Email: "nameless@example.com", Password: "secret"},
+		{Name: "Again", Email: "EXISTING@example.com", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatalf("ImportAccounts: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("ImportAccounts returned %d results, want 3", len(results))
+	}
+	for i, r := range results {
+		if r.Row != i+1 {
+			t.Errorf("result %d has row %d", i, r.Row)
+		}
+	}
+	if results[0].Err != nil || results[0].Account.Email != "alice@example.com" || results[0].Account.PasswordHash != "" {
+		t.Errorf("row 1 = %+v, want an imported account", results[0])
+	}
+	if !errors.Is(results[1].Err, account.ErrInvalidAccount) {
+		t.Errorf("row 2 error = %v, want account.ErrInvalidAccount", results[1].Err)
+	}
+	if !errors.Is(results[2].Err, account.ErrEmailTaken) {
+		t.Errorf("row 3 error = %v, want account.ErrEmailTaken", results[2].Err)
+	}
+
+	if _, err = s.Authenticate(ctx, "alice@example.com", "secret"); err != nil {
+		t.Errorf("Authenticate as an imported account: %v", err)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := account.NewAccountService(account.NewMemoryRepository())
+	ctx := context.Background()
+	a, err := s.PostAccount(ctx, "Partner", "partner@example.com", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := s.CreateAPIKey(ctx, a.ID, " "); !errors.Is(err, account.ErrInvalidAPIKeyName) {
+		t.Errorf("CreateAPIKey without a name error = %v, want account.ErrInvalidAPIKeyName", err)
+	}
+	apiKey, key, err := s.CreateAPIKey(ctx, a.ID, "Warehouse sync")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if apiKey.Hash != "" || !strings.HasPrefix(key, apiKey.Prefix) || len(key) <= len(apiKey.Prefix) {
+		t.Errorf("CreateAPIKey = %+v, %q, want a key starting with the prefix and no hash", apiKey, key)
+	}
+
+	got, err := s.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey: %v", err)
+	}
+	if got.ID != a.ID {
+		t.Errorf("AuthenticateAPIKey = %+v, want account %s", got, a.ID)
+	}
+	for _, bad := range []string{"", key + "x", "Bearer " + key} {
+		if _, err := s.AuthenticateAPIKey(ctx, bad); !errors.Is(err, account.ErrInvalidAPIKey) {
+			t.Errorf("AuthenticateAPIKey(%q) error = %v, want account.ErrInvalidAPIKey", bad, err)
+		}
+	}
+
+	if err := s.RevokeAPIKey(ctx, a.ID, apiKey.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, key); !errors.Is(err, account.ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey after revoking error = %v, want account.ErrInvalidAPIKey", err)
+	}
+
+	_, key, err = s.CreateAPIKey(ctx, a.ID, "ci")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if _, err := s.SuspendAccount(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, key); !errors.Is(err, account.ErrInvalidAPIKey) {
+		t.Errorf("AuthenticateAPIKey of a suspended account error = %v, want account.ErrInvalidAPIKey", err)
+	}
+	if _, err := s.ReactivateAccount(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AuthenticateAPIKey(ctx, key); err != nil {
+		t.Errorf("AuthenticateAPIKey after reactivating: %v", err)
+	}
+}
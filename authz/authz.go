@@ -0,0 +1,272 @@
+// Package authz carries the caller's identity between services in gRPC
+// metadata and enforces per-method authorization policies on the servers.
+//
+// The GraphQL gateway is the only component that authenticates end users.
+// The identity it forwards is signed with a Key shared by the gateway and
+// the services, and the servers refuse identities whose signature does not
+// verify, so a caller that can reach a service but does not hold the key
+// cannot claim to be someone else.
+package authz
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleCustomer = "customer"
+	// RoleService is held by services calling each other on their own
+	// behalf, never by accounts.
+	RoleService = "service"
+)
+
+const (
+	accountIDKey = "x-account-id"
+	rolesKey     = "x-roles"
+	issuedAtKey  = "x-identity-issued-at"
+	signatureKey = "x-identity-signature"
+)
+
+// maxIdentityAge is how long a signed identity is accepted after it was
+// signed, give or take, so one seen on the wire cannot be replayed for long.
+const maxIdentityAge = time.Minute
+
+// minKeyLength is the shortest Key accepted, the size of an HMAC-SHA256
+// output.
+const minKeyLength = 32
+
+// Key signs the identities that clients forward and verifies them on the
+// servers, with HMAC-SHA256.
+type Key []byte
+
+// ParseKey returns the key of secret, which must be at least 32 bytes long.
+func ParseKey(secret string) (Key, error) {
+	if len(secret) < minKeyLength {
+		return nil, fmt.Errorf("identity key is %d bytes long, want at least %d", len(secret), minKeyLength)
+	}
+	return Key(secret), nil
+}
+
+// Decode lets envconfig read a Key with ParseKey.
+func (k *Key) Decode(value string) error {
+	key, err := ParseKey(value)
+	if err != nil {
+		return err
+	}
+	*k = key
+	return nil
+}
+
+func (k Key) sign(accountID, roles, issuedAt string) string {
+	mac := hmac.New(sha256.New, k)
+	mac.Write([]byte(accountID + "\n" + roles + "\n" + issuedAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Identity is the account on whose behalf a call is made. The zero value is
+// an anonymous caller.
+type Identity struct {
+	AccountID string
+	Roles     []string
+}
+
+func (id Identity) Authenticated() bool {
+	return id.AccountID != ""
+}
+
+func (id Identity) HasRole(role string) bool {
+	return slices.Contains(id.Roles, role)
+}
+
+// ServiceIdentity is the identity of the named service, for calls it makes
+// on its own behalf rather than its caller's.
+func ServiceIdentity(name string) Identity {
+	return Identity{AccountID: "service:" + name, Roles: []string{RoleService}}
+}
+
+type identityContextKey struct{}
+
+// ContextWithIdentity attaches id to ctx. Clients built with
+// UnaryClientInterceptor forward it to the services they call.
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, id)
+}
+
+// IdentityFromContext returns the identity attached to ctx, either by
+// ContextWithIdentity or by the server interceptors.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityContextKey{}).(Identity)
+	return id, ok && id.Authenticated()
+}
+
+// identityFromMetadata returns the identity in the metadata of ctx, or the
+// anonymous identity if there is none. An identity that is not signed with
+// key, or was signed too long ago, is an error.
+func identityFromMetadata(ctx context.Context, key Key) (Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	accountID, roles := firstValue(md, accountIDKey), firstValue(md, rolesKey)
+	if accountID == "" {
+		return Identity{}, nil
+	}
+	issuedAt := firstValue(md, issuedAtKey)
+	signature := firstValue(md, signatureKey)
+	if !hmac.Equal([]byte(signature), []byte(key.sign(accountID, roles, issuedAt))) {
+		return Identity{}, errInvalidIdentity()
+	}
+	seconds, err := strconv.ParseInt(issuedAt, 10, 64)
+	if err != nil {
+		return Identity{}, errInvalidIdentity()
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > maxIdentityAge || age < -maxIdentityAge {
+		return Identity{}, errInvalidIdentity()
+	}
+
+	id := Identity{AccountID: accountID}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			id.Roles = append(id.Roles, role)
+		}
+	}
+	return id, nil
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func outgoingContext(ctx context.Context, key Key) context.Context {
+	id, ok := IdentityFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	roles := strings.Join(id.Roles, ",")
+	issuedAt := strconv.FormatInt(time.Now().Unix(), 10)
+	return metadata.AppendToOutgoingContext(
+		ctx,
+		accountIDKey, id.AccountID,
+		rolesKey, roles,
+		issuedAtKey, issuedAt,
+		signatureKey, key.sign(id.AccountID, roles, issuedAt),
+	)
+}
+
+// UnaryClientInterceptor sends the identity attached to the call's context
+// along as metadata, signed with key.
+func UnaryClientInterceptor(key Key) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return invoker(outgoingContext(ctx, key), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of
+// UnaryClientInterceptor.
+func StreamClientInterceptor(key Key) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(outgoingContext(ctx, key), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor reads the caller's identity from metadata, verifies
+// its signature with key, checks it against the policy of the called method
+// and makes it available to the handler through IdentityFromContext.
+func UnaryServerInterceptor(key Key, policy Policy) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		id, err := identityFromMetadata(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.check(info.FullMethod, id, req); err != nil {
+			return nil, err
+		}
+		return handler(ContextWithIdentity(ctx, id), req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor. Stream rules are checked without a request, so
+// Owner rules deny every call to a stream.
+func StreamServerInterceptor(key Key, policy Policy) grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx := ss.Context()
+		id, err := identityFromMetadata(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := policy.check(info.FullMethod, id, nil); err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ContextWithIdentity(ctx, id)})
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+// AuthorizeOwner checks, from inside a handler, that the caller owns the
+// account or is an admin. Use it when ownership is only known after loading
+// the resource.
+func AuthorizeOwner(ctx context.Context, accountID string) error {
+	id, ok := IdentityFromContext(ctx)
+	if !ok {
+		return errUnauthenticated()
+	}
+	return authorizeOwner(id, accountID)
+}
+
+func errUnauthenticated() error {
+	return status.Error(codes.Unauthenticated, "authentication required")
+}
+
+func errInvalidIdentity() error {
+	return status.Error(codes.Unauthenticated, "forwarded identity is not validly signed")
+}
+
+func errPermissionDenied() error {
+	return status.Error(codes.PermissionDenied, "permission denied")
+}
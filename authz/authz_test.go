@@ -0,0 +1,161 @@
+package authz
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testKey = Key("0123456789abcdef0123456789abcdef")
+
+type ownedRequest struct {
+	accountID string
+}
+
+// signed returns the metadata of an identity signed with key at issuedAt.
+func signed(key Key, accountID, roles string, issuedAt time.Time) metadata.MD {
+	at := strconv.FormatInt(issuedAt.Unix(), 10)
+	return metadata.Pairs(
+		accountIDKey, accountID,
+		rolesKey, roles,
+		issuedAtKey, at,
+		signatureKey, key.sign(accountID, roles, at),
+	)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	policy := Policy{
+		"/test/Public":  Public(),
+		"/test/Admin":   RequireRole(RoleAdmin),
+		"/test/Owner":   Owner(func(req any) string { return req.(ownedRequest).accountID }),
+		"/test/Anybody": Authenticated(),
+	}
+	interceptor := UnaryServerInterceptor(testKey, policy)
+
+	now := time.Now()
+	anonymous := metadata.MD{}
+	customer := signed(testKey, "alice", RoleCustomer, now)
+	admin := signed(testKey, "root", "customer, admin", now)
+	unsigned := metadata.Pairs(accountIDKey, "root", rolesKey, RoleAdmin)
+	otherKey := signed(Key("fedcba9876543210fedcba9876543210"), "root", RoleAdmin, now)
+	stale := signed(testKey, "root", RoleAdmin, now.Add(-2*maxIdentityAge))
+	promoted := signed(testKey, "alice", RoleCustomer, now)
+	promoted.Set(rolesKey, RoleAdmin)
+
+	for _, tc := range []struct {
+		method string
+		md     metadata.MD
+		req    any
+		want   codes.Code
+	}{
+		{"/test/Public", anonymous, nil, codes.OK},
+		{"/test/Anybody", anonymous, nil, codes.Unauthenticated},
+		{"/test/Anybody", customer, nil, codes.OK},
+		{"/test/Admin", customer, nil, codes.PermissionDenied},
+		{"/test/Admin", admin, nil, codes.OK},
+		{"/test/Owner", customer, ownedRequest{"alice"}, codes.OK},
+		{"/test/Owner", customer, ownedRequest{"bob"}, codes.PermissionDenied},
+		{"/test/Owner", admin, ownedRequest{"bob"}, codes.OK},
+		{"/test/Missing", admin, nil, codes.PermissionDenied},
+		{"/test/Public", unsigned, nil, codes.Unauthenticated},
+		{"/test/Admin", unsigned, nil, codes.Unauthenticated},
+		{"/test/Admin", otherKey, nil, codes.Unauthenticated},
+		{"/test/Admin", stale, nil, codes.Unauthenticated},
+		{"/test/Admin", promoted, nil, codes.Unauthenticated},
+	} {
+		ctx := metadata.NewIncomingContext(context.Background(), tc.md)
+		var seen Identity
+		_, err := interceptor(ctx, tc.req, &grpc.UnaryServerInfo{FullMethod: tc.method}, func(ctx context.Context, req any) (any, error) {
+			seen, _ = IdentityFromContext(ctx)
+			return nil, nil
+		})
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s with %v: got %v, want %v", tc.method, tc.md, got, tc.want)
+		}
+		if err == nil && tc.md.Len() > 0 && seen.AccountID != tc.md.Get(accountIDKey)[0] {
+			t.Errorf("%s: handler saw identity %+v", tc.method, seen)
+		}
+	}
+}
+
+// serverStream is a grpc.ServerStream with nothing but a context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	policy := Policy{
+		"/test/Admin": RequireRole(RoleAdmin),
+		"/test/Owner": Owner(func(req any) string { return req.(ownedRequest).accountID }),
+	}
+	interceptor := StreamServerInterceptor(testKey, policy)
+
+	now := time.Now()
+	customer := signed(testKey, "alice", RoleCustomer, now)
+	admin := signed(testKey, "root", RoleAdmin, now)
+	for _, tc := range []struct {
+		method string
+		md     metadata.MD
+		want   codes.Code
+	}{
+		{"/test/Admin", customer, codes.PermissionDenied},
+		{"/test/Admin", admin, codes.OK},
+		// Owner rules need a request, which streams are checked without.
+		{"/test/Owner", customer, codes.PermissionDenied},
+		{"/test/Owner", admin, codes.PermissionDenied},
+	} {
+		ss := serverStream{ctx: metadata.NewIncomingContext(context.Background(), tc.md)}
+		var seen Identity
+		err := interceptor(nil, ss, &grpc.StreamServerInfo{FullMethod: tc.method}, func(srv any, ss grpc.ServerStream) error {
+			seen, _ = IdentityFromContext(ss.Context())
+			return nil
+		})
+		if got := status.Code(err); got != tc.want {
+			t.Errorf("%s with %v: got %v, want %v", tc.method, tc.md, got, tc.want)
+		}
+		if err == nil && seen.AccountID != tc.md.Get(accountIDKey)[0] {
+			t.Errorf("%s: handler saw identity %+v", tc.method, seen)
+		}
+	}
+}
+
+func TestClientInterceptorForwardsIdentity(t *testing.T) {
+	ctx := ContextWithIdentity(context.Background(), Identity{AccountID: "alice", Roles: []string{RoleCustomer, RoleAdmin}})
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := UnaryClientInterceptor(testKey)(ctx, "/test/Call", nil, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := identityFromMetadata(metadata.NewIncomingContext(context.Background(), md), testKey)
+	if err != nil {
+		t.Fatalf("identityFromMetadata: %v", err)
+	}
+	if id.AccountID != "alice" || !id.HasRole(RoleCustomer) || !id.HasRole(RoleAdmin) {
+		t.Errorf("forwarded identity = %+v", id)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey("change-me"); err == nil {
+		t.Errorf("ParseKey accepted a 9-byte key")
+	}
+	key, err := ParseKey(string(testKey))
+	if err != nil || string(key) != string(testKey) {
+		t.Errorf("ParseKey = %q, %v, want the key", key, err)
+	}
+}
@@ -0,0 +1,83 @@
+package authz
+
+import (
+	"log"
+	"strings"
+)
+
+// Rule decides whether id may make a call with the given request.
+type Rule func(id Identity, req any) error
+
+// Policy maps full gRPC method names, such as
+// pb.AccountService_GetAccount_FullMethodName, to the rule guarding them.
+// Methods missing from the policy are denied.
+type Policy map[string]Rule
+
+func (p Policy) check(method string, id Identity, req any) error {
+	// Server reflection only describes the API, leave it open for tooling.
+	if strings.HasPrefix(method, "/grpc.reflection.") {
+		return nil
+	}
+	rule, ok := p[method]
+	if !ok {
+		log.Println("no authorization rule for", method)
+		return errPermissionDenied()
+	}
+	return rule(id, req)
+}
+
+// Public allows every caller, authenticated or not.
+func Public() Rule {
+	return func(Identity, any) error {
+		return nil
+	}
+}
+
+// Authenticated allows any authenticated caller.
+func Authenticated() Rule {
+	return func(id Identity, _ any) error {
+		if !id.Authenticated() {
+			return errUnauthenticated()
+		}
+		return nil
+	}
+}
+
+// RequireRole allows authenticated callers holding at least one of roles.
+func RequireRole(roles ...string) Rule {
+	return func(id Identity, _ any) error {
+		if !id.Authenticated() {
+			return errUnauthenticated()
+		}
+		for _, role := range roles {
+			if id.HasRole(role) {
+				return nil
+			}
+		}
+		return errPermissionDenied()
+	}
+}
+
+// Owner allows the account that accountID extracts from the request, and
+// admins. Streaming methods are checked without a request, so Owner denies
+// every call to them rather than handing accountID a nil request.
+func Owner(accountID func(req any) string) Rule {
+	return func(id Identity, req any) error {
+		if req == nil {
+			log.Println("owner rule checked without a request, such as on a stream")
+			return errPermissionDenied()
+		}
+		if !id.Authenticated() {
+			return errUnauthenticated()
+		}
+		return authorizeOwner(id, accountID(req))
+	}
+}
+
+// authorizeOwner allows the account accountID and admins.
+func authorizeOwner(id Identity, accountID string) error {
+	if id.HasRole(RoleAdmin) || id.AccountID == accountID {
+		return nil
+	}
+	return errPermissionDenied()
+}
@@ -0,0 +1,554 @@
+// Package catalogtest provides a conformance suite that every
+// catalog.Repository implementation must pass.
+package catalogtest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"github.com/segmentio/ksuid"
+)
+
+// TestRepository runs the conformance suite. newRepository must return an
+// empty repository on every call, and writes must be visible to reads as soon
+// as they return.
+func TestRepository(t *testing.T, newRepository func(t *testing.T) catalog.Repository) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		p := newProduct("Red shirt", "Cotton shirt", usd(1999))
+		p.Category = "Clothing/Shirts"
+		p.Tags = []string{"cotton", "red"}
+		if err := r.PutProduct(ctx, p); err != nil {
+			t.Fatalf("PutProduct: %v", err)
+		}
+		got, err := r.GetProductByID(ctx, p.Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+		if got.Version == "" {
+			t.Errorf("GetProductByID returned no version")
+		}
+		got.Version = ""
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("GetProductByID = %+v, want %+v", got, p)
+		}
+	})
+
+	t.Run("UpdateChecksVersion", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		p := putProducts(t, r, 1)[0]
+		stored, err := r.GetProductByID(ctx, p.Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+
+		first := stored
+		first.Price = usd(4200)
+		updated, err := r.UpdateProduct(ctx, first)
+		if err != nil {
+			t.Fatalf("UpdateProduct: %v", err)
+		}
+		if updated.Price != usd(4200) || updated.Version == "" || updated.Version == stored.Version {
+			t.Errorf("UpdateProduct = %+v, want the new price under a new version", updated)
+		}
+
+		// A second writer that read the same version loses.
+		second := stored
+		second.Name = "Renamed"
+		if _, err := r.UpdateProduct(ctx, second); !errors.Is(err, catalog.ErrVersionConflict) {
+			t.Errorf("UpdateProduct at a stale version error = %v, want catalog.ErrVersionConflict", err)
+		}
+		got, err := r.GetProductByID(ctx, p.Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+		if !reflect.DeepEqual(got, updated) {
+			t.Errorf("GetProductByID = %+v, want %+v", got, updated)
+		}
+
+		second.Version = "not a version"
+		if _, err := r.UpdateProduct(ctx, second); !errors.Is(err, catalog.ErrInvalidVersion) {
+			t.Errorf("UpdateProduct at a malformed version error = %v, want catalog.ErrInvalidVersion", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		products := putProducts(t, r, 2)
+		stored, err := r.GetProductByID(ctx, products[0].Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+		changed := stored
+		changed.Price.Amount++
+		if _, err = r.UpdateProduct(ctx, changed); err != nil {
+			t.Fatalf("UpdateProduct: %v", err)
+		}
+		if err := r.DeleteProduct(ctx, stored.Id, stored.Version); !errors.Is(err, catalog.ErrVersionConflict) {
+			t.Errorf("DeleteProduct at a stale version error = %v, want catalog.ErrVersionConflict", err)
+		}
+		if err := r.DeleteProduct(ctx, stored.Id, ""); err != nil {
+			t.Fatalf("DeleteProduct: %v", err)
+		}
+		if _, err := r.GetProductByID(ctx, stored.Id); !errors.Is(err, catalog.ErrNotFound) {
+			t.Errorf("GetProductByID after delete error = %v, want catalog.ErrNotFound", err)
+		}
+		if err := r.DeleteProduct(ctx, stored.Id, ""); !errors.Is(err, catalog.ErrNotFound) {
+			t.Errorf("second DeleteProduct error = %v, want catalog.ErrNotFound", err)
+		}
+
+		other, err := r.GetProductByID(ctx, products[1].Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+		if err := r.DeleteProduct(ctx, other.Id, other.Version); err != nil {
+			t.Errorf("DeleteProduct at the current version: %v", err)
+		}
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		shirt := newProduct("Shirt", "Cotton shirt", usd(2000))
+		shirt.Variants = []catalog.Variant{
+			{SKU: "SHIRT-M", Attributes: map[string]string{"size": "M", "color": "red"}, Price: usd(2000)},
+			{SKU: "SHIRT-L", Price: usd(2250)},
+		}
+		plain := putProducts(t, r, 1)[0]
+		if err := r.PutProduct(ctx, shirt); err != nil {
+			t.Fatalf("PutProduct: %v", err)
+		}
+		stored, err := r.GetProductByID(ctx, shirt.Id)
+		if err != nil {
+			t.Fatalf("GetProductByID: %v", err)
+		}
+		if !reflect.DeepEqual(stored.Variants, shirt.Variants) {
+			t.Errorf("GetProductByID returned variants %+v, want %+v", stored.Variants, shirt.Variants)
+		}
+
+		found, err := r.ListProductsWithSKUs(ctx, []string{"SHIRT-L", "MISSING", plain.Id})
+		if err != nil {
+			t.Fatalf("ListProductsWithSKUs: %v", err)
+		}
+		if got := ids(*found); !reflect.DeepEqual(got, []string{shirt.Id}) {
+			t.Errorf("ListProductsWithSKUs = %v, want [%s]", got, shirt.Id)
+		}
+
+		// Updates replace the variants, and products without any have none.
+		stored.Variants = []catalog.Variant{{SKU: "SHIRT-XL", Price: usd(2500)}}
+		if _, err := r.UpdateProduct(ctx, stored); err != nil {
+			t.Fatalf("UpdateProduct: %v", err)
+		}
+		found, err = r.ListProductsWithSKUs(ctx, []string{"SHIRT-M", "SHIRT-L"})
+		if err != nil {
+			t.Fatalf("ListProductsWithSKUs: %v", err)
+		}
+		if len(*found) != 0 {
+			t.Errorf("ListProductsWithSKUs of replaced variants = %v, want none", ids(*found))
+		}
+		products, err := r.ListProductsWithIDs(ctx, []string{shirt.Id, plain.Id})
+		if err != nil {
+			t.Fatalf("ListProductsWithIDs: %v", err)
+		}
+		for _, p := range *products {
+			want := plain.Variants
+			if p.Id == shirt.Id {
+				want = stored.Variants
+			}
+			if !reflect.DeepEqual(p.Variants, want) {
+				t.Errorf("product %s has variants %+v, want %+v", p.Id, p.Variants, want)
+			}
+		}
+	})
+
+	t.Run("PutProductsInBulk", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		mug := newProduct("Mug", "Ceramic mug", usd(800))
+		mug.Tags = []string{"kitchen"}
+		shirt := newProduct("Shirt", "Cotton shirt", usd(2000))
+		shirt.Variants = []catalog.Variant{{SKU: "BULK-SHIRT-M", Price: usd(2000)}}
+		products := []catalog.Product{mug, shirt}
+
+		productErrs, err := r.PutProducts(ctx, products)
+		if err != nil {
+			t.Fatalf("PutProducts: %v", err)
+		}
+		if len(productErrs) != len(products) {
+			t.Fatalf("PutProducts returned %d errors for %d products", len(productErrs), len(products))
+		}
+		for i, p := range products {
+			if productErrs[i] != nil {
+				t.Errorf("PutProducts of %s: %v", p.Name, productErrs[i])
+				continue
+			}
+			got, err := r.GetProductByID(ctx, p.Id)
+			if err != nil {
+				t.Fatalf("GetProductByID: %v", err)
+			}
+			got.Version = ""
+			if !reflect.DeepEqual(got, p) {
+				t.Errorf("GetProductByID = %+v, want %+v", got, p)
+			}
+		}
+		found, err := r.ListProductsWithSKUs(ctx, []string{"BULK-SHIRT-M"})
+		if err != nil {
+			t.Fatalf("ListProductsWithSKUs: %v", err)
+		}
+		if got := ids(*found); !reflect.DeepEqual(got, []string{shirt.Id}) {
+			t.Errorf("ListProductsWithSKUs = %v, want [%s]", got, shirt.Id)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		r := newRepository(t)
+		if _, err := r.GetProductByID(context.Background(), ksuid.New().String()); !errors.Is(err, catalog.ErrNotFound) {
+			t.Errorf("GetProductByID error = %v, want catalog.ErrNotFound", err)
+		}
+	})
+
+	t.Run("ListPaginates", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		want := putProducts(t, r, 5)
+
+		seen := map[string]bool{}
+		for skip := uint64(0); skip < 6; skip += 2 {
+			products, err := r.ListProducts(ctx, skip, 2)
+			if err != nil {
+				t.Fatalf("ListProducts: %v", err)
+			}
+			if wantLen := min(2, 5-int(skip)); len(*products) != wantLen {
+				t.Fatalf("ListProducts(%d, 2) returned %d products, want %d", skip, len(*products), wantLen)
+			}
+			for _, p := range *products {
+				if seen[p.Id] {
+					t.Errorf("product %s returned on more than one page", p.Id)
+				}
+				seen[p.Id] = true
+			}
+		}
+		for _, p := range want {
+			if !seen[p.Id] {
+				t.Errorf("product %s was never listed", p.Id)
+			}
+		}
+	})
+
+	t.Run("ListWithIDsSkipsMissing", func(t *testing.T) {
+		r := newRepository(t)
+		products := putProducts(t, r, 3)
+		ids := []string{products[2].Id, ksuid.New().String(), products[0].Id}
+		got, err := r.ListProductsWithIDs(context.Background(), ids)
+		if err != nil {
+			t.Fatalf("ListProductsWithIDs: %v", err)
+		}
+		gotIDs := []string{}
+		for _, p := range *got {
+			gotIDs = append(gotIDs, p.Id)
+		}
+		sort.Strings(gotIDs)
+		wantIDs := []string{products[0].Id, products[2].Id}
+		sort.Strings(wantIDs)
+		if len(gotIDs) != 2 || gotIDs[0] != wantIDs[0] || gotIDs[1] != wantIDs[1] {
+			t.Errorf("ListProductsWithIDs returned %v, want %v", gotIDs, wantIDs)
+		}
+	})
+
+	t.Run("SearchNameAndDescription", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		shirt := newProduct("Red shirt", "Cotton", usd(1000))
+		mug := newProduct("Mug", "A red ceramic mug", usd(500))
+		lamp := newProduct("Lamp", "Desk lamp", usd(3000))
+		for _, p := range []catalog.Product{shirt, mug, lamp} {
+			if err := r.PutProduct(ctx, p); err != nil {
+				t.Fatalf("PutProduct: %v", err)
+			}
+		}
+
+		found, _, err := r.SearchProducts(ctx, catalog.ProductSearch{Query: "RED"}, 0, 10)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		ids := map[string]bool{}
+		for _, p := range *found {
+			ids[p.Id] = true
+		}
+		if len(ids) != 2 || !ids[shirt.Id] || !ids[mug.Id] {
+			t.Errorf("SearchProducts(RED) = %+v, want the shirt and the mug", *found)
+		}
+
+		found, _, err = r.SearchProducts(ctx, catalog.ProductSearch{Query: "red"}, 1, 10)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		if len(*found) != 1 {
+			t.Errorf("SearchProducts(red) skipping 1 returned %d products, want 1", len(*found))
+		}
+	})
+
+	t.Run("SearchFiltersAndFacets", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		tee := newProduct("Red tee", "Cotton tee", usd(1200))
+		tee.Category, tee.Tags = "Clothing/Shirts", []string{"cotton", "sale"}
+		shirt := newProduct("Red shirt", "Linen shirt", usd(3000))
+		shirt.Category, shirt.Tags = "Clothing/Shirts", []string{"linen"}
+		scarf := newProduct("Red scarf", "Wool scarf", usd(500))
+		scarf.Category, scarf.Tags = "Clothing/Accessories", []string{"sale"}
+		mug := newProduct("Red mug", "Ceramic mug", usd(30000))
+		mug.Category = "Kitchen"
+		for _, p := range []catalog.Product{tee, shirt, scarf, mug} {
+			if err := r.PutProduct(ctx, p); err != nil {
+				t.Fatalf("PutProduct: %v", err)
+			}
+		}
+
+		// A category includes its subcategories, and facets count the
+		// matches on every page.
+		found, facets, err := r.SearchProducts(ctx, catalog.ProductSearch{Query: "red", Category: "Clothing"}, 0, 1)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		if len(*found) != 1 {
+			t.Errorf("SearchProducts in Clothing taking 1 returned %d products, want 1", len(*found))
+		}
+		wantCategories := []catalog.FacetCount{{Value: "Clothing", Count: 3}, {Value: "Clothing/Shirts", Count: 2}, {Value: "Clothing/Accessories", Count: 1}}
+		if !reflect.DeepEqual(facets.Categories, wantCategories) {
+			t.Errorf("category facets = %+v, want %+v", facets.Categories, wantCategories)
+		}
+		wantTags := []catalog.FacetCount{{Value: "sale", Count: 2}, {Value: "cotton", Count: 1}, {Value: "linen", Count: 1}}
+		if !reflect.DeepEqual(facets.Tags, wantTags) {
+			t.Errorf("tag facets = %+v, want %+v", facets.Tags, wantTags)
+		}
+		if len(facets.Prices) != len(catalog.PriceBuckets)+1 {
+			t.Fatalf("SearchProducts returned %d price buckets, want %d", len(facets.Prices), len(catalog.PriceBuckets)+1)
+		}
+		// Priced 5.00, 12.00 and 30.00: under 10.00, 10.00 to 25.00 and 25.00
+		// to 50.00.
+		for i, want := range []uint64{1, 1, 1, 0, 0, 0} {
+			if facets.Prices[i].Count != want {
+				t.Errorf("price bucket %d counts %d products, want %d", i, facets.Prices[i].Count, want)
+			}
+		}
+		if facets.Prices[0].From != nil || *facets.Prices[0].To != catalog.PriceBuckets[0] || facets.Prices[len(facets.Prices)-1].To != nil {
+			t.Errorf("price buckets are not unbounded at both ends: %+v", facets.Prices)
+		}
+
+		// Tags must all match, and no query matches everything.
+		found, facets, err = r.SearchProducts(ctx, catalog.ProductSearch{Category: "Clothing/Shirts", Tags: []string{"cotton", "sale"}}, 0, 10)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		if len(*found) != 1 || !reflect.DeepEqual((*found)[0], tee) {
+			t.Errorf("SearchProducts of cotton and sale shirts = %+v, want the tee", *found)
+		}
+		wantCategories = []catalog.FacetCount{{Value: "Clothing", Count: 1}, {Value: "Clothing/Shirts", Count: 1}}
+		if !reflect.DeepEqual(facets.Categories, wantCategories) {
+			t.Errorf("category facets = %+v, want %+v", facets.Categories, wantCategories)
+		}
+
+		found, facets, err = r.SearchProducts(ctx, catalog.ProductSearch{}, 0, 10)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		if len(*found) != 4 || facets.Prices[len(facets.Prices)-1].Count != 1 {
+			t.Errorf("SearchProducts of everything returned %d products and price buckets %+v, want 4 with the mug in the last bucket", len(*found), facets.Prices)
+		}
+	})
+
+	t.Run("SearchSortsAndFiltersByPrice", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		bread := newProduct("banana bread", "Loaf with banana", usd(800))
+		pie := newProduct("Apple pie", "Pie with apples", usd(1500))
+		tart := newProduct("cherry tart", "Tart with cherries", usd(3000))
+		loaf := newProduct("Date loaf", "Loaf with dates", usd(5000))
+		for i, p := range []catalog.Product{bread, pie, tart, loaf} {
+			p.CreatedAt = p.CreatedAt.Add(time.Duration(i) * time.Hour)
+			if err := r.PutProduct(ctx, p); err != nil {
+				t.Fatalf("PutProduct: %v", err)
+			}
+		}
+
+		for _, tc := range []struct {
+			name   string
+			search catalog.ProductSearch
+			want   []catalog.Product
+		}{
+			{
+				name:   "price range",
+				search: catalog.ProductSearch{MinPrice: price(usd(1000)), MaxPrice: price(usd(3000)), Sort: catalog.SortPrice, Direction: catalog.SortAscending},
+				want:   []catalog.Product{pie, tart},
+			},
+			{
+				name:   "price descending",
+				search: catalog.ProductSearch{MinPrice: price(usd(1500)), Sort: catalog.SortPrice, Direction: catalog.SortDescending},
+				want:   []catalog.Product{loaf, tart, pie},
+			},
+			{
+				name:   "name ignoring case",
+				search: catalog.ProductSearch{Sort: catalog.SortName, Direction: catalog.SortAscending},
+				want:   []catalog.Product{pie, bread, tart, loaf},
+			},
+			{
+				name:   "name descending",
+				search: catalog.ProductSearch{MaxPrice: price(usd(3000)), Sort: catalog.SortName, Direction: catalog.SortDescending},
+				want:   []catalog.Product{tart, bread, pie},
+			},
+			{
+				name:   "newest first",
+				search: catalog.ProductSearch{Sort: catalog.SortCreatedAt, Direction: catalog.SortDescending},
+				want:   []catalog.Product{loaf, tart, pie, bread},
+			},
+			{
+				name:   "least relevant first",
+				search: catalog.ProductSearch{Query: "banana bread pie", Sort: catalog.SortRelevance, Direction: catalog.SortAscending},
+				want:   []catalog.Product{pie, bread},
+			},
+		} {
+			found, _, err := r.SearchProducts(ctx, tc.search, 0, 10)
+			if err != nil {
+				t.Fatalf("SearchProducts by %s: %v", tc.name, err)
+			}
+			if got, want := ids(*found), ids(tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("SearchProducts by %s = %v, want %v", tc.name, got, want)
+			}
+		}
+
+		found, _, err := r.SearchProducts(ctx, catalog.ProductSearch{Sort: catalog.SortCreatedAt, Direction: catalog.SortAscending}, 1, 1)
+		if err != nil {
+			t.Fatalf("SearchProducts: %v", err)
+		}
+		want := pie
+		want.CreatedAt = want.CreatedAt.Add(time.Hour)
+		if len(*found) != 1 || !reflect.DeepEqual((*found)[0], want) {
+			t.Errorf("second oldest product = %+v, want %+v", *found, want)
+		}
+	})
+
+	t.Run("SearchPagesThroughTies", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		createdAt := time.Now().UTC().Truncate(time.Microsecond)
+		want := []string{}
+		for range 5 {
+			p := newProduct("Pen", "Pen", usd(100))
+			p.CreatedAt = createdAt
+			if err := r.PutProduct(ctx, p); err != nil {
+				t.Fatalf("PutProduct: %v", err)
+			}
+			want = append(want, p.Id)
+		}
+		sort.Strings(want)
+
+		// Products that sort the same come in id order, so no page repeats or
+		// skips one.
+		for _, by := range []catalog.ProductSort{catalog.SortPrice, catalog.SortName, catalog.SortCreatedAt, catalog.SortRelevance} {
+			search := catalog.ProductSearch{Query: "pen", Sort: by, Direction: catalog.SortDescending}
+			got := []string{}
+			for skip := uint64(0); skip < 5; skip += 3 {
+				found, _, err := r.SearchProducts(ctx, search, skip, 3)
+				if err != nil {
+					t.Fatalf("SearchProducts: %v", err)
+				}
+				got = append(got, ids(*found)...)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pages of SearchProducts by %s = %v, want %v", by, got, want)
+			}
+		}
+	})
+
+	t.Run("SearchPricesInCurrencies", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		cheap := newProduct("Cheap pen", "Pen", usd(150))
+		dear := newProduct("Dear pen", "Pen", usd(9000))
+		euro := newProduct("Euro pen", "Pen", money.Money{Amount: 500, Currency: "EUR"})
+		yen := newProduct("Yen pen", "Pen", money.Money{Amount: 300, Currency: "JPY"})
+		for _, p := range []catalog.Product{cheap, dear, euro, yen} {
+			if err := r.PutProduct(ctx, p); err != nil {
+				t.Fatalf("PutProduct: %v", err)
+			}
+		}
+
+		for _, tc := range []struct {
+			name   string
+			search catalog.ProductSearch
+			want   []catalog.Product
+		}{
+			{
+				name:   "currency, then amount",
+				search: catalog.ProductSearch{Sort: catalog.SortPrice, Direction: catalog.SortAscending},
+				want:   []catalog.Product{euro, yen, cheap, dear},
+			},
+			{
+				name:   "a range in dollars",
+				search: catalog.ProductSearch{MinPrice: price(usd(0)), Sort: catalog.SortPrice, Direction: catalog.SortDescending},
+				want:   []catalog.Product{dear, cheap},
+			},
+			{
+				name:   "a range in yen",
+				search: catalog.ProductSearch{MaxPrice: price(money.Money{Amount: 1000, Currency: "JPY"})},
+				want:   []catalog.Product{yen},
+			},
+		} {
+			found, _, err := r.SearchProducts(ctx, tc.search, 0, 10)
+			if err != nil {
+				t.Fatalf("SearchProducts by %s: %v", tc.name, err)
+			}
+			if got, want := ids(*found), ids(tc.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("SearchProducts by %s = %v, want %v", tc.name, got, want)
+			}
+		}
+	})
+}
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+func price(p money.Money) *money.Money {
+	return &p
+}
+
+func ids(products []catalog.Product) []string {
+	ids := []string{}
+	for _, p := range products {
+		ids = append(ids, p.Id)
+	}
+	return ids
+}
+
+func newProduct(name, description string, price money.Money) catalog.Product {
+	return catalog.Product{
+		Id:          ksuid.New().String(),
+		Name:        name,
+		Description: description,
+		Price:       price,
+		CreatedAt:   time.Now().UTC().Truncate(time.Microsecond),
+	}
+}
+
+func putProducts(t *testing.T, r catalog.Repository, n int) []catalog.Product {
+	t.Helper()
+	products := make([]catalog.Product, n)
+	for i := range products {
+		products[i] = newProduct("Product", "Description", usd(int64(i)*100))
+		if err := r.PutProduct(context.Background(), products[i]); err != nil {
+			t.Fatalf("PutProduct: %v", err)
+		}
+	}
+	return products
+}
@@ -0,0 +1,175 @@
+package catalogtest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/segmentio/ksuid"
+)
+
+// TestInventory runs the conformance suite for catalog.Inventory
+// implementations. newInventory must return an empty inventory on every
+// call.
+func TestInventory(t *testing.T, newInventory func(t *testing.T) catalog.Inventory) {
+	t.Run("ReserveCommitRelease", func(t *testing.T) {
+		inv := newInventory(t)
+		ctx := context.Background()
+		product := ksuid.New().String()
+		if err := inv.SetStock(ctx, product, 5); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+
+		first := newReservation(time.Minute, catalog.StockItem{SKU: product, Quantity: 3})
+		if err := inv.Reserve(ctx, first); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: product, Tracked: true, OnHand: 5, Reserved: 3})
+		if err := inv.Reserve(ctx, newReservation(time.Minute, catalog.StockItem{SKU: product, Quantity: 3})); !errors.Is(err, catalog.ErrOutOfStock) {
+			t.Errorf("Reserve of more than is available error = %v, want catalog.ErrOutOfStock", err)
+		}
+
+		if err := inv.Commit(ctx, first.ID); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: product, Tracked: true, OnHand: 2})
+		if err := inv.Commit(ctx, first.ID); !errors.Is(err, catalog.ErrReservationNotFound) {
+			t.Errorf("Commit of a committed reservation error = %v, want catalog.ErrReservationNotFound", err)
+		}
+
+		second := newReservation(time.Minute, catalog.StockItem{SKU: product, Quantity: 2})
+		if err := inv.Reserve(ctx, second); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		if err := inv.Release(ctx, second.ID); err != nil {
+			t.Fatalf("Release: %v", err)
+		}
+		if err := inv.Release(ctx, second.ID); err != nil {
+			t.Errorf("Release of a released reservation: %v", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: product, Tracked: true, OnHand: 2})
+		if err := inv.Commit(ctx, second.ID); !errors.Is(err, catalog.ErrReservationNotFound) {
+			t.Errorf("Commit of a released reservation error = %v, want catalog.ErrReservationNotFound", err)
+		}
+	})
+
+	t.Run("ReserveIsAllOrNothing", func(t *testing.T) {
+		inv := newInventory(t)
+		ctx := context.Background()
+		plenty, scarce, untracked := ksuid.New().String(), ksuid.New().String(), ksuid.New().String()
+		if err := inv.SetStock(ctx, plenty, 10); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+		if err := inv.SetStock(ctx, scarce, 1); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+
+		r := newReservation(
+			time.Minute,
+			catalog.StockItem{SKU: plenty, Quantity: 2},
+			catalog.StockItem{SKU: scarce, Quantity: 2},
+		)
+		if err := inv.Reserve(ctx, r); !errors.Is(err, catalog.ErrOutOfStock) {
+			t.Fatalf("Reserve of a scarce product error = %v, want catalog.ErrOutOfStock", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: plenty, Tracked: true, OnHand: 10})
+
+		// Untracked SKUs have no limit.
+		r = newReservation(
+			time.Minute,
+			catalog.StockItem{SKU: plenty, Quantity: 2},
+			catalog.StockItem{SKU: untracked, Quantity: 10000},
+		)
+		if err := inv.Reserve(ctx, r); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: untracked})
+		if err := inv.Commit(ctx, r.ID); err != nil {
+			t.Fatalf("Commit: %v", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: plenty, Tracked: true, OnHand: 8})
+	})
+
+	t.Run("CommitRefusesToOversell", func(t *testing.T) {
+		inv := newInventory(t)
+		ctx := context.Background()
+		// Sorted first, plenty is taken before scarce falls short.
+		plenty, scarce := "a"+ksuid.New().String(), "b"+ksuid.New().String()
+		for _, sku := range []string{plenty, scarce} {
+			if err := inv.SetStock(ctx, sku, 5); err != nil {
+				t.Fatalf("SetStock: %v", err)
+			}
+		}
+		r := newReservation(
+			time.Minute,
+			catalog.StockItem{SKU: plenty, Quantity: 3},
+			catalog.StockItem{SKU: scarce, Quantity: 3},
+		)
+		if err := inv.Reserve(ctx, r); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+
+		// Stock counted down after the reservation was made.
+		if err := inv.SetStock(ctx, scarce, 2); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+		if err := inv.Commit(ctx, r.ID); !errors.Is(err, catalog.ErrOutOfStock) {
+			t.Errorf("Commit of more than is on hand error = %v, want catalog.ErrOutOfStock", err)
+		}
+		checkStock(t, inv, catalog.Stock{SKU: plenty, Tracked: true, OnHand: 5})
+		checkStock(t, inv, catalog.Stock{SKU: scarce, Tracked: true, OnHand: 2})
+		if err := inv.Commit(ctx, r.ID); !errors.Is(err, catalog.ErrReservationNotFound) {
+			t.Errorf("Commit after an oversell error = %v, want catalog.ErrReservationNotFound", err)
+		}
+	})
+
+	t.Run("ReservationsExpire", func(t *testing.T) {
+		inv := newInventory(t)
+		ctx := context.Background()
+		product := ksuid.New().String()
+		if err := inv.SetStock(ctx, product, 1); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+		lapsed := newReservation(200*time.Millisecond, catalog.StockItem{SKU: product, Quantity: 1})
+		if err := inv.Reserve(ctx, lapsed); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		if err := inv.Reserve(ctx, newReservation(time.Minute, catalog.StockItem{SKU: product, Quantity: 1})); !errors.Is(err, catalog.ErrOutOfStock) {
+			t.Errorf("Reserve of held stock error = %v, want catalog.ErrOutOfStock", err)
+		}
+
+		time.Sleep(time.Until(lapsed.ExpiresAt))
+		checkStock(t, inv, catalog.Stock{SKU: product, Tracked: true, OnHand: 1})
+		if err := inv.Reserve(ctx, newReservation(time.Minute, catalog.StockItem{SKU: product, Quantity: 1})); err != nil {
+			t.Errorf("Reserve of stock whose reservation expired: %v", err)
+		}
+		if err := inv.Commit(ctx, lapsed.ID); !errors.Is(err, catalog.ErrReservationNotFound) {
+			t.Errorf("Commit of an expired reservation error = %v, want catalog.ErrReservationNotFound", err)
+		}
+	})
+}
+
+// newReservation returns a reservation of items, which must name distinct
+// SKUs, expiring after ttl.
+func newReservation(ttl time.Duration, items ...catalog.StockItem) catalog.Reservation {
+	sort.Slice(items, func(i, j int) bool { return items[i].SKU < items[j].SKU })
+	return catalog.Reservation{
+		ID:        ksuid.New().String(),
+		Items:     items,
+		ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Microsecond),
+	}
+}
+
+func checkStock(t *testing.T, inv catalog.Inventory, want catalog.Stock) {
+	t.Helper()
+	stock, err := inv.GetStock(context.Background(), []string{want.SKU})
+	if err != nil {
+		t.Fatalf("GetStock: %v", err)
+	}
+	if len(stock) != 1 || stock[0] != want {
+		t.Errorf("GetStock = %+v, want %+v", stock, want)
+	}
+}
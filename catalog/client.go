@@ -2,9 +2,17 @@ package catalog
 
 import (
 	"context"
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	pb "github.com/Mostbesep/microservice-com-temp/catalog/pb/microservice-com-temp.catalog.pb"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"io"
+	"time"
 )
 
 type Client struct {
@@ -12,9 +20,18 @@ type Client struct {
 	Service pb.CatalogServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
+func NewClient(url string, key authz.Key) (*Client, error) {
 
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(
+		url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			authz.UnaryClientInterceptor(key),
+			idempotency.UnaryClientInterceptor(),
+			errs.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(authz.StreamClientInterceptor(key), errs.StreamClientInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -30,24 +47,22 @@ func (c *Client) Close() error {
 	return nil
 }
 
-func (c *Client) PostProduct(ctx context.Context, name, description string, price float64) (*Product, error) {
+func (c *Client) PostProduct(ctx context.Context, name, description string, price money.Money, category string, tags []string, variants []Variant) (*Product, error) {
 	r, err := c.Service.PostProduct(
 		ctx,
 		&pb.PostProductRequest{
 			Name:        name,
 			Description: description,
-			Price:       price,
+			Price:       moneyToProto(price),
+			Category:    category,
+			Tags:        tags,
+			Variants:    variantsToProto(variants),
 		},
 	)
 	if err != nil {
 		return nil, err
 	}
-	return &Product{
-		Id:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	return productFromProto(r.Product), nil
 }
 
 func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
@@ -61,12 +76,89 @@ func (c *Client) GetProduct(ctx context.Context, id string) (*Product, error) {
 		return nil, err
 	}
 
-	return &Product{
-		Id:          r.Product.Id,
-		Name:        r.Product.Name,
-		Description: r.Product.Description,
-		Price:       r.Product.Price,
-	}, nil
+	return productFromProto(r.Product), nil
+}
+
+// UpdateProduct changes the named fields of the product, or all of them if
+// fields is empty. If product.Version is set, the update fails with
+// ErrVersionConflict unless the product is still at that version.
+func (c *Client) UpdateProduct(ctx context.Context, product Product, fields []string) (*Product, error) {
+	r, err := c.Service.UpdateProduct(
+		ctx,
+		&pb.UpdateProductRequest{
+			Product: &pb.Product{
+				Id:          product.Id,
+				Name:        product.Name,
+				Description: product.Description,
+				Price:       moneyToProto(product.Price),
+				Category:    product.Category,
+				Tags:        product.Tags,
+				Variants:    variantsToProto(product.Variants),
+				Version:     product.Version,
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: fields},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return productFromProto(r.Product), nil
+}
+
+func (c *Client) DeleteProduct(ctx context.Context, id string, version string) error {
+	_, err := c.Service.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id, Version: version})
+	return err
+}
+
+// ImportProducts streams the rows returned by next, until it returns io.EOF,
+// to the service and returns the result of every row.
+func (c *Client) ImportProducts(ctx context.Context, next func() (ProductImport, error)) ([]ImportResult, error) {
+	// Cancelling the call if next fails keeps the server from importing
+	// the rows of the unfinished batch.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.Service.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		row, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = stream.Send(&pb.ImportProductsRequest{
+			Name:        row.Name,
+			Description: row.Description,
+			Price:       moneyToProto(row.Price),
+			Category:    row.Category,
+			Tags:        row.Tags,
+			Variants:    variantsToProto(row.Variants),
+		})
+		if err == io.EOF {
+			// The server ended the call; CloseAndRecv returns its error.
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]ImportResult, len(response.Results))
+	for i, r := range response.Results {
+		results[i] = ImportResult{Row: int(r.Row)}
+		if r.Product != nil {
+			results[i].Product = *productFromProto(r.Product)
+		} else {
+			results[i].Err = errs.New(errs.Code(r.Code), r.Message)
+		}
+	}
+	return results, nil
 }
 
 func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids []string, query string) ([]Product, error) {
@@ -84,12 +176,197 @@ func (c *Client) GetProducts(ctx context.Context, skip uint64, take uint64, ids
 	}
 	products := []Product{}
 	for _, p := range r.Products {
-		products = append(products, Product{
-			Id:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		})
+		products = append(products, *productFromProto(p))
 	}
 	return products, nil
 }
+
+// GetProductsBySKUs returns the products having variants with any of the
+// SKUs.
+func (c *Client) GetProductsBySKUs(ctx context.Context, skus []string) ([]Product, error) {
+	r, err := c.Service.GetProducts(ctx, &pb.GetProductsRequest{Skus: skus})
+	if err != nil {
+		return nil, err
+	}
+	products := []Product{}
+	for _, p := range r.Products {
+		products = append(products, *productFromProto(p))
+	}
+	return products, nil
+}
+
+// FindProducts returns a page of the products matching search, without
+// counting facets.
+func (c *Client) FindProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) ([]Product, error) {
+	products, _, err := c.searchProducts(ctx, search, skip, take, false)
+	return products, err
+}
+
+// SearchProducts returns a page of the products matching search and the
+// facet counts of all of them.
+func (c *Client) SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) ([]Product, Facets, error) {
+	return c.searchProducts(ctx, search, skip, take, true)
+}
+
+func (c *Client) searchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64, withFacets bool) ([]Product, Facets, error) {
+	sort, direction, err := sortToProto(search.Sort, search.Direction)
+	if err != nil {
+		return nil, Facets{}, err
+	}
+	r, err := c.Service.GetProducts(
+		ctx,
+		&pb.GetProductsRequest{
+			Skip:      skip,
+			Take:      take,
+			Query:     search.Query,
+			Category:  search.Category,
+			Tags:      search.Tags,
+			Facets:    withFacets,
+			MinPrice:  priceBoundToProto(search.MinPrice),
+			MaxPrice:  priceBoundToProto(search.MaxPrice),
+			Sort:      sort,
+			Direction: direction,
+		},
+	)
+	if err != nil {
+		return nil, Facets{}, err
+	}
+	products := []Product{}
+	for _, p := range r.Products {
+		products = append(products, *productFromProto(p))
+	}
+	if !withFacets {
+		return products, Facets{}, nil
+	}
+	facets := Facets{Categories: []FacetCount{}, Tags: []FacetCount{}, Prices: []PriceBucket{}}
+	for _, f := range r.GetFacets().GetCategories() {
+		facets.Categories = append(facets.Categories, FacetCount{Value: f.Value, Count: f.Count})
+	}
+	for _, f := range r.GetFacets().GetTags() {
+		facets.Tags = append(facets.Tags, FacetCount{Value: f.Value, Count: f.Count})
+	}
+	for _, b := range r.GetFacets().GetPrices() {
+		facets.Prices = append(facets.Prices, PriceBucket{From: b.From, To: b.To, Count: b.Count})
+	}
+	return products, facets, nil
+}
+
+// SetStock sets the quantity on hand of the SKU of a variant, or of a product
+// without variants, and returns its stock.
+func (c *Client) SetStock(ctx context.Context, sku string, onHand uint64) (Stock, error) {
+	r, err := c.Service.SetStock(ctx, &pb.SetStockRequest{Sku: sku, OnHand: onHand})
+	if err != nil {
+		return Stock{}, err
+	}
+	return stockFromProto(r.Stock), nil
+}
+
+func (c *Client) GetStock(ctx context.Context, skus []string) ([]Stock, error) {
+	r, err := c.Service.GetStock(ctx, &pb.GetStockRequest{Skus: skus})
+	if err != nil {
+		return nil, err
+	}
+	stock := []Stock{}
+	for _, s := range r.Stock {
+		stock = append(stock, stockFromProto(s))
+	}
+	return stock, nil
+}
+
+// ReserveStock holds the items for ttl, or for DefaultReservationTTL if ttl
+// is zero. It fails with ErrOutOfStock, holding nothing, if any of them is
+// short.
+func (c *Client) ReserveStock(ctx context.Context, items []StockItem, ttl time.Duration) (Reservation, error) {
+	req := &pb.ReserveStockRequest{}
+	for _, item := range items {
+		req.Items = append(req.Items, &pb.StockItem{Sku: item.SKU, Quantity: item.Quantity})
+	}
+	if ttl != 0 {
+		req.Ttl = durationpb.New(ttl)
+	}
+	r, err := c.Service.ReserveStock(ctx, req)
+	if err != nil {
+		return Reservation{}, err
+	}
+	reservation := Reservation{ID: r.ReservationId}
+	for _, item := range r.Items {
+		reservation.Items = append(reservation.Items, StockItem{SKU: item.Sku, Quantity: item.Quantity})
+	}
+	if err = reservation.ExpiresAt.UnmarshalBinary(r.ExpiresAt); err != nil {
+		return Reservation{}, err
+	}
+	return reservation, nil
+}
+
+func (c *Client) CommitReservation(ctx context.Context, reservationID string) error {
+	_, err := c.Service.CommitReservation(ctx, &pb.CommitReservationRequest{ReservationId: reservationID})
+	return err
+}
+
+func (c *Client) ReleaseReservation(ctx context.Context, reservationID string) error {
+	_, err := c.Service.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: reservationID})
+	return err
+}
+
+func stockFromProto(s *pb.Stock) Stock {
+	return Stock{
+		SKU:      s.GetSku(),
+		Tracked:  s.GetTracked(),
+		OnHand:   s.GetOnHand(),
+		Reserved: s.GetReserved(),
+	}
+}
+
+func productFromProto(p *pb.Product) *Product {
+	product := &Product{
+		Id:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       moneyFromProto(p.Price),
+		Category:    p.Category,
+		Variants:    variantsFromProto(p.Variants),
+		Version:     p.Version,
+	}
+	if len(p.Tags) > 0 {
+		product.Tags = p.Tags
+	}
+	// Products without a creation time leave CreatedAt zero.
+	_ = product.CreatedAt.UnmarshalBinary(p.CreatedAt)
+	return product
+}
+
+// priceBoundToProto translates a bound of a price range, leaving it unset if
+// nil.
+func priceBoundToProto(m *money.Money) *pb.Money {
+	if m == nil {
+		return nil
+	}
+	return moneyToProto(*m)
+}
+
+// sortToProto translates a sort order for a request. An empty sort is by
+// relevance, and an empty direction the default of the sort.
+func sortToProto(sort ProductSort, direction SortDirection) (pb.ProductSort, pb.SortDirection, error) {
+	var s pb.ProductSort
+	switch sort {
+	case "", SortRelevance:
+		s = pb.ProductSort_PRODUCT_SORT_RELEVANCE
+	case SortPrice:
+		s = pb.ProductSort_PRODUCT_SORT_PRICE
+	case SortName:
+		s = pb.ProductSort_PRODUCT_SORT_NAME
+	case SortCreatedAt:
+		s = pb.ProductSort_PRODUCT_SORT_CREATED_AT
+	default:
+		return 0, 0, ErrInvalidSort
+	}
+	switch direction {
+	case "":
+		return s, pb.SortDirection_SORT_DIRECTION_DEFAULT, nil
+	case SortAscending:
+		return s, pb.SortDirection_SORT_DIRECTION_ASC, nil
+	case SortDescending:
+		return s, pb.SortDirection_SORT_DIRECTION_DESC, nil
+	}
+	return 0, 0, ErrInvalidSort
+}
@@ -0,0 +1,242 @@
+// Command catalog-import creates products in bulk through the ImportProducts
+// RPC of the catalog service, such as from a supplier feed.
+//
+//	catalog-import -admin <account id> [-url localhost:8080] [-format csv|jsonl] <file>
+//
+// CSV files start with a header naming the name and price columns, and
+// optionally description, category and tags, in any order. Tags are
+// separated by |. JSON Lines files hold one object per line:
+//
+//	{"name": "Shirt", "description": "Cotton shirt", "price": "19.99 USD",
+//	 "category": "Clothing/Shirts", "tags": ["cotton"],
+//	 "variants": [{"sku": "SHIRT-M", "attributes": {"size": "M"}, "price": "19.99 USD"}]}
+//
+// Prices are written as an amount and a currency, as in "19.99 USD".
+// Products with variants can only be imported from JSON Lines. The format
+// defaults to the file extension; pass - as the file to read standard input.
+//
+// The command calls the service as the given admin account, signing that
+// identity with the key in the IDENTITY_KEY environment variable, which
+// must be the one the services share.
+//
+// Failed rows are listed on standard error and make the command exit with
+// status 1. Every imported row is a new product, so running an import again
+// creates its products again, except for the ones with variants: their SKUs
+// are taken by then.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	url := flag.String("url", "localhost:8080", "address of the catalog service")
+	admin := flag.String("admin", "", "id of the admin account to import as (required)")
+	format := flag.String("format", "", "input format, csv or jsonl (default from the file extension)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: catalog-import -admin <account id> [flags] <file>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *admin == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	key, err := authz.ParseKey(os.Getenv("IDENTITY_KEY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	name := flag.Arg(0)
+	in := os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if *format == "" {
+		*format = formatOf(name)
+	}
+
+	var next func() (catalog.ProductImport, error)
+	switch *format {
+	case "csv":
+		var err error
+		if next, err = csvRows(in); err != nil {
+			log.Fatal(err)
+		}
+	case "jsonl":
+		next = jsonlRows(in)
+	default:
+		log.Fatalf("unknown format %q, use -format csv or -format jsonl", *format)
+	}
+
+	client, err := catalog.NewClient(*url, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = authz.ContextWithIdentity(ctx, authz.Identity{AccountID: *admin, Roles: []string{authz.RoleAdmin}})
+
+	results, err := client.ImportProducts(ctx, next)
+	if err != nil {
+		log.Fatal(err)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "row %d: %v\n", r.Row, r.Err)
+		}
+	}
+	fmt.Printf("imported %d products, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func formatOf(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return "csv"
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	}
+	return ""
+}
+
+// csvRows reads the header of r and returns a function that reads the rows
+// after it.
+func csvRows(r io.Reader) (func() (catalog.ProductImport, error), error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range []string{"name", "price"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("csv header has no %q column", column)
+		}
+	}
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok {
+			return record[i]
+		}
+		return ""
+	}
+	row := 0
+	return func() (catalog.ProductImport, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return catalog.ProductImport{}, err
+		}
+		row++
+		price, err := money.Parse(field(record, "price"))
+		if err != nil {
+			return catalog.ProductImport{}, fmt.Errorf("row %d: %w", row, err)
+		}
+		var tags []string
+		if t := field(record, "tags"); t != "" {
+			tags = strings.Split(t, "|")
+		}
+		return catalog.ProductImport{
+			Name:        field(record, "name"),
+			Description: field(record, "description"),
+			Price:       price,
+			Category:    field(record, "category"),
+			Tags:        tags,
+		}, nil
+	}, nil
+}
+
+// feedProduct is a line of a JSON Lines feed.
+type feedProduct struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Price       string   `json:"price"`
+	Category    string   `json:"category"`
+	Tags        []string `json:"tags"`
+	Variants    []struct {
+		SKU        string            `json:"sku"`
+		Attributes map[string]string `json:"attributes"`
+		Price      string            `json:"price"`
+	} `json:"variants"`
+}
+
+// jsonlRows returns a function that reads one row per non-blank line of r.
+func jsonlRows(r io.Reader) func() (catalog.ProductImport, error) {
+	scanner := bufio.NewScanner(r)
+	// Products with many variants make for long lines.
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	return func() (catalog.ProductImport, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			row, err := parseFeedProduct(text)
+			if err != nil {
+				return catalog.ProductImport{}, fmt.Errorf("line %d: %w", line, err)
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return catalog.ProductImport{}, err
+		}
+		return catalog.ProductImport{}, io.EOF
+	}
+}
+
+func parseFeedProduct(text []byte) (catalog.ProductImport, error) {
+	p := feedProduct{}
+	if err := json.Unmarshal(text, &p); err != nil {
+		return catalog.ProductImport{}, err
+	}
+	price, err := money.Parse(p.Price)
+	if err != nil {
+		return catalog.ProductImport{}, err
+	}
+	row := catalog.ProductImport{
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       price,
+		Category:    p.Category,
+		Tags:        p.Tags,
+	}
+	for _, v := range p.Variants {
+		variantPrice, err := money.Parse(v.Price)
+		if err != nil {
+			return catalog.ProductImport{}, fmt.Errorf("variant %s: %w", v.SKU, err)
+		}
+		row.Variants = append(row.Variants, catalog.Variant{SKU: v.SKU, Attributes: v.Attributes, Price: variantPrice})
+	}
+	return row, nil
+}
@@ -1,19 +1,47 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log"
+	"os"
 	"time"
 
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 )
 
 type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	// DatabaseBackend is where products are kept: "elasticsearch", with
+	// DATABASE_URL pointing at the cluster, or "postgres", with DATABASE_URL
+	// pointing at the database.
+	DatabaseBackend string `envconfig:"DATABASE_BACKEND" default:"elasticsearch"`
+	// IdentityKey signs and verifies the caller identities passed between
+	// the gateway and the services, which must all share it. At least 32
+	// bytes.
+	IdentityKey authz.Key `envconfig:"IDENTITY_KEY" required:"true"`
+	// IdempotencyWindow is how long the result of a PostProduct call is
+	// replayed to retries with the same idempotency key.
+	IdempotencyWindow time.Duration `envconfig:"IDEMPOTENCY_WINDOW" default:"24h"`
+	// ImportFlushSize and ImportFlushInterval bound how many products
+	// ImportProducts writes at once, and how long a product waits for its
+	// batch to fill up.
+	ImportFlushSize     int           `envconfig:"IMPORT_FLUSH_SIZE" default:"500"`
+	ImportFlushInterval time.Duration `envconfig:"IMPORT_FLUSH_INTERVAL" default:"1s"`
 }
 
 func main() {
+	// catalog migrate up|down|status, for the postgres backend
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	var cfg Config
 	err := envconfig.Process("", &cfg)
 	if err != nil {
@@ -21,16 +49,85 @@ func main() {
 	}
 
 	var r catalog.Repository
-	retry.ForeverSleep(2*time.Second, func(i int) (err error) {
-		r, err = catalog.NewElasticRepository(cfg.DatabaseURL)
+	var inventory catalog.Inventory
+	var keys idempotency.Store
+	switch cfg.DatabaseBackend {
+	case "elasticsearch":
+		retry.ForeverSleep(2*time.Second, func(i int) (err error) {
+			r, err = catalog.NewElasticRepository(cfg.DatabaseURL)
+			if err != nil {
+				log.Println(err, i)
+			}
+			return
+		})
+		inventory, err = catalog.NewElasticInventory(cfg.DatabaseURL)
 		if err != nil {
-			log.Println(err, i)
+			log.Fatal(err)
 		}
-		return
-	})
+		keys, err = idempotency.NewElasticStore(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "postgres":
+		retry.ForeverSleep(2*time.Second, func(_ int) error {
+			if err = migrateUp(cfg.DatabaseURL); err != nil {
+				log.Println(err)
+				return err
+			}
+			r, err = catalog.NewPostgresRepository(cfg.DatabaseURL)
+			if err != nil {
+				log.Println(err)
+				return err
+			}
+			inventory, err = catalog.NewPostgresInventory(cfg.DatabaseURL)
+			if err != nil {
+				r.Close()
+				log.Println(err)
+				return err
+			}
+			keys, err = idempotency.NewPostgresStore(cfg.DatabaseURL)
+			if err != nil {
+				inventory.Close()
+				r.Close()
+				log.Println(err)
+			}
+			return err
+		})
+	default:
+		log.Fatalf("unknown DATABASE_BACKEND %q, want elasticsearch or postgres", cfg.DatabaseBackend)
+	}
 	defer r.Close()
+	defer inventory.Close()
+	defer keys.Close()
 
 	log.Println("Listening on port 8080...")
-	s := catalog.NewService(r)
-	log.Fatal(catalog.ListenGRPC(s, 8080))
+	s := catalog.NewService(r, inventory)
+	imports := catalog.ImportOptions{FlushSize: cfg.ImportFlushSize, FlushInterval: cfg.ImportFlushInterval}
+	log.Fatal(catalog.ListenGRPC(s, keys, cfg.IdempotencyWindow, cfg.IdentityKey, imports, 8080))
+}
+
+func migrateUp(url string) error {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Up(context.Background(), db, catalog.Migrations)
+}
+
+func runMigrate(args []string) {
+	var cfg struct {
+		DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	}
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err = migrate.Run(context.Background(), db, catalog.Migrations, args, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
 }
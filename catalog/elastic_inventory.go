@@ -0,0 +1,326 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/olivere/elastic/v7"
+	"log"
+	"time"
+)
+
+const (
+	// stockIndex holds a document per tracked SKU.
+	stockIndex = "stock"
+	// reservationIndex holds a document per reservation, naming the SKUs
+	// whose stock documents it is held in.
+	reservationIndex = "stock_reservations"
+)
+
+// The reservations of a stock document and the items of a reservation are
+// only ever read back whole, so they are not indexed.
+const (
+	stockMapping = `{
+	"dynamic": "strict",
+	"properties": {
+		"on_hand": {"type": "long"},
+		"reservations": {"type": "object", "enabled": false}
+	}
+}`
+	reservationMapping = `{
+	"dynamic": "strict",
+	"properties": {
+		"items": {"type": "object", "enabled": false},
+		"expires_at": {"type": "date"}
+	}
+}`
+)
+
+// stockAttempts is how many times a change to a stock document is retried
+// when another write gets in between.
+const stockAttempts = 10
+
+// errUnchanged tells modifyStock that there is nothing to write.
+var errUnchanged = errors.New("stock unchanged")
+
+// stockDocument is the stock of a SKU with the reservations held in it,
+// by reservation id.
+type stockDocument struct {
+	OnHand       uint64               `json:"on_hand"`
+	Reservations map[string]heldStock `json:"reservations"`
+}
+
+// heldStock is a reservation held in a stock document. Once committed, its
+// quantity has been taken off OnHand; it stays until it expires so that
+// committing again can tell it was taken, and releasing can give it back.
+type heldStock struct {
+	Quantity  uint64    `json:"quantity"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Committed bool      `json:"committed,omitempty"`
+}
+
+// stock returns the stock of the document as of now, dropping the
+// reservations that have expired.
+func (d *stockDocument) stock(sku string, now time.Time) Stock {
+	s := Stock{SKU: sku, Tracked: true, OnHand: d.OnHand}
+	for id, held := range d.Reservations {
+		if !now.Before(held.ExpiresAt) {
+			delete(d.Reservations, id)
+			continue
+		}
+		if !held.Committed {
+			s.Reserved += held.Quantity
+		}
+	}
+	return s
+}
+
+type reservationDocument struct {
+	Items     []reservationItem `json:"items"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type reservationItem struct {
+	SKU      string `json:"sku"`
+	Quantity uint64 `json:"quantity"`
+}
+
+// elasticInventory keeps stock in Elasticsearch, which cannot change several
+// documents atomically. A reservation is held in the stock document of each
+// of its SKUs in turn, each change conditional on the document not having
+// changed since it was read, and is undone SKU by SKU if one of them falls
+// short.
+type elasticInventory struct {
+	client *elastic.Client
+}
+
+// NewElasticInventory connects to the cluster at url and makes sure the
+// stock and reservation indices exist with their mappings.
+func NewElasticInventory(url string) (Inventory, error) {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for name, mapping := range map[string]string{stockIndex: stockMapping, reservationIndex: reservationMapping} {
+		if err = createIndex(context.Background(), client, name, mapping); err != nil {
+			client.Stop()
+			return nil, elasticError(err)
+		}
+	}
+	return &elasticInventory{client: client}, nil
+}
+
+func (i *elasticInventory) Close() {
+	i.client.Stop()
+}
+
+func (i *elasticInventory) SetStock(ctx context.Context, sku string, onHand uint64) error {
+	return i.modifyStock(ctx, sku, true, func(doc *stockDocument) error {
+		// Drop the expired reservations while at it.
+		doc.stock(sku, time.Now())
+		doc.OnHand = onHand
+		return nil
+	})
+}
+
+func (i *elasticInventory) GetStock(ctx context.Context, skus []string) ([]Stock, error) {
+	stock := []Stock{}
+	if len(skus) == 0 {
+		return stock, nil
+	}
+	get := i.client.MultiGet()
+	for _, id := range skus {
+		get.Add(elastic.NewMultiGetItem().Index(stockIndex).Id(id))
+	}
+	res, err := get.Do(ctx)
+	if err != nil {
+		return nil, elasticError(err)
+	}
+	now := time.Now()
+	for n, doc := range res.Docs {
+		if !doc.Found {
+			stock = append(stock, Stock{SKU: skus[n]})
+			continue
+		}
+		d := stockDocument{}
+		if err := json.Unmarshal(doc.Source, &d); err != nil {
+			return nil, err
+		}
+		stock = append(stock, d.stock(skus[n], now))
+	}
+	return stock, nil
+}
+
+// Reserve writes the reservation document first, so that Release can find
+// every SKU it may have been held in, then holds it SKU by SKU.
+// If the caller stops half way, what was held is given back when the
+// reservation expires.
+func (i *elasticInventory) Reserve(ctx context.Context, reservation Reservation) error {
+	doc := reservationDocument{ExpiresAt: reservation.ExpiresAt}
+	for _, item := range reservation.Items {
+		doc.Items = append(doc.Items, reservationItem{SKU: item.SKU, Quantity: item.Quantity})
+	}
+	_, err := i.client.Index().Index(reservationIndex).
+		Id(reservation.ID).OpType("create").BodyJson(doc).Do(ctx)
+	if err != nil {
+		return elasticError(err)
+	}
+
+	for _, item := range reservation.Items {
+		err = i.modifyStock(ctx, item.SKU, false, func(doc *stockDocument) error {
+			if doc.stock(item.SKU, time.Now()).Available() < item.Quantity {
+				return ErrOutOfStock
+			}
+			if doc.Reservations == nil {
+				doc.Reservations = map[string]heldStock{}
+			}
+			doc.Reservations[reservation.ID] = heldStock{Quantity: item.Quantity, ExpiresAt: reservation.ExpiresAt}
+			return nil
+		})
+		if err != nil {
+			if releaseErr := i.Release(ctx, reservation.ID); releaseErr != nil {
+				log.Println("Error releasing stock reservation", reservation.ID, releaseErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Commit takes the quantities of the reservation off the stock of its
+// SKUs, marking it committed in each. If it stops half way, committing
+// again finishes the job without taking anything twice. If a SKU no longer
+// holds the reservation, or has less on hand than it holds, what was
+// already taken is given back by releasing the reservation.
+func (i *elasticInventory) Commit(ctx context.Context, reservationID string) error {
+	doc, err := i.getReservation(ctx, reservationID)
+	if err != nil {
+		return err
+	}
+	if doc == nil || !time.Now().Before(doc.ExpiresAt) {
+		return ErrReservationNotFound
+	}
+	for _, item := range doc.Items {
+		err = i.modifyStock(ctx, item.SKU, false, func(stock *stockDocument) error {
+			held, ok := stock.Reservations[reservationID]
+			switch {
+			case !ok:
+				// It expired and was dropped in the meantime.
+				return ErrReservationNotFound
+			case held.Committed:
+				return errUnchanged
+			case stock.OnHand < held.Quantity:
+				return ErrOutOfStock
+			}
+			held.Committed = true
+			stock.Reservations[reservationID] = held
+			stock.OnHand -= held.Quantity
+			return nil
+		})
+		if errors.Is(err, ErrReservationNotFound) || errors.Is(err, ErrOutOfStock) {
+			if releaseErr := i.Release(ctx, reservationID); releaseErr != nil {
+				log.Println("Error releasing stock reservation", reservationID, releaseErr)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return i.deleteReservation(ctx, reservationID)
+}
+
+// Release drops the reservation from the stock of its SKUs, putting back
+// the quantities a half-finished Commit took.
+func (i *elasticInventory) Release(ctx context.Context, reservationID string) error {
+	doc, err := i.getReservation(ctx, reservationID)
+	if err != nil || doc == nil {
+		return err
+	}
+	for _, item := range doc.Items {
+		err = i.modifyStock(ctx, item.SKU, false, func(stock *stockDocument) error {
+			held, ok := stock.Reservations[reservationID]
+			if !ok {
+				return errUnchanged
+			}
+			if held.Committed {
+				stock.OnHand += held.Quantity
+			}
+			delete(stock.Reservations, reservationID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return i.deleteReservation(ctx, reservationID)
+}
+
+// getReservation returns the reservation document, or nil if there is none.
+func (i *elasticInventory) getReservation(ctx context.Context, reservationID string) (*reservationDocument, error) {
+	res, err := i.client.Get().Index(reservationIndex).Id(reservationID).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, elasticError(err)
+	}
+	if !res.Found {
+		return nil, nil
+	}
+	doc := &reservationDocument{}
+	if err := json.Unmarshal(res.Source, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (i *elasticInventory) deleteReservation(ctx context.Context, reservationID string) error {
+	_, err := i.client.Delete().Index(reservationIndex).Id(reservationID).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	return elasticError(err)
+}
+
+// modifyStock applies change to the stock document of the SKU and
+// writes it back if it has not changed since it was read, retrying
+// otherwise. Untracked SKUs are left alone unless create is set, in
+// which case change starts from an empty document. If change fails, nothing
+// is written and its error is returned, unless it is errUnchanged.
+func (i *elasticInventory) modifyStock(ctx context.Context, sku string, create bool, change func(*stockDocument) error) error {
+	for attempt := 0; attempt < stockAttempts; attempt++ {
+		doc := stockDocument{}
+		index := i.client.Index().Index(stockIndex).Id(sku)
+		res, err := i.client.Get().Index(stockIndex).Id(sku).Do(ctx)
+		switch {
+		case elastic.IsNotFound(err) || err == nil && !res.Found:
+			if !create {
+				return nil
+			}
+			index = index.OpType("create")
+		case err != nil:
+			return elasticError(err)
+		default:
+			if err := json.Unmarshal(res.Source, &doc); err != nil {
+				return err
+			}
+			index = index.IfSeqNo(*res.SeqNo).IfPrimaryTerm(*res.PrimaryTerm)
+		}
+
+		if err := change(&doc); errors.Is(err, errUnchanged) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		_, err = index.BodyJson(doc).Do(ctx)
+		if elastic.IsConflict(err) {
+			continue
+		}
+		return elasticError(err)
+	}
+	return ErrStockBusy
+}
@@ -0,0 +1,1110 @@
+// Package elastictest provides an in-memory stand-in for the parts of the
+// Elasticsearch 8 REST API the catalog uses, so the Elasticsearch repository
+// can be tested without a cluster.
+//
+// Like Elasticsearch 8 it has no mapping types: documents live under
+// /{index}/_doc/{id}, and any other path is rejected. Documents can also be
+// indexed in bulk through /_bulk. Writes are visible to
+// searches at once, without waiting for a refresh.
+package elastictest
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// maxResultWindow is the default index.max_result_window of Elasticsearch,
+// the most hits a search can page to.
+const maxResultWindow = 10000
+
+// Server is a running stand-in, closed when the test that started it ends.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	indices map[string]*index
+}
+
+type index struct {
+	mapping map[string]any
+	docs    map[string]*document
+	// seqNo is the sequence number of the last write to the index.
+	seqNo int64
+}
+
+type document struct {
+	source  json.RawMessage
+	version int64
+	seqNo   int64
+}
+
+// NewServer starts an empty stand-in.
+func NewServer(t testing.TB) *Server {
+	s := &Server{indices: map[string]*index{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Mapping returns the mapping of the index, or nil if it does not exist.
+func (s *Server) Mapping(name string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx, ok := s.indices[name]; ok {
+		return idx.mapping
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "_mget":
+		s.multiGet(w, "", body)
+	case len(segments) == 1 && segments[0] == "_bulk":
+		s.bulk(w, "", body)
+	case len(segments) == 1 && segments[0] != "" && !strings.HasPrefix(segments[0], "_"):
+		s.serveIndex(w, r, segments[0], body)
+	case len(segments) == 2 && segments[1] == "_mapping":
+		s.serveMapping(w, r, segments[0], body)
+	case len(segments) == 2 && segments[1] == "_refresh":
+		s.refresh(w, segments[0])
+	case len(segments) == 2 && segments[1] == "_search":
+		s.search(w, segments[0], body)
+	case len(segments) == 2 && segments[1] == "_mget":
+		s.multiGet(w, segments[0], body)
+	case len(segments) == 2 && segments[1] == "_bulk":
+		s.bulk(w, segments[0], body)
+	case len(segments) == 3 && segments[1] == "_doc":
+		s.serveDocument(w, r, segments[0], segments[2], body)
+	default:
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+			fmt.Sprintf("no handler found for uri [%s] and method [%s]", r.URL.Path, r.Method))
+	}
+}
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	switch r.Method {
+	case http.MethodHead:
+		if _, ok := s.indices[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case http.MethodPut:
+		if _, ok := s.indices[name]; ok {
+			writeError(w, http.StatusBadRequest, "resource_already_exists_exception",
+				fmt.Sprintf("index [%s] already exists", name))
+			return
+		}
+		settings := struct {
+			Mappings map[string]any `json:"mappings"`
+		}{}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &settings); err != nil {
+				writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+				return
+			}
+		}
+		if err := checkMapping(settings.Mappings); err != nil {
+			writeError(w, http.StatusBadRequest, "mapper_parsing_exception", err.Error())
+			return
+		}
+		s.indices[name] = newIndex(settings.Mappings)
+		writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true, "index": name})
+	case http.MethodDelete:
+		if _, ok := s.indices[name]; !ok {
+			writeIndexNotFound(w, name)
+			return
+		}
+		delete(s.indices, name)
+		writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", "method not allowed")
+	}
+}
+
+func newIndex(mapping map[string]any) *index {
+	if mapping == nil {
+		mapping = map[string]any{}
+	}
+	return &index{mapping: mapping, docs: map[string]*document{}, seqNo: -1}
+}
+
+// checkMapping rejects the mapping types Elasticsearch 8 no longer accepts,
+// which show up as a single top-level key naming the type.
+func checkMapping(mapping map[string]any) error {
+	for key := range mapping {
+		switch key {
+		case "dynamic", "properties", "_source":
+		default:
+			return fmt.Errorf("root mapping definition has unsupported parameters: [%s]", key)
+		}
+	}
+	return nil
+}
+
+// serveMapping returns the mapping of the index, or adds the properties in
+// body to it. Like Elasticsearch, it never removes or changes a field that is
+// already mapped.
+func (s *Server) serveMapping(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	idx, ok := s.indices[name]
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	if r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]any{name: map[string]any{"mappings": idx.mapping}})
+		return
+	}
+	mapping := map[string]any{}
+	if err := json.Unmarshal(body, &mapping); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	if err := checkMapping(mapping); err != nil {
+		writeError(w, http.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		return
+	}
+	if err := mergeProperties(idx.mapping, mapping); err != nil {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return
+	}
+	if dynamic, ok := mapping["dynamic"]; ok {
+		idx.mapping["dynamic"] = dynamic
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"acknowledged": true})
+}
+
+// mergeProperties adds the properties of added to mapping, descending into
+// object fields, and fails if a field already mapped would change. Like
+// Elasticsearch it checks every field before changing any.
+func mergeProperties(mapping, added map[string]any) error {
+	properties, _ := mapping["properties"].(map[string]any)
+	merged := maps.Clone(properties)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	addedProperties, _ := added["properties"].(map[string]any)
+	for field, raw := range addedProperties {
+		current, ok := merged[field].(map[string]any)
+		m, _ := raw.(map[string]any)
+		_, currentIsObject := current["properties"]
+		_, addedIsObject := m["properties"]
+		switch {
+		case !ok:
+			merged[field] = m
+		case currentIsObject && addedIsObject:
+			object := maps.Clone(current)
+			if err := mergeProperties(object, m); err != nil {
+				return err
+			}
+			merged[field] = object
+		case fmt.Sprint(current) != fmt.Sprint(m):
+			return fmt.Errorf("mapper [%s] cannot be changed", field)
+		}
+	}
+	mapping["properties"] = merged
+	return nil
+}
+
+func (s *Server) refresh(w http.ResponseWriter, name string) {
+	if _, ok := s.indices[name]; !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"_shards": shards()})
+}
+
+func (s *Server) serveDocument(w http.ResponseWriter, r *http.Request, name, id string, body []byte) {
+	switch r.Method {
+	case http.MethodGet:
+		s.getDocument(w, name, id)
+	case http.MethodPut, http.MethodPost:
+		s.indexDocument(w, r, name, id, body)
+	case http.MethodDelete:
+		s.deleteDocument(w, r, name, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "illegal_argument_exception", "method not allowed")
+	}
+}
+
+func (s *Server) getDocument(w http.ResponseWriter, name, id string) {
+	idx, ok := s.indices[name]
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	doc, ok := idx.docs[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": name, "_id": id, "found": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, found(name, id, doc))
+}
+
+func found(name, id string, doc *document) map[string]any {
+	return map[string]any{
+		"_index":        name,
+		"_id":           id,
+		"_version":      doc.version,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+		"found":         true,
+		"_source":       doc.source,
+	}
+}
+
+// indexDocument creates or replaces a document, honouring op_type=create and
+// the if_seq_no and if_primary_term preconditions. A missing index is
+// created with dynamic mapping, as Elasticsearch does by default.
+func (s *Server) indexDocument(w http.ResponseWriter, r *http.Request, name, id string, body []byte) {
+	idx, ok := s.indices[name]
+	if !ok {
+		idx = newIndex(nil)
+		s.indices[name] = idx
+	}
+	source := map[string]any{}
+	if err := json.Unmarshal(body, &source); err != nil {
+		writeError(w, http.StatusBadRequest, "document_parsing_exception", err.Error())
+		return
+	}
+	if err := checkDynamic(idx.mapping, source); err != nil {
+		writeError(w, http.StatusBadRequest, "strict_dynamic_mapping_exception", err.Error())
+		return
+	}
+	existing, exists := idx.docs[id]
+	if r.URL.Query().Get("op_type") == "create" && exists {
+		writeConflict(w, id, "document already exists")
+		return
+	}
+	if !s.preconditionHolds(w, r, id, existing) {
+		return
+	}
+
+	idx.seqNo++
+	doc := &document{source: json.RawMessage(body), version: 1, seqNo: idx.seqNo}
+	status, result := http.StatusCreated, "created"
+	if exists {
+		doc.version = existing.version + 1
+		status, result = http.StatusOK, "updated"
+	}
+	idx.docs[id] = doc
+	writeJSON(w, status, map[string]any{
+		"_index":        name,
+		"_id":           id,
+		"_version":      doc.version,
+		"result":        result,
+		"_seq_no":       doc.seqNo,
+		"_primary_term": 1,
+		"_shards":       shards(),
+	})
+}
+
+// bulk runs the index and create actions of a _bulk request, each with the
+// result it would have had as a request of its own. name is the index of the
+// actions that do not name one. Actions must name their document, as
+// generated ids are not supported.
+func (s *Server) bulk(w http.ResponseWriter, name string, body []byte) {
+	lines := bytes.Split(bytes.TrimRight(body, "\n"), []byte("\n"))
+	if len(lines)%2 != 0 {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", "the bulk request must be terminated by a newline")
+		return
+	}
+	items := []any{}
+	failed := false
+	for i := 0; i < len(lines); i += 2 {
+		action, raw, err := single(lines[i])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("malformed action/metadata line [%d]: %v", i+1, err))
+			return
+		}
+		if action != "index" && action != "create" {
+			writeError(w, http.StatusBadRequest, "illegal_argument_exception",
+				fmt.Sprintf("action [%s] is not supported", action))
+			return
+		}
+		meta := struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{Index: name}
+		if err := json.Unmarshal(raw, &meta); err != nil || meta.Index == "" || meta.ID == "" {
+			writeError(w, http.StatusBadRequest, "action_request_validation_exception",
+				fmt.Sprintf("line [%d] must name an index and an id", i+1))
+			return
+		}
+		target := "/" + meta.Index + "/_doc/" + meta.ID
+		if action == "create" {
+			target += "?op_type=create"
+		}
+		recorder := httptest.NewRecorder()
+		s.indexDocument(recorder, httptest.NewRequest(http.MethodPut, target, nil), meta.Index, meta.ID, lines[i+1])
+		result := map[string]any{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &result); err != nil {
+			writeError(w, http.StatusInternalServerError, "exception", err.Error())
+			return
+		}
+		if recorder.Code >= http.StatusBadRequest {
+			failed = true
+			result = map[string]any{"_index": meta.Index, "_id": meta.ID, "error": result["error"]}
+		}
+		result["status"] = recorder.Code
+		items = append(items, map[string]any{action: result})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"took": 0, "errors": failed, "items": items})
+}
+
+// checkDynamic rejects fields missing from a strict mapping, descending into
+// object fields that map their own properties.
+func checkDynamic(mapping map[string]any, source map[string]any) error {
+	if mapping["dynamic"] != "strict" {
+		return nil
+	}
+	properties, _ := mapping["properties"].(map[string]any)
+	for field, value := range source {
+		m, ok := properties[field].(map[string]any)
+		if !ok {
+			return fmt.Errorf("mapping set to strict, dynamic introduction of [%s] is not allowed", field)
+		}
+		if _, nested := m["properties"]; !nested {
+			continue
+		}
+		objects, _ := value.([]any)
+		if object, ok := value.(map[string]any); ok {
+			objects = []any{object}
+		}
+		for _, o := range objects {
+			object, _ := o.(map[string]any)
+			child := map[string]any{"dynamic": "strict", "properties": m["properties"]}
+			if d, ok := m["dynamic"]; ok {
+				child["dynamic"] = d
+			}
+			if err := checkDynamic(child, object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// preconditionHolds checks if_seq_no and if_primary_term against the stored
+// document, writing a conflict and returning false when they do not match.
+func (s *Server) preconditionHolds(w http.ResponseWriter, r *http.Request, id string, existing *document) bool {
+	query := r.URL.Query()
+	seqNo, term := query.Get("if_seq_no"), query.Get("if_primary_term")
+	if seqNo == "" && term == "" {
+		return true
+	}
+	if seqNo == "" || term == "" {
+		writeError(w, http.StatusBadRequest, "action_request_validation_exception",
+			"if_seq_no and if_primary_term must be set together")
+		return false
+	}
+	wantSeqNo, err := strconv.ParseInt(seqNo, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", err.Error())
+		return false
+	}
+	if existing == nil || existing.seqNo != wantSeqNo || term != "1" {
+		writeConflict(w, id, fmt.Sprintf("required seqNo [%s], primary term [%s]", seqNo, term))
+		return false
+	}
+	return true
+}
+
+func (s *Server) deleteDocument(w http.ResponseWriter, r *http.Request, name, id string) {
+	idx, ok := s.indices[name]
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	existing, exists := idx.docs[id]
+	if !s.preconditionHolds(w, r, id, existing) {
+		return
+	}
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]any{"_index": name, "_id": id, "result": "not_found"})
+		return
+	}
+	idx.seqNo++
+	delete(idx.docs, id)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"_index":        name,
+		"_id":           id,
+		"_version":      existing.version + 1,
+		"result":        "deleted",
+		"_seq_no":       idx.seqNo,
+		"_primary_term": 1,
+		"_shards":       shards(),
+	})
+}
+
+func (s *Server) multiGet(w http.ResponseWriter, name string, body []byte) {
+	request := struct {
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+		IDs []string `json:"ids"`
+	}{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	for _, id := range request.IDs {
+		request.Docs = append(request.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{name, id})
+	}
+	docs := []map[string]any{}
+	for _, d := range request.Docs {
+		if d.Index == "" {
+			d.Index = name
+		}
+		idx, ok := s.indices[d.Index]
+		if !ok {
+			docs = append(docs, map[string]any{"_index": d.Index, "_id": d.ID, "error": map[string]any{
+				"type": "index_not_found_exception", "reason": "no such index [" + d.Index + "]",
+			}})
+			continue
+		}
+		if doc, ok := idx.docs[d.ID]; ok {
+			docs = append(docs, found(d.Index, d.ID, doc))
+		} else {
+			docs = append(docs, map[string]any{"_index": d.Index, "_id": d.ID, "found": false})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"docs": docs})
+}
+
+// search runs a query and its aggregations. The queries are match_all,
+// multi_match, term, range and bool with must, filter and must_not clauses; a
+// multi_match hit scores one point per query term found in any of its
+// fields, and hits with equal scores come back in the order they were
+// written. Hits can instead be sorted by _score or by fields, which for date
+// fields compares the dates. The aggregations are terms and range. Like
+// Elasticsearch, a search cannot reach past the first maxResultWindow hits.
+func (s *Server) search(w http.ResponseWriter, name string, body []byte) {
+	idx, ok := s.indices[name]
+	if !ok {
+		writeIndexNotFound(w, name)
+		return
+	}
+	request := struct {
+		Query        json.RawMessage            `json:"query"`
+		From         int                        `json:"from"`
+		Size         *int                       `json:"size"`
+		Sort         json.RawMessage            `json:"sort"`
+		Aggregations map[string]json.RawMessage `json:"aggregations"`
+		Aggs         map[string]json.RawMessage `json:"aggs"`
+	}{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &request); err != nil {
+			writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+			return
+		}
+	}
+	query := matchAll
+	if len(request.Query) > 0 {
+		var err error
+		if query, err = parseQuery(request.Query); err != nil {
+			writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+			return
+		}
+	}
+
+	keys, err := parseSort(request.Sort)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+		return
+	}
+
+	type hit struct {
+		id     string
+		doc    *document
+		source map[string]any
+		score  float64
+		sort   []any
+	}
+	hits := []hit{}
+	for id, doc := range idx.docs {
+		source := map[string]any{}
+		if err := json.Unmarshal(doc.source, &source); err != nil {
+			writeError(w, http.StatusInternalServerError, "exception", err.Error())
+			return
+		}
+		if score, ok := query(source); ok {
+			hits = append(hits, hit{id: id, doc: doc, source: source, score: score})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].doc.seqNo < hits[j].doc.seqNo
+	})
+	if len(keys) > 0 {
+		for i := range hits {
+			for _, key := range keys {
+				hits[i].sort = append(hits[i].sort, sortValue(idx.mapping, key.field, hits[i].source, hits[i].score))
+			}
+		}
+		sort.SliceStable(hits, func(i, j int) bool {
+			for k, key := range keys {
+				if c := compareSortValues(hits[i].sort[k], hits[j].sort[k], key.descending); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	// Like Elasticsearch, hits sorted by fields alone are not scored.
+	scored := len(keys) == 0
+	for _, key := range keys {
+		scored = scored || key.field == "_score"
+	}
+
+	aggregations := map[string]any{}
+	if request.Aggregations == nil {
+		request.Aggregations = request.Aggs
+	}
+	for aggName, raw := range request.Aggregations {
+		sources := make([]map[string]any, len(hits))
+		for i, h := range hits {
+			sources[i] = h.source
+		}
+		result, err := aggregate(raw, sources)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "parsing_exception", err.Error())
+			return
+		}
+		aggregations[aggName] = result
+	}
+
+	size := 10
+	if request.Size != nil {
+		size = *request.Size
+	}
+	if request.From+size > maxResultWindow {
+		writeError(w, http.StatusBadRequest, "illegal_argument_exception", fmt.Sprintf(
+			"Result window is too large, from + size must be less than or equal to: [%d] but was [%d]",
+			maxResultWindow, request.From+size,
+		))
+		return
+	}
+	total := len(hits)
+	var maxScore any
+	if scored {
+		best := 0.0
+		for _, h := range hits {
+			best = max(best, h.score)
+		}
+		maxScore = best
+	}
+	start := min(max(request.From, 0), len(hits))
+	hits = hits[start:min(start+max(size, 0), len(hits))]
+	page := []map[string]any{}
+	for _, h := range hits {
+		result := map[string]any{
+			"_index":  name,
+			"_id":     h.id,
+			"_score":  nil,
+			"_source": h.doc.source,
+		}
+		if scored {
+			result["_score"] = h.score
+		}
+		if len(keys) > 0 {
+			sortValues := []any{}
+			for _, v := range h.sort {
+				if t, ok := v.(time.Time); ok {
+					v = t.UnixMilli()
+				}
+				sortValues = append(sortValues, v)
+			}
+			result["sort"] = sortValues
+		}
+		page = append(page, result)
+	}
+	response := map[string]any{
+		"took":      1,
+		"timed_out": false,
+		"_shards":   shards(),
+		"hits": map[string]any{
+			"total":     map[string]any{"value": total, "relation": "eq"},
+			"max_score": maxScore,
+			"hits":      page,
+		},
+	}
+	if len(aggregations) > 0 {
+		response["aggregations"] = aggregations
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// sortKey is a field hits are sorted by, or _score.
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+// parseSort parses a sort, which is a field name, an object of a field name
+// and its order, or an array of either.
+func parseSort(raw json.RawMessage) ([]sortKey, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	list := []json.RawMessage{}
+	if err := json.Unmarshal(raw, &list); err != nil {
+		list = []json.RawMessage{raw}
+	}
+	keys := []sortKey{}
+	for _, raw := range list {
+		var field string
+		if err := json.Unmarshal(raw, &field); err == nil {
+			keys = append(keys, sortKey{field: field, descending: field == "_score"})
+			continue
+		}
+		field, body, err := single(raw)
+		if err != nil {
+			return nil, err
+		}
+		options := struct {
+			Order string `json:"order"`
+		}{}
+		if err := json.Unmarshal(body, &options.Order); err != nil {
+			if err := json.Unmarshal(body, &options); err != nil {
+				return nil, err
+			}
+		}
+		key := sortKey{field: field, descending: field == "_score"}
+		switch options.Order {
+		case "":
+		case "asc":
+			key.descending = false
+		case "desc":
+			key.descending = true
+		default:
+			return nil, fmt.Errorf("unknown sort order [%s]", options.Order)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortValue returns what a hit is sorted by for field: its score, a date for
+// date fields, the first value of other fields, or nil if it has none.
+func sortValue(mapping map[string]any, field string, source map[string]any, score float64) any {
+	if field == "_score" {
+		return score
+	}
+	v := values(source, field)
+	if len(v) == 0 {
+		return nil
+	}
+	properties, _ := mapping["properties"].(map[string]any)
+	if m, _ := properties[field].(map[string]any); m["type"] == "date" {
+		text, _ := v[0].(string)
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil
+		}
+		return t
+	}
+	return v[0]
+}
+
+// compareSortValues orders a before b in the direction asked for, except that
+// missing values come last either way.
+func compareSortValues(a, b any, descending bool) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	var c int
+	switch a := a.(type) {
+	case float64:
+		b, _ := b.(float64)
+		c = cmp.Compare(a, b)
+	case string:
+		b, _ := b.(string)
+		c = strings.Compare(a, b)
+	case time.Time:
+		b, _ := b.(time.Time)
+		c = a.Compare(b)
+	}
+	if descending {
+		return -c
+	}
+	return c
+}
+
+// query reports whether a document's source matches, and its score.
+type query func(source map[string]any) (float64, bool)
+
+func matchAll(map[string]any) (float64, bool) { return 1, true }
+
+// single returns the only key of a JSON object and its value.
+func single(raw json.RawMessage) (string, json.RawMessage, error) {
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return "", nil, err
+	}
+	if len(object) != 1 {
+		return "", nil, fmt.Errorf("expected a single key, got %d", len(object))
+	}
+	var key string
+	for key = range object {
+	}
+	return key, object[key], nil
+}
+
+func parseQuery(raw json.RawMessage) (query, error) {
+	kind, body, err := single(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "match_all":
+		return matchAll, nil
+	case "multi_match":
+		mm := struct {
+			Query  string   `json:"query"`
+			Fields []string `json:"fields"`
+		}{}
+		if err := json.Unmarshal(body, &mm); err != nil {
+			return nil, err
+		}
+		terms := tokenize(mm.Query)
+		return func(source map[string]any) (float64, bool) {
+			tokens := map[string]bool{}
+			for _, field := range mm.Fields {
+				text, _ := source[field].(string)
+				for _, t := range tokenize(text) {
+					tokens[t] = true
+				}
+			}
+			var score float64
+			for _, t := range terms {
+				if tokens[t] {
+					score++
+				}
+			}
+			return score, score > 0
+		}, nil
+	case "term":
+		field, raw, err := single(body)
+		if err != nil {
+			return nil, err
+		}
+		// The value is given either as is or as {"value": ...}.
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		if object, ok := value.(map[string]any); ok {
+			value = object["value"]
+		}
+		return func(source map[string]any) (float64, bool) {
+			for _, v := range values(source, field) {
+				if v == value {
+					return 1, true
+				}
+			}
+			return 0, false
+		}, nil
+	case "terms":
+		field, raw, err := single(body)
+		if err != nil {
+			return nil, err
+		}
+		list := []any{}
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, err
+		}
+		wanted := map[any]bool{}
+		for _, v := range list {
+			wanted[v] = true
+		}
+		return func(source map[string]any) (float64, bool) {
+			for _, v := range values(source, field) {
+				if wanted[v] {
+					return 1, true
+				}
+			}
+			return 0, false
+		}, nil
+	case "range":
+		field, raw, err := single(body)
+		if err != nil {
+			return nil, err
+		}
+		// Bounds are given either as gt, gte, lt and lte, or as from and to
+		// with include_lower and include_upper, the way older clients send
+		// them.
+		r := struct {
+			From         *float64 `json:"from"`
+			To           *float64 `json:"to"`
+			IncludeLower *bool    `json:"include_lower"`
+			IncludeUpper *bool    `json:"include_upper"`
+			Gt           *float64 `json:"gt"`
+			Gte          *float64 `json:"gte"`
+			Lt           *float64 `json:"lt"`
+			Lte          *float64 `json:"lte"`
+		}{}
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, err
+		}
+		lower, includeLower := r.From, r.IncludeLower == nil || *r.IncludeLower
+		upper, includeUpper := r.To, r.IncludeUpper == nil || *r.IncludeUpper
+		if r.Gt != nil {
+			lower, includeLower = r.Gt, false
+		}
+		if r.Gte != nil {
+			lower, includeLower = r.Gte, true
+		}
+		if r.Lt != nil {
+			upper, includeUpper = r.Lt, false
+		}
+		if r.Lte != nil {
+			upper, includeUpper = r.Lte, true
+		}
+		return func(source map[string]any) (float64, bool) {
+			for _, v := range values(source, field) {
+				n, ok := v.(float64)
+				if !ok {
+					continue
+				}
+				if lower != nil && (n < *lower || n == *lower && !includeLower) {
+					continue
+				}
+				if upper != nil && (n > *upper || n == *upper && !includeUpper) {
+					continue
+				}
+				return 1, true
+			}
+			return 0, false
+		}, nil
+	case "bool":
+		clauses := map[string]json.RawMessage{}
+		if err := json.Unmarshal(body, &clauses); err != nil {
+			return nil, err
+		}
+		parsed := map[string][]query{}
+		for occur, raw := range clauses {
+			switch occur {
+			case "must", "filter", "must_not":
+			default:
+				return nil, fmt.Errorf("unknown bool clause [%s]", occur)
+			}
+			list := []json.RawMessage{}
+			if err := json.Unmarshal(raw, &list); err != nil {
+				list = []json.RawMessage{raw}
+			}
+			for _, q := range list {
+				p, err := parseQuery(q)
+				if err != nil {
+					return nil, err
+				}
+				parsed[occur] = append(parsed[occur], p)
+			}
+		}
+		return func(source map[string]any) (float64, bool) {
+			var score float64
+			for _, q := range parsed["must"] {
+				s, ok := q(source)
+				if !ok {
+					return 0, false
+				}
+				score += s
+			}
+			for _, q := range parsed["filter"] {
+				if _, ok := q(source); !ok {
+					return 0, false
+				}
+			}
+			for _, q := range parsed["must_not"] {
+				if _, ok := q(source); ok {
+					return 0, false
+				}
+			}
+			return score, true
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown query [%s]", kind)
+}
+
+// values returns the values of a field of source, which may be a single
+// value or an array of them. A dotted field names a field of an object
+// field, gathered from every object of an array.
+func values(source map[string]any, field string) []any {
+	name, rest, dotted := strings.Cut(field, ".")
+	found := []any{}
+	if list, ok := source[name].([]any); ok {
+		found = list
+	} else if source[name] != nil {
+		found = []any{source[name]}
+	}
+	if !dotted {
+		return found
+	}
+	inner := []any{}
+	for _, v := range found {
+		if object, ok := v.(map[string]any); ok {
+			inner = append(inner, values(object, rest)...)
+		}
+	}
+	return inner
+}
+
+// aggregate runs a terms or range aggregation over the sources of the hits.
+// Terms buckets come most common first, like Elasticsearch orders them.
+func aggregate(raw json.RawMessage, sources []map[string]any) (map[string]any, error) {
+	kind, body, err := single(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "terms":
+		terms := struct {
+			Field string `json:"field"`
+			Size  *int   `json:"size"`
+		}{}
+		if err := json.Unmarshal(body, &terms); err != nil {
+			return nil, err
+		}
+		counts := map[string]int{}
+		for _, source := range sources {
+			seen := map[string]bool{}
+			for _, v := range values(source, terms.Field) {
+				key := fmt.Sprint(v)
+				if !seen[key] {
+					seen[key] = true
+					counts[key]++
+				}
+			}
+		}
+		keys := make([]string, 0, len(counts))
+		for key := range counts {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if counts[keys[i]] != counts[keys[j]] {
+				return counts[keys[i]] > counts[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		size, other := 10, 0
+		if terms.Size != nil {
+			size = *terms.Size
+		}
+		if len(keys) > size {
+			for _, key := range keys[size:] {
+				other += counts[key]
+			}
+			keys = keys[:size]
+		}
+		buckets := []map[string]any{}
+		for _, key := range keys {
+			buckets = append(buckets, map[string]any{"key": key, "doc_count": counts[key]})
+		}
+		return map[string]any{"doc_count_error_upper_bound": 0, "sum_other_doc_count": other, "buckets": buckets}, nil
+	case "range":
+		ranges := struct {
+			Field  string `json:"field"`
+			Ranges []struct {
+				From *float64 `json:"from"`
+				To   *float64 `json:"to"`
+			} `json:"ranges"`
+		}{}
+		if err := json.Unmarshal(body, &ranges); err != nil {
+			return nil, err
+		}
+		buckets := []map[string]any{}
+		for _, r := range ranges.Ranges {
+			bucket, key, count := map[string]any{}, "*", 0
+			if r.From != nil {
+				bucket["from"], key = *r.From, strconv.FormatFloat(*r.From, 'f', 1, 64)
+			}
+			key += "-"
+			if r.To != nil {
+				bucket["to"], key = *r.To, key+strconv.FormatFloat(*r.To, 'f', 1, 64)
+			} else {
+				key += "*"
+			}
+			for _, source := range sources {
+				for _, v := range values(source, ranges.Field) {
+					n, ok := v.(float64)
+					if ok && (r.From == nil || n >= *r.From) && (r.To == nil || n < *r.To) {
+						count++
+						break
+					}
+				}
+			}
+			bucket["key"], bucket["doc_count"] = key, count
+			buckets = append(buckets, bucket)
+		}
+		return map[string]any{"buckets": buckets}, nil
+	}
+	return nil, fmt.Errorf("unknown aggregation [%s]", kind)
+}
+
+// tokenize splits text into lower-case words, roughly as the standard
+// analyzer does.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func shards() map[string]any {
+	return map[string]any{"total": 1, "successful": 1, "failed": 0}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the shape Elasticsearch uses.
+func writeError(w http.ResponseWriter, status int, kind, reason string) {
+	cause := map[string]any{"type": kind, "reason": reason}
+	writeJSON(w, status, map[string]any{
+		"error":  map[string]any{"root_cause": []any{cause}, "type": kind, "reason": reason},
+		"status": status,
+	})
+}
+
+func writeIndexNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, "index_not_found_exception", "no such index ["+name+"]")
+}
+
+func writeConflict(w http.ResponseWriter, id, reason string) {
+	writeError(w, http.StatusConflict, "version_conflict_engine_exception", "["+id+"]: version conflict, "+reason)
+}
@@ -0,0 +1,100 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/money"
+)
+
+// ProductImport is one row of a bulk import: a product to create.
+type ProductImport struct {
+	Name        string
+	Description string
+	Price       money.Money
+	Category    string
+	Tags        []string
+	Variants    []Variant
+}
+
+// ImportResult is the outcome of one imported row. Row is the row's 1-based
+// position in the import, and Err says why the row was not imported.
+type ImportResult struct {
+	Row     int
+	Product Product
+	Err     error
+}
+
+// ImportProducts creates a product for every valid row and writes them to
+// the repository in one batch. Rows that are invalid, or that have a SKU
+// another product or an earlier row has, are reported in their result
+// instead of failing the import, as are rows the repository rejects. As for
+// PostProduct, SKUs written to Elasticsearch moments before may not be seen
+// yet.
+func (c *catalogService) ImportProducts(ctx context.Context, rows []ProductImport) ([]ImportResult, error) {
+	results := make([]ImportResult, len(rows))
+	products := make([]Product, len(rows))
+	skus := []string{}
+	claimed := map[string]bool{}
+	for i, row := range rows {
+		results[i].Row = i + 1
+		products[i], results[i].Err = newProduct(row.Name, row.Description, row.Price, row.Category, row.Tags, row.Variants)
+		if results[i].Err != nil {
+			continue
+		}
+		for _, v := range products[i].Variants {
+			if claimed[v.SKU] {
+				results[i].Err = ErrSKUExists
+			}
+		}
+		if results[i].Err != nil {
+			continue
+		}
+		for _, v := range products[i].Variants {
+			claimed[v.SKU] = true
+			skus = append(skus, v.SKU)
+		}
+	}
+
+	// One lookup covers the SKUs of every row.
+	owners, err := c.repository.ListProductsWithSKUs(ctx, skus)
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, owner := range *owners {
+		for _, v := range owner.Variants {
+			owned[v.SKU] = true
+		}
+	}
+
+	valid := []Product{}
+	positions := []int{}
+	for i := range rows {
+		if results[i].Err != nil {
+			continue
+		}
+		for _, v := range products[i].Variants {
+			if owned[v.SKU] {
+				results[i].Err = ErrSKUExists
+			}
+		}
+		if results[i].Err == nil {
+			valid = append(valid, products[i])
+			positions = append(positions, i)
+		}
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+	productErrs, err := c.repository.PutProducts(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range positions {
+		if productErrs[j] != nil {
+			results[i].Err = productErrs[j]
+			continue
+		}
+		results[i].Product = products[i]
+	}
+	return results, nil
+}
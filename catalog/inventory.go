@@ -0,0 +1,147 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/segmentio/ksuid"
+	"sort"
+	"time"
+)
+
+var (
+	ErrOutOfStock          = errs.New(errs.FailedPrecondition, "not enough stock")
+	ErrReservationNotFound = errs.New(errs.NotFound, "stock reservation not found or expired")
+	ErrInvalidReservation  = errs.New(errs.InvalidArgument, "a reservation needs at least one SKU, positive quantities and a time to live of at most 24h")
+	ErrStockBusy           = errs.New(errs.Aborted, "stock is changing too fast; try again")
+)
+
+const (
+	// DefaultReservationTTL is how long a reservation holds stock when its
+	// caller does not say.
+	DefaultReservationTTL = 15 * time.Minute
+	// MaxReservationTTL is the longest a reservation can hold stock.
+	MaxReservationTTL = 24 * time.Hour
+)
+
+// Stock is the stock level of a SKU: the SKU of a variant, or the id of a
+// product without variants. SKUs whose stock was never set are not tracked,
+// and any quantity of them can be reserved.
+type Stock struct {
+	SKU     string
+	Tracked bool
+	OnHand  uint64
+	// Reserved is the quantity held by reservations that have not expired.
+	Reserved uint64
+}
+
+// Available is the quantity that can still be reserved.
+func (s Stock) Available() uint64 {
+	if s.Reserved >= s.OnHand {
+		return 0
+	}
+	return s.OnHand - s.Reserved
+}
+
+// StockItem is a quantity of a SKU.
+type StockItem struct {
+	SKU      string
+	Quantity uint64
+}
+
+// Reservation holds stock until it expires. Committing it takes the stock
+// out of the inventory; releasing it, or letting it expire, makes the stock
+// available again.
+type Reservation struct {
+	ID string
+	// Items name distinct SKUs, in order.
+	Items     []StockItem
+	ExpiresAt time.Time
+}
+
+// Inventory keeps the stock levels of SKUs and the reservations held against
+// them.
+type Inventory interface {
+	Close()
+	// SetStock sets the quantity of a SKU on hand, tracking it from then on.
+	SetStock(ctx context.Context, sku string, onHand uint64) error
+	// GetStock returns the stock of the SKUs, in the order given.
+	GetStock(ctx context.Context, skus []string) ([]Stock, error)
+	// Reserve holds all the items of the reservation or, failing with
+	// ErrOutOfStock, none of them. Items of untracked SKUs always succeed.
+	Reserve(ctx context.Context, reservation Reservation) error
+	// Commit takes the reserved items out of stock. It fails with
+	// ErrReservationNotFound if the reservation expired or was committed or
+	// released. If a SKU's stock was set below what the reservation holds
+	// of it, it fails with ErrOutOfStock and the reservation is released.
+	Commit(ctx context.Context, reservationID string) error
+	// Release gives the reserved items back. Releasing a reservation that is
+	// already gone is not an error.
+	Release(ctx context.Context, reservationID string) error
+}
+
+// SetStock sets the quantity on hand of the SKU of a variant, or of a
+// product without variants.
+func (c *catalogService) SetStock(ctx context.Context, sku string, onHand uint64) (Stock, error) {
+	if err := c.checkStockSKU(ctx, sku); err != nil {
+		return Stock{}, err
+	}
+	if err := c.inventory.SetStock(ctx, sku, onHand); err != nil {
+		return Stock{}, err
+	}
+	stock, err := c.inventory.GetStock(ctx, []string{sku})
+	if err != nil {
+		return Stock{}, err
+	}
+	return stock[0], nil
+}
+
+func (c *catalogService) GetStock(ctx context.Context, skus []string) ([]Stock, error) {
+	return c.inventory.GetStock(ctx, skus)
+}
+
+// ReserveStock holds the items for ttl, or DefaultReservationTTL if ttl is
+// zero. Quantities of the same SKU are added up.
+func (c *catalogService) ReserveStock(ctx context.Context, items []StockItem, ttl time.Duration) (Reservation, error) {
+	if ttl == 0 {
+		ttl = DefaultReservationTTL
+	}
+	if len(items) == 0 || ttl < 0 || ttl > MaxReservationTTL {
+		return Reservation{}, ErrInvalidReservation
+	}
+	quantities := map[string]uint64{}
+	for _, item := range items {
+		if item.SKU == "" || item.Quantity == 0 {
+			return Reservation{}, ErrInvalidReservation
+		}
+		quantities[item.SKU] += item.Quantity
+	}
+	reservation := Reservation{
+		ID:        ksuid.New().String(),
+		ExpiresAt: time.Now().UTC().Add(ttl).Truncate(time.Microsecond),
+	}
+	for sku, quantity := range quantities {
+		reservation.Items = append(reservation.Items, StockItem{SKU: sku, Quantity: quantity})
+	}
+	// A fixed order keeps concurrent reservations from deadlocking.
+	sort.Slice(reservation.Items, func(i, j int) bool {
+		return reservation.Items[i].SKU < reservation.Items[j].SKU
+	})
+	if err := c.inventory.Reserve(ctx, reservation); err != nil {
+		return Reservation{}, err
+	}
+	return reservation, nil
+}
+
+func (c *catalogService) CommitReservation(ctx context.Context, reservationID string) error {
+	if reservationID == "" {
+		return ErrReservationNotFound
+	}
+	return c.inventory.Commit(ctx, reservationID)
+}
+
+func (c *catalogService) ReleaseReservation(ctx context.Context, reservationID string) error {
+	if reservationID == "" {
+		return nil
+	}
+	return c.inventory.Release(ctx, reservationID)
+}
@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryInventory keeps stock in process memory, for tests.
+type memoryInventory struct {
+	mu sync.Mutex
+	// onHand holds the tracked SKUs.
+	onHand       map[string]uint64
+	reservations map[string]Reservation
+}
+
+func NewMemoryInventory() Inventory {
+	return &memoryInventory{onHand: map[string]uint64{}, reservations: map[string]Reservation{}}
+}
+
+func (i *memoryInventory) Close() {
+}
+
+func (i *memoryInventory) SetStock(ctx context.Context, sku string, onHand uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.onHand[sku] = onHand
+	return nil
+}
+
+func (i *memoryInventory) GetStock(ctx context.Context, skus []string) ([]Stock, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	reserved := i.reserved(time.Now())
+	stock := []Stock{}
+	for _, id := range skus {
+		onHand, tracked := i.onHand[id]
+		s := Stock{SKU: id, Tracked: tracked}
+		if tracked {
+			s.OnHand, s.Reserved = onHand, reserved[id]
+		}
+		stock = append(stock, s)
+	}
+	return stock, nil
+}
+
+// reserved sums the quantities of every SKU held by reservations that
+// have not expired by now, dropping the ones that have; callers hold i.mu.
+func (i *memoryInventory) reserved(now time.Time) map[string]uint64 {
+	reserved := map[string]uint64{}
+	for id, r := range i.reservations {
+		if !now.Before(r.ExpiresAt) {
+			delete(i.reservations, id)
+			continue
+		}
+		for _, item := range r.Items {
+			reserved[item.SKU] += item.Quantity
+		}
+	}
+	return reserved
+}
+
+func (i *memoryInventory) Reserve(ctx context.Context, reservation Reservation) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	reserved := i.reserved(time.Now())
+	for _, item := range reservation.Items {
+		onHand, tracked := i.onHand[item.SKU]
+		if tracked && (Stock{OnHand: onHand, Reserved: reserved[item.SKU]}).Available() < item.Quantity {
+			return ErrOutOfStock
+		}
+	}
+	i.reservations[reservation.ID] = reservation
+	return nil
+}
+
+func (i *memoryInventory) Commit(ctx context.Context, reservationID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.reserved(time.Now())
+	r, ok := i.reservations[reservationID]
+	if !ok {
+		return ErrReservationNotFound
+	}
+	delete(i.reservations, reservationID)
+	for _, item := range r.Items {
+		if onHand, tracked := i.onHand[item.SKU]; tracked && onHand < item.Quantity {
+			return ErrOutOfStock
+		}
+	}
+	for _, item := range r.Items {
+		if onHand, tracked := i.onHand[item.SKU]; tracked {
+			i.onHand[item.SKU] = onHand - item.Quantity
+		}
+	}
+	return nil
+}
+
+func (i *memoryInventory) Release(ctx context.Context, reservationID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.reservations, reservationID)
+	return nil
+}
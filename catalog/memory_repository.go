@@ -0,0 +1,269 @@
+package catalog
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// memoryRepository keeps products in process memory. It mirrors
+// elasticRepository closely enough to exercise the service without a cluster:
+// search matches whole words of name and description, ignoring case, and
+// ranks products by how many query words they contain.
+type memoryRepository struct {
+	mu       sync.RWMutex
+	products map[string]Product
+	// versions holds the version of every product, which, as with
+	// elasticRepository, only reads by id return.
+	versions map[string]string
+	// seqNo counts the writes, like the sequence number of a shard.
+	seqNo int64
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{products: map[string]Product{}, versions: map[string]string{}}
+}
+
+// write stores product under a new version; callers hold r.mu.
+func (r *memoryRepository) write(product Product) Product {
+	product.Version = ""
+	// Keep the caller from changing the stored tags and variants.
+	product.Tags = slices.Clone(product.Tags)
+	product.Variants = cloneVariants(product.Variants)
+	r.products[product.Id] = product
+	product.Version = version(1, r.seqNo)
+	r.versions[product.Id] = product.Version
+	r.seqNo++
+	return product
+}
+
+// cloneVariants copies variants along with their attributes.
+func cloneVariants(variants []Variant) []Variant {
+	if variants == nil {
+		return nil
+	}
+	clones := make([]Variant, len(variants))
+	for i, v := range variants {
+		clones[i] = v
+		clones[i].Attributes = maps.Clone(v.Attributes)
+	}
+	return clones
+}
+
+func (r *memoryRepository) Close() {
+}
+
+func (r *memoryRepository) PutProduct(ctx context.Context, product Product) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.write(product)
+	return nil
+}
+
+func (r *memoryRepository) PutProducts(ctx context.Context, products []Product) ([]error, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range products {
+		r.write(p)
+	}
+	return make([]error, len(products)), nil
+}
+
+func (r *memoryRepository) GetProductByID(ctx context.Context, productID string) (Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.products[productID]
+	if !ok {
+		return Product{}, ErrNotFound
+	}
+	p.Version = r.versions[productID]
+	return p, nil
+}
+
+func (r *memoryRepository) UpdateProduct(ctx context.Context, product Product) (Product, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkVersion(product.Id, product.Version); err != nil {
+		return Product{}, err
+	}
+	return r.write(product), nil
+}
+
+func (r *memoryRepository) DeleteProduct(ctx context.Context, productID string, version string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.products[productID]; !ok {
+		return ErrNotFound
+	}
+	if version != "" {
+		if err := r.checkVersion(productID, version); err != nil {
+			return err
+		}
+	}
+	delete(r.products, productID)
+	delete(r.versions, productID)
+	r.seqNo++
+	return nil
+}
+
+// checkVersion fails the way a conditional write to Elasticsearch does:
+// a malformed version is invalid, and a missing product or one at another
+// version is a conflict.
+func (r *memoryRepository) checkVersion(productID string, version string) error {
+	if _, _, err := parseVersion(version); err != nil {
+		return err
+	}
+	if _, ok := r.products[productID]; !ok || r.versions[productID] != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+func (r *memoryRepository) ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	products := []Product{}
+	for _, p := range r.products {
+		products = append(products, p)
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Id < products[j].Id })
+	return page(products, skip, take), nil
+}
+
+func (r *memoryRepository) ListProductsWithIDs(ctx context.Context, productIDs []string) (*[]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	products := []Product{}
+	for _, id := range productIDs {
+		if p, ok := r.products[id]; ok {
+			products = append(products, p)
+		}
+	}
+	return &products, nil
+}
+
+func (r *memoryRepository) ListProductsWithSKUs(ctx context.Context, skus []string) (*[]Product, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	products := []Product{}
+	for _, p := range r.products {
+		if slices.ContainsFunc(p.Variants, func(v Variant) bool { return slices.Contains(skus, v.SKU) }) {
+			products = append(products, p)
+		}
+	}
+	sort.Slice(products, func(i, j int) bool { return products[i].Id < products[j].Id })
+	return &products, nil
+}
+
+func (r *memoryRepository) SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error) {
+	terms := words(search.Query)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type hit struct {
+		product Product
+		score   int
+	}
+	hits := []hit{}
+	for _, p := range r.products {
+		if !matches(p, search) {
+			continue
+		}
+		productWords := map[string]bool{}
+		for _, w := range words(p.Name + " " + p.Description) {
+			productWords[w] = true
+		}
+		score := 0
+		for _, term := range terms {
+			if productWords[term] {
+				score++
+			}
+		}
+		if score > 0 || len(terms) == 0 {
+			hits = append(hits, hit{product: p, score: score})
+		}
+	}
+	slices.SortFunc(hits, func(a, b hit) int {
+		var c int
+		switch search.Sort {
+		case SortPrice:
+			c = cmp.Or(
+				strings.Compare(a.product.Price.Currency, b.product.Price.Currency),
+				cmp.Compare(a.product.Price.Amount, b.product.Price.Amount),
+			)
+		case SortName:
+			c = strings.Compare(strings.ToLower(a.product.Name), strings.ToLower(b.product.Name))
+		case SortCreatedAt:
+			c = a.product.CreatedAt.Compare(b.product.CreatedAt)
+		default:
+			c = cmp.Compare(a.score, b.score)
+		}
+		if search.Direction == SortDescending {
+			c = -c
+		}
+		if c == 0 {
+			c = strings.Compare(a.product.Id, b.product.Id)
+		}
+		return c
+	})
+
+	products := make([]Product, len(hits))
+	categories, tags := map[string]uint64{}, map[string]uint64{}
+	facets := Facets{Prices: priceBuckets()}
+	for i, h := range hits {
+		products[i] = h.product
+		for _, c := range categoryPath(h.product.Category) {
+			categories[c]++
+		}
+		for _, t := range h.product.Tags {
+			tags[t]++
+		}
+		facets.Prices[priceBucket(h.product.Price)].Count++
+	}
+	facets.Categories = sortFacetCounts(categories)
+	facets.Tags = sortFacetCounts(tags)
+	return page(products, skip, take), facets, nil
+}
+
+// matches reports whether the product passes the category, tag and price
+// filters of search.
+func matches(p Product, search ProductSearch) bool {
+	if search.MinPrice != nil && (p.Price.Currency != search.MinPrice.Currency || p.Price.Amount < search.MinPrice.Amount) {
+		return false
+	}
+	if search.MaxPrice != nil && (p.Price.Currency != search.MaxPrice.Currency || p.Price.Amount > search.MaxPrice.Amount) {
+		return false
+	}
+	if search.Category != "" && !slices.Contains(categoryPath(p.Category), search.Category) {
+		return false
+	}
+	for _, tag := range search.Tags {
+		if !slices.Contains(p.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// words splits text into lowercase words the way Elasticsearch's standard
+// analyzer roughly does.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func page(products []Product, skip uint64, take uint64) *[]Product {
+	if skip >= uint64(len(products)) {
+		return &[]Product{}
+	}
+	products = products[skip:]
+	if take < uint64(len(products)) {
+		products = products[:take]
+	}
+	return &products
+}
@@ -0,0 +1,20 @@
+package catalog_test
+
+import (
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/catalog/catalogtest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	catalogtest.TestRepository(t, func(t *testing.T) catalog.Repository {
+		return catalog.NewMemoryRepository()
+	})
+}
+
+func TestMemoryInventory(t *testing.T) {
+	catalogtest.TestInventory(t, func(t *testing.T) catalog.Inventory {
+		return catalog.NewMemoryInventory()
+	})
+}
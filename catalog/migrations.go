@@ -0,0 +1,13 @@
+package catalog
+
+import (
+	"embed"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations is the schema history of the catalog database, applied by
+// cmd/catalog on startup when products are kept in Postgres.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS products;
+DROP SEQUENCE IF EXISTS products_seq_no;
@@ -0,0 +1,18 @@
+-- Every write to a product takes the next number of this sequence, which
+-- versions products the way Elasticsearch sequence numbers do.
+CREATE SEQUENCE IF NOT EXISTS products_seq_no;
+
+CREATE TABLE IF NOT EXISTS products (
+    id CHAR(27) PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL,
+    price DOUBLE PRECISION NOT NULL,
+    seq_no BIGINT NOT NULL DEFAULT nextval('products_seq_no'),
+    -- Matches in the name rank above matches in the description.
+    search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED
+);
+
+CREATE INDEX IF NOT EXISTS products_search_idx ON products USING gin (search);
@@ -0,0 +1,9 @@
+-- Keys and responses of idempotent calls, see the idempotency package.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    idempotency_key CHAR(64) PRIMARY KEY,
+    request_hash CHAR(64) NOT NULL,
+    response BYTEA,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
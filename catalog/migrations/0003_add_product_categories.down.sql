@@ -0,0 +1,4 @@
+ALTER TABLE products
+    DROP COLUMN IF EXISTS category,
+    DROP COLUMN IF EXISTS category_path,
+    DROP COLUMN IF EXISTS tags;
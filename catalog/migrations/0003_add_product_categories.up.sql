@@ -0,0 +1,9 @@
+-- category_path holds the category and its ancestors, so filtering and
+-- counting by a category includes its subcategories.
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS category_path TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS products_category_path_idx ON products USING gin (category_path);
+CREATE INDEX IF NOT EXISTS products_tags_idx ON products USING gin (tags);
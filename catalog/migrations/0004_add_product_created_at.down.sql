@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS products_created_at_idx;
+DROP INDEX IF EXISTS products_name_sort_idx;
+DROP INDEX IF EXISTS products_price_idx;
+
+ALTER TABLE products DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,9 @@
+-- Products posted before created_at was added get the time of the migration.
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Searches sort by these. Names sort ignoring case, in code point order like
+-- Elasticsearch keywords.
+CREATE INDEX IF NOT EXISTS products_price_idx ON products (price);
+CREATE INDEX IF NOT EXISTS products_name_sort_idx ON products ((lower(name) COLLATE "C"));
+CREATE INDEX IF NOT EXISTS products_created_at_idx ON products (created_at);
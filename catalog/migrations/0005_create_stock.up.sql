@@ -0,0 +1,19 @@
+-- A product's stock is tracked once it has a row here. Products without one
+-- can be ordered in any quantity.
+CREATE TABLE IF NOT EXISTS stock (
+    product_id CHAR(27) PRIMARY KEY,
+    on_hand BIGINT NOT NULL CHECK (on_hand >= 0)
+);
+
+-- Every product of a reservation has a row, tracked or not, until the
+-- reservation is committed or released. Expired rows are ignored, and
+-- removed by the next reservation of the product.
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id CHAR(27) NOT NULL,
+    product_id CHAR(27) NOT NULL,
+    quantity BIGINT NOT NULL CHECK (quantity > 0),
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id, product_id)
+);
+
+CREATE INDEX IF NOT EXISTS stock_reservations_product_id_idx ON stock_reservations (product_id, expires_at);
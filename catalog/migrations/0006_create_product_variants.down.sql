@@ -0,0 +1,10 @@
+-- The stock of variants is dropped along with them.
+DELETE FROM stock_reservations WHERE sku NOT IN (SELECT id::text FROM products);
+DELETE FROM stock WHERE sku NOT IN (SELECT id::text FROM products);
+ALTER INDEX IF EXISTS stock_reservations_sku_idx RENAME TO stock_reservations_product_id_idx;
+ALTER TABLE stock_reservations ALTER COLUMN sku TYPE CHAR(27);
+ALTER TABLE stock_reservations RENAME COLUMN sku TO product_id;
+ALTER TABLE stock ALTER COLUMN sku TYPE CHAR(27);
+ALTER TABLE stock RENAME COLUMN sku TO product_id;
+
+DROP TABLE IF EXISTS product_variants;
@@ -0,0 +1,19 @@
+-- SKUs are unique across the catalog. position keeps the variants of a
+-- product in the order they were given.
+CREATE TABLE IF NOT EXISTS product_variants (
+    sku TEXT PRIMARY KEY,
+    product_id CHAR(27) NOT NULL REFERENCES products (id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    price DOUBLE PRECISION NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS product_variants_product_id_idx ON product_variants (product_id, position);
+
+-- Stock is kept per SKU: the SKU of a variant, or the id of a product
+-- without variants.
+ALTER TABLE stock RENAME COLUMN product_id TO sku;
+ALTER TABLE stock ALTER COLUMN sku TYPE TEXT;
+ALTER TABLE stock_reservations RENAME COLUMN product_id TO sku;
+ALTER TABLE stock_reservations ALTER COLUMN sku TYPE TEXT;
+ALTER INDEX IF EXISTS stock_reservations_product_id_idx RENAME TO stock_reservations_sku_idx;
@@ -0,0 +1,10 @@
+-- Prices lose their currency, and are taken to have two decimals.
+ALTER TABLE product_variants DROP COLUMN IF EXISTS price_currency;
+ALTER TABLE product_variants RENAME COLUMN price_amount TO price;
+ALTER TABLE product_variants ALTER COLUMN price TYPE DOUBLE PRECISION USING price / 100.0;
+
+DROP INDEX IF EXISTS products_price_idx;
+ALTER TABLE products DROP COLUMN IF EXISTS price_currency;
+ALTER TABLE products RENAME COLUMN price_amount TO price;
+ALTER TABLE products ALTER COLUMN price TYPE DOUBLE PRECISION USING price / 100.0;
+CREATE INDEX IF NOT EXISTS products_price_idx ON products (price);
@@ -0,0 +1,14 @@
+-- Prices are whole numbers of the minor units of a currency, such as cents.
+-- The prices stored until now were in US dollars.
+DROP INDEX IF EXISTS products_price_idx;
+ALTER TABLE products ALTER COLUMN price TYPE BIGINT USING round(price * 100);
+ALTER TABLE products RENAME COLUMN price TO price_amount;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS price_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE products ALTER COLUMN price_currency DROP DEFAULT;
+-- Searches sort by currency, then amount.
+CREATE INDEX IF NOT EXISTS products_price_idx ON products (price_currency, price_amount);
+
+ALTER TABLE product_variants ALTER COLUMN price TYPE BIGINT USING round(price * 100);
+ALTER TABLE product_variants RENAME COLUMN price TO price_amount;
+ALTER TABLE product_variants ADD COLUMN IF NOT EXISTS price_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE product_variants ALTER COLUMN price_currency DROP DEFAULT;
@@ -0,0 +1,198 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// postgresInventory keeps stock in the stock and stock_reservations tables.
+// A reservation locks the stock rows of its SKUs, so reservations of the
+// same SKUs take turns.
+type postgresInventory struct {
+	db *sql.DB
+}
+
+func NewPostgresInventory(url string) (Inventory, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+	return &postgresInventory{db: db}, nil
+}
+
+func (i *postgresInventory) Close() {
+	i.db.Close()
+}
+
+func (i *postgresInventory) SetStock(ctx context.Context, sku string, onHand uint64) error {
+	_, err := i.db.ExecContext(
+		ctx,
+		`INSERT INTO stock(sku, on_hand) VALUES($1, $2)
+		ON CONFLICT (sku) DO UPDATE SET on_hand = EXCLUDED.on_hand`,
+		sku, int64(onHand),
+	)
+	return dbError(err, ErrNotFound)
+}
+
+func (i *postgresInventory) GetStock(ctx context.Context, skus []string) ([]Stock, error) {
+	rows, err := i.db.QueryContext(
+		ctx,
+		`SELECT s.sku, s.on_hand, COALESCE(sum(r.quantity), 0)
+		FROM stock s
+		LEFT JOIN stock_reservations r ON r.sku = s.sku AND r.expires_at > $2
+		WHERE s.sku = ANY($1)
+		GROUP BY s.sku, s.on_hand`,
+		pq.Array(skus), time.Now(),
+	)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+	tracked := map[string]Stock{}
+	for rows.Next() {
+		s := Stock{Tracked: true}
+		if err = rows.Scan(&s.SKU, &s.OnHand, &s.Reserved); err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		tracked[s.SKU] = s
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	stock := []Stock{}
+	for _, id := range skus {
+		s, ok := tracked[id]
+		if !ok {
+			s = Stock{SKU: id}
+		}
+		stock = append(stock, s)
+	}
+	return stock, nil
+}
+
+func (i *postgresInventory) Reserve(ctx context.Context, reservation Reservation) error {
+	skus, quantities := []string{}, []int64{}
+	for _, item := range reservation.Items {
+		skus = append(skus, item.SKU)
+		quantities = append(quantities, int64(item.Quantity))
+	}
+	now := time.Now()
+
+	tx, err := i.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	defer tx.Rollback()
+
+	// Lock the stock first: the reserved quantities are read by a later
+	// statement, which sees every reservation committed while waiting.
+	onHand := map[string]uint64{}
+	rows, err := tx.QueryContext(
+		ctx,
+		"SELECT sku, on_hand FROM stock WHERE sku = ANY($1) ORDER BY sku FOR UPDATE",
+		pq.Array(skus),
+	)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	if err = scanQuantities(rows, onHand); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM stock_reservations WHERE sku = ANY($1) AND expires_at <= $2",
+		pq.Array(skus), now,
+	); err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	if len(onHand) > 0 {
+		reserved := map[string]uint64{}
+		rows, err = tx.QueryContext(
+			ctx,
+			"SELECT sku, sum(quantity) FROM stock_reservations WHERE sku = ANY($1) GROUP BY sku",
+			pq.Array(skus),
+		)
+		if err != nil {
+			return dbError(err, ErrNotFound)
+		}
+		if err = scanQuantities(rows, reserved); err != nil {
+			return err
+		}
+		for _, item := range reservation.Items {
+			stock, tracked := onHand[item.SKU]
+			if tracked && (Stock{OnHand: stock, Reserved: reserved[item.SKU]}).Available() < item.Quantity {
+				return ErrOutOfStock
+			}
+		}
+	}
+
+	if _, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO stock_reservations(id, sku, quantity, expires_at)
+		SELECT $1, unnest($2::text[]), unnest($3::bigint[]), $4`,
+		reservation.ID, pq.Array(skus), pq.Array(quantities), reservation.ExpiresAt,
+	); err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	return dbError(tx.Commit(), ErrNotFound)
+}
+
+// scanQuantities reads rows of a SKU and a quantity into quantities,
+// and closes them.
+func scanQuantities(rows *sql.Rows, quantities map[string]uint64) error {
+	defer rows.Close()
+	for rows.Next() {
+		var sku string
+		var quantity uint64
+		if err := rows.Scan(&sku, &quantity); err != nil {
+			return dbError(err, ErrNotFound)
+		}
+		quantities[sku] = quantity
+	}
+	return dbError(rows.Err(), ErrNotFound)
+}
+
+// Commit deletes the reservation and takes its quantities off the stock in
+// one statement. Stock set below what the reservation holds fails the
+// on_hand check, and the statement with it.
+func (i *postgresInventory) Commit(ctx context.Context, reservationID string) error {
+	var committed int
+	err := i.db.QueryRowContext(
+		ctx,
+		`WITH committed AS (
+			DELETE FROM stock_reservations WHERE id = $1 AND expires_at > $2
+			RETURNING sku, quantity
+		), taken AS (
+			UPDATE stock SET on_hand = stock.on_hand - committed.quantity
+			FROM committed WHERE stock.sku = committed.sku
+		)
+		SELECT count(*) FROM committed`,
+		reservationID, time.Now(),
+	).Scan(&committed)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "check_violation" {
+		if err := i.Release(ctx, reservationID); err != nil {
+			return err
+		}
+		return ErrOutOfStock
+	}
+	if err != nil {
+		return dbError(err, ErrReservationNotFound)
+	}
+	if committed == 0 {
+		return ErrReservationNotFound
+	}
+	return nil
+}
+
+func (i *postgresInventory) Release(ctx context.Context, reservationID string) error {
+	_, err := i.db.ExecContext(ctx, "DELETE FROM stock_reservations WHERE id = $1", reservationID)
+	return dbError(err, ErrNotFound)
+}
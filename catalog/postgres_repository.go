@@ -0,0 +1,445 @@
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/lib/pq"
+	"slices"
+	"strings"
+	"time"
+)
+
+// postgresRepository keeps products in Postgres, for deployments without
+// Elasticsearch. Search uses the full-text index on name and description,
+// ranking name matches first; versions come from a sequence, so they are
+// compatible with the ones elasticRepository hands out.
+type postgresRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresRepository(url string) (Repository, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+	return &postgresRepository{db: db}, nil
+}
+
+func (r *postgresRepository) Close() {
+	r.db.Close()
+}
+
+// PutProduct creates the product or replaces it, like indexing a document.
+func (r *postgresRepository) PutProduct(ctx context.Context, product Product) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	defer tx.Rollback()
+	if err = putProduct(ctx, tx, product); err != nil {
+		return err
+	}
+	return dbError(tx.Commit(), ErrNotFound)
+}
+
+// PutProducts puts the products in a single transaction. Products with a
+// SKU another product has are skipped; the returned slice holds
+// ErrSKUExists at their positions and nil elsewhere.
+func (r *postgresRepository) PutProducts(ctx context.Context, products []Product) ([]error, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer tx.Rollback()
+	productErrs := make([]error, len(products))
+	for i, product := range products {
+		// A failed statement aborts the whole transaction unless it is
+		// rolled back to a savepoint taken before it.
+		if _, err = tx.ExecContext(ctx, "SAVEPOINT product"); err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		err = putProduct(ctx, tx, product)
+		if errors.Is(err, ErrSKUExists) {
+			productErrs[i] = err
+			_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT product")
+		}
+		if err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		if _, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT product"); err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	return productErrs, nil
+}
+
+// putProduct creates or replaces the product and its variants in tx.
+func putProduct(ctx context.Context, tx *sql.Tx, product Product) error {
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO products(id, name, description, price_amount, price_currency, category, category_path, tags, created_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE
+		SET name = EXCLUDED.name, description = EXCLUDED.description,
+			price_amount = EXCLUDED.price_amount, price_currency = EXCLUDED.price_currency,
+			category = EXCLUDED.category, category_path = EXCLUDED.category_path, tags = EXCLUDED.tags,
+			created_at = EXCLUDED.created_at, seq_no = nextval('products_seq_no')`,
+		product.Id, product.Name, product.Description, product.Price.Amount, product.Price.Currency,
+		product.Category, pq.Array(categoryPath(product.Category)), pq.Array(product.Tags), product.CreatedAt,
+	)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	return putVariants(ctx, tx, product)
+}
+
+// putVariants replaces the variants of the product, failing with
+// ErrSKUExists if another product has one of their SKUs.
+func putVariants(ctx context.Context, tx *sql.Tx, product Product) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM product_variants WHERE product_id = $1", product.Id)
+	if err != nil || len(product.Variants) == 0 {
+		return dbError(err, ErrNotFound)
+	}
+	variants, err := json.Marshal(product.Variants)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO product_variants(sku, product_id, position, attributes, price_amount, price_currency)
+		SELECT v->>'sku', $1, n, COALESCE(v->'attributes', '{}'),
+			(v->'price'->>'amount')::bigint, v->'price'->>'currency'
+		FROM jsonb_array_elements($2::jsonb) WITH ORDINALITY AS variants(v, n)`,
+		product.Id, string(variants),
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" {
+		return ErrSKUExists
+	}
+	return dbError(err, ErrNotFound)
+}
+
+func (r *postgresRepository) GetProductByID(ctx context.Context, productID string) (Product, error) {
+	var seqNo int64
+	p, err := scanProduct(r.db.QueryRowContext(
+		ctx,
+		"SELECT "+productColumns+", seq_no FROM products WHERE id = $1",
+		productID,
+	), &seqNo)
+	if err != nil {
+		return Product{}, dbError(err, ErrNotFound)
+	}
+	p.Version = version(1, seqNo)
+	return p, nil
+}
+
+func (r *postgresRepository) UpdateProduct(ctx context.Context, product Product) (Product, error) {
+	term, seqNo, err := parseVersion(product.Version)
+	if err != nil {
+		return Product{}, err
+	}
+	if term != 1 {
+		return Product{}, ErrVersionConflict
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Product{}, dbError(err, ErrNotFound)
+	}
+	defer tx.Rollback()
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE products
+		SET name = $3, description = $4, price_amount = $5, price_currency = $6,
+			category = $7, category_path = $8, tags = $9, seq_no = nextval('products_seq_no')
+		WHERE id = $1 AND seq_no = $2
+		RETURNING seq_no`,
+		product.Id, seqNo, product.Name, product.Description, product.Price.Amount, product.Price.Currency,
+		product.Category, pq.Array(categoryPath(product.Category)), pq.Array(product.Tags),
+	).Scan(&seqNo)
+	if err != nil {
+		return Product{}, dbError(err, ErrVersionConflict)
+	}
+	if err = putVariants(ctx, tx, product); err != nil {
+		return Product{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return Product{}, dbError(err, ErrNotFound)
+	}
+	product.Version = version(1, seqNo)
+	return product, nil
+}
+
+func (r *postgresRepository) DeleteProduct(ctx context.Context, productID string, version string) error {
+	query, args, notFound := "DELETE FROM products WHERE id = $1", []any{productID}, ErrNotFound
+	if version != "" {
+		term, seqNo, err := parseVersion(version)
+		if err != nil {
+			return err
+		}
+		if term != 1 {
+			return ErrVersionConflict
+		}
+		query, args, notFound = query+" AND seq_no = $2", append(args, seqNo), ErrVersionConflict
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return dbError(err, ErrNotFound)
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func (r *postgresRepository) ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error) {
+	return r.queryProducts(
+		ctx,
+		"SELECT "+productColumns+" FROM products ORDER BY id OFFSET $1 LIMIT $2",
+		skip, take,
+	)
+}
+
+func (r *postgresRepository) ListProductsWithIDs(ctx context.Context, productIDs []string) (*[]Product, error) {
+	return r.queryProducts(
+		ctx,
+		"SELECT "+productColumns+" FROM products WHERE id = ANY($1)",
+		pq.Array(productIDs),
+	)
+}
+
+func (r *postgresRepository) ListProductsWithSKUs(ctx context.Context, skus []string) (*[]Product, error) {
+	return r.queryProducts(
+		ctx,
+		"SELECT "+productColumns+" FROM products WHERE id IN (SELECT product_id FROM product_variants WHERE sku = ANY($1)) ORDER BY id",
+		pq.Array(skus),
+	)
+}
+
+// SearchProducts matches products containing any of the words in the query,
+// in the order search asks for, and counts the facets of all of them in the
+// same snapshot. Like a multi_match query, a product needs only one of the
+// words to match. Products that sort equally come in id order.
+func (r *postgresRepository) SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error) {
+	conditions, args := []string{}, []any{}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	rank := ""
+	if search.Query != "" {
+		terms := words(search.Query)
+		if len(terms) == 0 {
+			return &[]Product{}, Facets{Categories: []FacetCount{}, Tags: []FacetCount{}, Prices: priceBuckets()}, nil
+		}
+		// words leaves only letters and digits, so the terms need no quoting.
+		query := "to_tsquery('english', " + arg(strings.Join(terms, " | ")) + ")"
+		conditions = append(conditions, "search @@ "+query)
+		rank = "ts_rank(search, " + query + ")"
+	}
+	if search.Category != "" {
+		conditions = append(conditions, "category_path @> ARRAY["+arg(search.Category)+"::text]")
+	}
+	if len(search.Tags) > 0 {
+		conditions = append(conditions, "tags @> "+arg(pq.Array(search.Tags))+"::text[]")
+	}
+	if search.MinPrice != nil {
+		conditions = append(conditions,
+			"price_currency = "+arg(search.MinPrice.Currency), "price_amount >= "+arg(search.MinPrice.Amount))
+	}
+	if search.MaxPrice != nil {
+		conditions = append(conditions,
+			"price_currency = "+arg(search.MaxPrice.Currency), "price_amount <= "+arg(search.MaxPrice.Amount))
+	}
+	var keys []string
+	switch search.Sort {
+	case SortPrice:
+		keys = []string{"price_currency", "price_amount"}
+	case SortName:
+		keys = []string{`lower(name) COLLATE "C"`}
+	case SortCreatedAt:
+		keys = []string{"created_at"}
+	default:
+		// Without a query every product is equally relevant.
+		if rank != "" {
+			keys = []string{rank}
+		}
+	}
+	direction := " ASC"
+	if search.Direction == SortDescending {
+		direction = " DESC"
+	}
+	order := ""
+	for _, key := range keys {
+		order += key + direction + ", "
+	}
+	order += "id"
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, Facets{}, dbError(err, ErrNotFound)
+	}
+	defer tx.Rollback()
+
+	// The facet queries share the filter arguments but not the paging ones.
+	filterArgs := slices.Clip(args)
+	products, err := queryProducts(
+		ctx, tx,
+		"SELECT "+productColumns+" FROM products"+where+
+			" ORDER BY "+order+" OFFSET "+arg(skip)+" LIMIT "+arg(take),
+		args...,
+	)
+	if err != nil {
+		return nil, Facets{}, err
+	}
+
+	facets := Facets{Prices: priceBuckets()}
+	if facets.Categories, err = countFacets(ctx, tx, "unnest(category_path)", where, filterArgs); err != nil {
+		return nil, Facets{}, err
+	}
+	if facets.Tags, err = countFacets(ctx, tx, "unnest(tags)", where, filterArgs); err != nil {
+		return nil, Facets{}, err
+	}
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT width_bucket(price_amount, $%d::bigint[]), count(*) FROM products%s GROUP BY 1",
+			len(filterArgs)+1, where,
+		),
+		append(filterArgs, pq.Array(PriceBuckets))...,
+	)
+	if err != nil {
+		return nil, Facets{}, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket int
+		var count uint64
+		if err = rows.Scan(&bucket, &count); err != nil {
+			return nil, Facets{}, dbError(err, ErrNotFound)
+		}
+		facets.Prices[bucket].Count = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Facets{}, dbError(err, ErrNotFound)
+	}
+	return products, facets, nil
+}
+
+// countFacets counts the products matching where per value of the
+// set-returning expression values, most common first.
+func countFacets(ctx context.Context, tx *sql.Tx, values string, where string, args []any) ([]FacetCount, error) {
+	rows, err := tx.QueryContext(
+		ctx,
+		fmt.Sprintf(
+			"SELECT value, count(*) FROM (SELECT %s AS value FROM products%s) v GROUP BY value ORDER BY 2 DESC, value LIMIT %d",
+			values, where, facetSize,
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+	counts := []FacetCount{}
+	for rows.Next() {
+		c := FacetCount{}
+		if err = rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		counts = append(counts, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	return counts, nil
+}
+
+// productColumns are the columns scanProduct reads, in order, selected from
+// products. The variants come as a JSON array, or NULL if there are none.
+const productColumns = `id, name, description, price_amount, price_currency, category, tags, created_at,
+	(SELECT jsonb_agg(jsonb_build_object(
+		'sku', v.sku, 'attributes', v.attributes,
+		'price', jsonb_build_object('amount', v.price_amount, 'currency', v.price_currency)
+	) ORDER BY v.position)
+	FROM product_variants v WHERE v.product_id = products.id)`
+
+// scanProduct reads the productColumns of a row, followed by any extra
+// columns into extra.
+func scanProduct(row interface{ Scan(...any) error }, extra ...any) (Product, error) {
+	p := Product{}
+	var tags pq.StringArray
+	var createdAt time.Time
+	var variants []byte
+	if err := row.Scan(append([]any{&p.Id, &p.Name, &p.Description, &p.Price.Amount, &p.Price.Currency, &p.Category, &tags, &createdAt, &variants}, extra...)...); err != nil {
+		return Product{}, err
+	}
+	p.CreatedAt = createdAt.UTC()
+	if len(tags) > 0 {
+		p.Tags = tags
+	}
+	if variants != nil {
+		if err := json.Unmarshal(variants, &p.Variants); err != nil {
+			return Product{}, err
+		}
+		for i, v := range p.Variants {
+			if len(v.Attributes) == 0 {
+				p.Variants[i].Attributes = nil
+			}
+		}
+	}
+	return p, nil
+}
+
+func (r *postgresRepository) queryProducts(ctx context.Context, query string, args ...any) (*[]Product, error) {
+	return queryProducts(ctx, r.db, query, args...)
+}
+
+// queryer is what queryProducts needs of a database or transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func queryProducts(ctx context.Context, db queryer, query string, args ...any) (*[]Product, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	defer rows.Close()
+	products := []Product{}
+	for rows.Next() {
+		p, err := scanProduct(rows)
+		if err != nil {
+			return nil, dbError(err, ErrNotFound)
+		}
+		products = append(products, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, dbError(err, ErrNotFound)
+	}
+	return &products, nil
+}
+
+// dbError translates driver errors into the shared error model with
+// errs.FromSQL.
+func dbError(err error, notFound error) error {
+	return errs.FromSQL(err, "catalog", notFound)
+}
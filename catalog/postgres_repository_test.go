@@ -0,0 +1,69 @@
+package catalog_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/catalog/catalogtest"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+// TestPostgresRepository runs against the database in
+// CATALOG_TEST_DATABASE_URL, migrated and with its tables emptied before every case.
+func TestPostgresRepository(t *testing.T) {
+	url := os.Getenv("CATALOG_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("CATALOG_TEST_DATABASE_URL is not set")
+	}
+	catalogtest.TestRepository(t, func(t *testing.T) catalog.Repository {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err = migrate.Up(context.Background(), db, catalog.Migrations); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("TRUNCATE products, product_variants"); err != nil {
+			t.Fatal(err)
+		}
+		r, err := catalog.NewPostgresRepository(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(r.Close)
+		return r
+	})
+}
+
+// TestPostgresInventory runs against the database in
+// CATALOG_TEST_DATABASE_URL, migrated and with its stock tables emptied
+// before every case.
+func TestPostgresInventory(t *testing.T) {
+	url := os.Getenv("CATALOG_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("CATALOG_TEST_DATABASE_URL is not set")
+	}
+	catalogtest.TestInventory(t, func(t *testing.T) catalog.Inventory {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err = migrate.Up(context.Background(), db, catalog.Migrations); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("TRUNCATE stock, stock_reservations"); err != nil {
+			t.Fatal(err)
+		}
+		inv, err := catalog.NewPostgresInventory(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(inv.Close)
+		return inv
+	})
+}
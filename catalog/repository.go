@@ -4,27 +4,184 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"gopkg.in/olivere/elastic.v5"
+	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"github.com/olivere/elastic/v7"
 	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
-	ErrNotFound = errors.New("entity not found")
+	ErrNotFound        = errs.New(errs.NotFound, "product not found")
+	ErrInvalidVersion  = errs.New(errs.InvalidArgument, "invalid product version")
+	ErrVersionConflict = errs.New(errs.Aborted, "product was changed by someone else; fetch it and try again")
 )
 
 type Repository interface {
 	Close()
 	PutProduct(ctx context.Context, product Product) error
+	// PutProducts puts the products in one batch and returns the error of
+	// each of them, nil for the ones stored. An error means the batch as a
+	// whole failed.
+	PutProducts(ctx context.Context, products []Product) ([]error, error)
 	GetProductByID(ctx context.Context, productID string) (Product, error)
 	ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error)
 	ListProductsWithIDs(ctx context.Context, productIDs []string) (*[]Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) (*[]Product, error)
+	// ListProductsWithSKUs returns the products having a variant with any of
+	// the SKUs.
+	ListProductsWithSKUs(ctx context.Context, skus []string) (*[]Product, error)
+	// SearchProducts returns a page of the products matching search and the
+	// facet counts of all of them. search is normalized: its category has no
+	// empty levels, its tags are lower-case, and its sort and direction are
+	// set and valid.
+	SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error)
+	// UpdateProduct replaces the stored product if it is still at
+	// product.Version and returns it with its new version.
+	UpdateProduct(ctx context.Context, product Product) (Product, error)
+	// DeleteProduct deletes the product if it is at version, or whatever its
+	// version if version is empty.
+	DeleteProduct(ctx context.Context, productID string, version string) error
 }
 
+// catalogIndex holds one document per product.
+const catalogIndex = "catalog"
+
+// maxResultWindow is Elasticsearch's default index.max_result_window, the
+// most hits one search can return.
+const maxResultWindow = 10000
+
+// catalogMapping is the explicit mapping of catalogIndex. It is strict, so a
+// document with a field missing from it is rejected instead of having a type
+// guessed for it.
+const catalogMapping = `{
+	"dynamic": "strict",
+	"properties": {
+		"id": {"type": "keyword"},
+		"name": {"type": "text"},
+		"name_sort": {"type": "keyword"},
+		"description": {"type": "text"},
+		"price": {"type": "double"},
+		"price_amount": {"type": "long"},
+		"price_currency": {"type": "keyword"},
+		"category": {"type": "keyword"},
+		"category_path": {"type": "keyword"},
+		"tags": {"type": "keyword"},
+		"created_at": {"type": "date"},
+		"variants": {
+			"properties": {
+				"sku": {"type": "keyword"},
+				"attributes": {"type": "object", "enabled": false},
+				"price": {"type": "double"},
+				"price_amount": {"type": "long"},
+				"price_currency": {"type": "keyword"}
+			}
+		}
+	}
+}`
+
+// productDocument is a product as indexed. CategoryPath holds the category
+// and its ancestors, so filtering and counting by a category includes its
+// subcategories. NameSort is the lower-cased name, which products are sorted
+// by since text fields cannot be. ID repeats the document id, which breaks
+// ties between sorted products since Elasticsearch cannot sort by _id by
+// default. Variant attributes are only ever read back whole, so they are not
+// indexed.
+//
+// Prices are stored as PriceAmount and PriceCurrency. Price is only set on
+// documents indexed before prices had a currency, and holds their price in
+// legacyCurrency.
 type productDocument struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	NameSort      string            `json:"name_sort"`
+	Description   string            `json:"description"`
+	Price         *float64          `json:"price,omitempty"`
+	PriceAmount   int64             `json:"price_amount"`
+	PriceCurrency string            `json:"price_currency"`
+	Category      string            `json:"category,omitempty"`
+	CategoryPath  []string          `json:"category_path,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	Variants      []variantDocument `json:"variants,omitempty"`
+}
+
+// variantDocument is a variant as indexed, its price stored like the price
+// of a productDocument.
+type variantDocument struct {
+	SKU           string            `json:"sku"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	Price         *float64          `json:"price,omitempty"`
+	PriceAmount   int64             `json:"price_amount"`
+	PriceCurrency string            `json:"price_currency"`
+}
+
+// legacyCurrency is the currency of the prices stored before prices had one.
+const legacyCurrency = "USD"
+
+// documentPrice returns the price stored in a document as amount and
+// currency, or as a legacy price if it has no currency.
+func documentPrice(legacy *float64, amount int64, currency string) money.Money {
+	if currency == "" && legacy != nil {
+		return money.Money{Amount: int64(math.Round(*legacy * 100)), Currency: legacyCurrency}
+	}
+	return money.Money{Amount: amount, Currency: currency}
+}
+
+func newProductDocument(product Product) productDocument {
+	doc := productDocument{
+		ID:            product.Id,
+		Name:          product.Name,
+		NameSort:      strings.ToLower(product.Name),
+		Description:   product.Description,
+		PriceAmount:   product.Price.Amount,
+		PriceCurrency: product.Price.Currency,
+		Category:      product.Category,
+		CategoryPath:  categoryPath(product.Category),
+		Tags:          product.Tags,
+		CreatedAt:     product.CreatedAt,
+	}
+	for _, v := range product.Variants {
+		doc.Variants = append(doc.Variants, variantDocument{
+			SKU:           v.SKU,
+			Attributes:    v.Attributes,
+			PriceAmount:   v.Price.Amount,
+			PriceCurrency: v.Price.Currency,
+		})
+	}
+	return doc
+}
+
+// decodeProduct decodes the source of the document with id.
+func decodeProduct(id string, source json.RawMessage) (Product, error) {
+	p := productDocument{}
+	if err := json.Unmarshal(source, &p); err != nil {
+		return Product{}, err
+	}
+	product := Product{
+		Id:          id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       documentPrice(p.Price, p.PriceAmount, p.PriceCurrency),
+		Category:    p.Category,
+		CreatedAt:   p.CreatedAt.UTC(),
+	}
+	if len(p.Tags) > 0 {
+		product.Tags = p.Tags
+	}
+	for _, v := range p.Variants {
+		product.Variants = append(product.Variants, Variant{
+			SKU:        v.SKU,
+			Attributes: v.Attributes,
+			Price:      documentPrice(v.Price, v.PriceAmount, v.PriceCurrency),
+		})
+	}
+	return product, nil
 }
 
 type elasticRepository struct {
@@ -36,57 +193,141 @@ func (r *elasticRepository) Close() {
 }
 
 func (r *elasticRepository) PutProduct(ctx context.Context, product Product) error {
-	_, err := r.client.Index().Index("catalog").Type("product").
+	_, err := r.client.Index().Index(catalogIndex).
 		Id(product.Id).
-		BodyJson(productDocument{
-			Name:        product.Name,
-			Description: product.Description,
-			Price:       product.Price}).
+		BodyJson(newProductDocument(product)).
 		Do(ctx)
-	return err
+	return elasticError(err)
 }
 
+// PutProducts indexes the products with a single bulk request. Elasticsearch
+// accepts or rejects each of them on its own; rejections for lack of
+// capacity are reported as errs.Unavailable, so the products can be sent
+// again later.
+func (r *elasticRepository) PutProducts(ctx context.Context, products []Product) ([]error, error) {
+	if len(products) == 0 {
+		return []error{}, nil
+	}
+	bulk := r.client.Bulk()
+	for _, p := range products {
+		bulk.Add(elastic.NewBulkIndexRequest().Index(catalogIndex).Id(p.Id).Doc(newProductDocument(p)))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return nil, elasticError(err)
+	}
+	if len(res.Items) != len(products) {
+		return nil, fmt.Errorf("bulk response has %d items for %d products", len(res.Items), len(products))
+	}
+	productErrs := make([]error, len(products))
+	for i, item := range res.Items {
+		result := item["index"]
+		switch {
+		case result == nil:
+			productErrs[i] = fmt.Errorf("bulk response has no index result for product %s", products[i].Id)
+		case result.Error == nil:
+		case result.Status == http.StatusTooManyRequests:
+			productErrs[i] = errs.New(errs.Unavailable, "catalog search is busy; import the product again later")
+		default:
+			productErrs[i] = fmt.Errorf("indexing product %s: %s: %s", products[i].Id, result.Error.Type, result.Error.Reason)
+		}
+	}
+	return productErrs, nil
+}
+
+// GetProductByID fetches the product with its version.
 func (r *elasticRepository) GetProductByID(ctx context.Context, productID string) (Product, error) {
-	result, err := r.client.Get().Index("catalog").Type("product").Id(productID).Do(ctx)
+	res, err := r.client.Get().Index(catalogIndex).Id(productID).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return Product{}, ErrNotFound
+	}
 	if err != nil {
-		return Product{}, err
+		return Product{}, elasticError(err)
 	}
-	if !result.Found {
+	if !res.Found || res.SeqNo == nil || res.PrimaryTerm == nil {
 		return Product{}, ErrNotFound
 	}
-	p := productDocument{}
-	if err = json.Unmarshal(*result.Source, &p); err != nil {
+	p, err := decodeProduct(productID, res.Source)
+	if err != nil {
 		return Product{}, err
 	}
-	return Product{
-		Id:          productID,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	p.Version = version(*res.PrimaryTerm, *res.SeqNo)
+	return p, nil
+}
+
+// UpdateProduct indexes the product only if the stored document still has
+// the sequence number and primary term encoded in product.Version, so
+// concurrent updates cannot overwrite each other.
+func (r *elasticRepository) UpdateProduct(ctx context.Context, product Product) (Product, error) {
+	term, seqNo, err := parseVersion(product.Version)
+	if err != nil {
+		return Product{}, err
+	}
+	res, err := r.client.Index().Index(catalogIndex).
+		Id(product.Id).
+		IfPrimaryTerm(term).IfSeqNo(seqNo).
+		BodyJson(newProductDocument(product)).
+		Do(ctx)
+	if elastic.IsConflict(err) {
+		return Product{}, ErrVersionConflict
+	}
+	if err != nil {
+		return Product{}, elasticError(err)
+	}
+	product.Version = version(res.PrimaryTerm, res.SeqNo)
+	return product, nil
+}
+
+func (r *elasticRepository) DeleteProduct(ctx context.Context, productID string, version string) error {
+	del := r.client.Delete().Index(catalogIndex).Id(productID)
+	if version != "" {
+		term, seqNo, err := parseVersion(version)
+		if err != nil {
+			return err
+		}
+		del = del.IfPrimaryTerm(term).IfSeqNo(seqNo)
+	}
+	_, err := del.Do(ctx)
+	switch {
+	case elastic.IsNotFound(err):
+		return ErrNotFound
+	case elastic.IsConflict(err):
+		return ErrVersionConflict
+	}
+	return elasticError(err)
+}
+
+// version encodes a sequence number and primary term as the opaque version
+// handed to clients.
+func version(primaryTerm, seqNo int64) string {
+	return fmt.Sprintf("%d.%d", primaryTerm, seqNo)
+}
+
+// parseVersion turns a version back into the primary term and sequence
+// number a write can be made conditional on.
+func parseVersion(version string) (primaryTerm int64, seqNo int64, err error) {
+	term, seq, found := strings.Cut(version, ".")
+	if !found {
+		return 0, 0, ErrInvalidVersion
+	}
+	if primaryTerm, err = strconv.ParseInt(term, 10, 64); err != nil || primaryTerm < 0 {
+		return 0, 0, ErrInvalidVersion
+	}
+	if seqNo, err = strconv.ParseInt(seq, 10, 64); err != nil || seqNo < 0 {
+		return 0, 0, ErrInvalidVersion
+	}
+	return primaryTerm, seqNo, nil
 }
 
 func (r *elasticRepository) ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error) {
 	result, err := r.client.Search().
-		Index("catalog").Type("product").
+		Index(catalogIndex).
 		Query(elastic.NewMatchAllQuery()).From(int(skip)).Size(int(take)).Do(ctx)
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, elasticError(err)
 	}
-	products := []Product{}
-	for _, hit := range result.Hits.Hits {
-		p := productDocument{}
-		if err = json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, Product{
-				Id:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
-		}
-	}
-	return &products, err
+	return decodeHits(result)
 }
 
 func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, productIDs []string) (*[]Product, error) {
@@ -94,54 +335,185 @@ func (r *elasticRepository) ListProductsWithIDs(ctx context.Context, productIDs
 	for _, id := range productIDs {
 		items = append(
 			items,
-			elastic.NewMultiGetItem().Index("catalog").Type("product").Id(id),
+			elastic.NewMultiGetItem().Index(catalogIndex).Id(id),
 		)
 	}
 	res, err := r.client.MultiGet().
 		Add(items...).Do(ctx)
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, elasticError(err)
 	}
-	var products []Product
+	products := []Product{}
 	for _, doc := range res.Docs {
-		p := productDocument{}
-		if err = json.Unmarshal(*doc.Source, &p); err == nil {
-			products = append(products, Product{
-				Id:          doc.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+		if !doc.Found {
+			continue
+		}
+		p, err := decodeProduct(doc.Id, doc.Source)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	return &products, nil
+}
+
+func (r *elasticRepository) ListProductsWithSKUs(ctx context.Context, skus []string) (*[]Product, error) {
+	if len(skus) == 0 {
+		return &[]Product{}, nil
+	}
+	products := []Product{}
+	seen := map[string]bool{}
+	for start := 0; start < len(skus); start += maxResultWindow {
+		chunk := skus[start:min(start+maxResultWindow, len(skus))]
+		values := []any{}
+		for _, sku := range chunk {
+			values = append(values, sku)
+		}
+		// Every SKU belongs to one product at most, so a chunk matches no
+		// more products than it has SKUs. A product can match several chunks.
+		result, err := r.client.Search().
+			Index(catalogIndex).
+			Query(elastic.NewTermsQuery("variants.sku", values...)).
+			Size(len(chunk)).Do(ctx)
+		if err != nil {
+			log.Println(err)
+			return nil, elasticError(err)
+		}
+		found, err := decodeHits(result)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range *found {
+			if !seen[p.Id] {
+				seen[p.Id] = true
+				products = append(products, p)
+			}
 		}
 	}
-	return &products, err
+	return &products, nil
 }
 
-func (r *elasticRepository) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) (*[]Product, error) {
+// SearchProducts runs the query and filters of search in one request, with
+// aggregations for the facets. Ties are broken by id, so that pages neither
+// repeat nor skip products. Products indexed before id, name_sort and
+// created_at were added lack them, and come last when sorted by them.
+// Likewise, products indexed before prices had a currency lack price_amount
+// and price_currency until written again, so price filters and buckets leave
+// them out.
+func (r *elasticRepository) SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error) {
+	query := elastic.NewBoolQuery()
+	if search.Query != "" {
+		query.Must(elastic.NewMultiMatchQuery(search.Query, "name", "description"))
+	}
+	if search.Category != "" {
+		query.Filter(elastic.NewTermQuery("category_path", search.Category))
+	}
+	for _, tag := range search.Tags {
+		query.Filter(elastic.NewTermQuery("tags", tag))
+	}
+	if search.MinPrice != nil || search.MaxPrice != nil {
+		price := elastic.NewRangeQuery("price_amount")
+		if search.MinPrice != nil {
+			query.Filter(elastic.NewTermQuery("price_currency", search.MinPrice.Currency))
+			price.Gte(search.MinPrice.Amount)
+		}
+		if search.MaxPrice != nil {
+			query.Filter(elastic.NewTermQuery("price_currency", search.MaxPrice.Currency))
+			price.Lte(search.MaxPrice.Amount)
+		}
+		query.Filter(price)
+	}
+	var sorters []elastic.Sorter
+	ascending := search.Direction == SortAscending
+	switch search.Sort {
+	case SortPrice:
+		sorters = []elastic.Sorter{
+			elastic.NewFieldSort("price_currency").Order(ascending),
+			elastic.NewFieldSort("price_amount").Order(ascending),
+		}
+	case SortName:
+		sorters = []elastic.Sorter{elastic.NewFieldSort("name_sort").Order(ascending)}
+	case SortCreatedAt:
+		sorters = []elastic.Sorter{elastic.NewFieldSort("created_at").Order(ascending)}
+	default:
+		sorters = []elastic.Sorter{elastic.NewScoreSort().Order(ascending)}
+	}
+	sorters = append(sorters, elastic.NewFieldSort("id"))
+	prices := elastic.NewRangeAggregation().Field("price_amount")
+	for i, bound := range PriceBuckets {
+		if i == 0 {
+			prices.AddUnboundedFrom(bound)
+			continue
+		}
+		prices.AddRange(PriceBuckets[i-1], bound)
+	}
+	prices.AddUnboundedTo(PriceBuckets[len(PriceBuckets)-1])
+
 	result, err := r.client.Search().
-		Index("catalog").Type("product").
-		Query(elastic.NewMultiMatchQuery(query, "name", "description", "price")).
+		Index(catalogIndex).
+		Query(query).
+		SortBy(sorters...).
+		Aggregation("categories", elastic.NewTermsAggregation().Field("category_path").Size(facetSize)).
+		Aggregation("tags", elastic.NewTermsAggregation().Field("tags").Size(facetSize)).
+		Aggregation("prices", prices).
 		From(int(skip)).Size(int(take)).Do(ctx)
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return nil, Facets{}, elasticError(err)
+	}
+	products, err := decodeHits(result)
+	if err != nil {
+		return nil, Facets{}, err
+	}
+
+	facets := Facets{Categories: []FacetCount{}, Tags: []FacetCount{}, Prices: priceBuckets()}
+	if agg, ok := result.Aggregations.Terms("categories"); ok {
+		facets.Categories = facetCounts(agg)
 	}
-	var products []Product
+	if agg, ok := result.Aggregations.Terms("tags"); ok {
+		facets.Tags = facetCounts(agg)
+	}
+	if agg, ok := result.Aggregations.Range("prices"); ok && len(agg.Buckets) == len(facets.Prices) {
+		for i, b := range agg.Buckets {
+			facets.Prices[i].Count = uint64(b.DocCount)
+		}
+	}
+	return products, facets, nil
+}
+
+func decodeHits(result *elastic.SearchResult) (*[]Product, error) {
+	products := []Product{}
 	for _, hit := range result.Hits.Hits {
-		p := productDocument{}
-		if err = json.Unmarshal(*hit.Source, &p); err == nil {
-			products = append(products, Product{
-				Id:          hit.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			})
+		p, err := decodeProduct(hit.Id, hit.Source)
+		if err != nil {
+			return nil, err
 		}
+		products = append(products, p)
 	}
-	return &products, err
+	return &products, nil
 }
 
+func facetCounts(agg *elastic.AggregationBucketKeyItems) []FacetCount {
+	counts := []FacetCount{}
+	for _, b := range agg.Buckets {
+		counts = append(counts, FacetCount{Value: fmt.Sprint(b.Key), Count: uint64(b.DocCount)})
+	}
+	return counts
+}
+
+// elasticError reports connection failures and timeouts as errs.Unavailable
+// and returns other errors unchanged.
+func elasticError(err error) error {
+	var netErr net.Error
+	if elastic.IsConnErr(err) || elastic.IsTimeout(err) || errors.As(err, &netErr) {
+		return errs.Wrap(errs.Unavailable, "catalog search is unavailable", err)
+	}
+	return err
+}
+
+// NewElasticRepository connects to the cluster at url and makes sure the
+// catalog index exists with its mapping.
 func NewElasticRepository(url string) (Repository, error) {
 	client, err := elastic.NewClient(
 		elastic.SetURL(url),
@@ -151,5 +523,27 @@ func NewElasticRepository(url string) (Repository, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = createIndex(context.Background(), client, catalogIndex, catalogMapping); err != nil {
+		client.Stop()
+		return nil, elasticError(err)
+	}
 	return &elasticRepository{client}, nil
 }
+
+// createIndex creates an index with mapping. If it already exists its mapping
+// is updated instead, which adds any fields introduced since it was created.
+func createIndex(ctx context.Context, client *elastic.Client, name string, mapping string) error {
+	_, err := client.CreateIndex(name).
+		BodyString(`{"mappings": ` + mapping + `}`).
+		Do(ctx)
+	if !isIndexExists(err) {
+		return err
+	}
+	_, err = client.PutMapping().Index(name).BodyString(mapping).Do(ctx)
+	return err
+}
+
+func isIndexExists(err error) bool {
+	var e *elastic.Error
+	return errors.As(err, &e) && e.Details != nil && e.Details.Type == "resource_already_exists_exception"
+}
@@ -0,0 +1,279 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/catalog/catalogtest"
+	"github.com/Mostbesep/microservice-com-temp/catalog/elastictest"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"github.com/olivere/elastic/v7"
+	"github.com/segmentio/ksuid"
+)
+
+// TestElasticRepository runs against a fresh elastictest stand-in for every
+// case.
+func TestElasticRepository(t *testing.T) {
+	catalogtest.TestRepository(t, func(t *testing.T) catalog.Repository {
+		return newElasticRepository(t, elastictest.NewServer(t).URL)
+	})
+}
+
+// TestElasticRepositoryCluster runs against the cluster in
+// CATALOG_TEST_ELASTICSEARCH_URL, whose catalog index is dropped before every
+// case.
+func TestElasticRepositoryCluster(t *testing.T) {
+	url := os.Getenv("CATALOG_TEST_ELASTICSEARCH_URL")
+	if url == "" {
+		t.Skip("CATALOG_TEST_ELASTICSEARCH_URL is not set")
+	}
+	catalogtest.TestRepository(t, func(t *testing.T) catalog.Repository {
+		client := newClient(t, url)
+		if _, err := client.DeleteIndex("catalog").Do(context.Background()); err != nil && !elastic.IsNotFound(err) {
+			t.Fatal(err)
+		}
+		return newElasticRepository(t, url)
+	})
+}
+
+// TestElasticInventory runs against a fresh elastictest stand-in for every
+// case.
+func TestElasticInventory(t *testing.T) {
+	catalogtest.TestInventory(t, func(t *testing.T) catalog.Inventory {
+		return newElasticInventory(t, elastictest.NewServer(t).URL)
+	})
+}
+
+// TestElasticInventoryCluster runs against the cluster in
+// CATALOG_TEST_ELASTICSEARCH_URL, whose stock indices are dropped before
+// every case.
+func TestElasticInventoryCluster(t *testing.T) {
+	url := os.Getenv("CATALOG_TEST_ELASTICSEARCH_URL")
+	if url == "" {
+		t.Skip("CATALOG_TEST_ELASTICSEARCH_URL is not set")
+	}
+	catalogtest.TestInventory(t, func(t *testing.T) catalog.Inventory {
+		client := newClient(t, url)
+		for _, index := range []string{"stock", "stock_reservations"} {
+			if _, err := client.DeleteIndex(index).Do(context.Background()); err != nil && !elastic.IsNotFound(err) {
+				t.Fatal(err)
+			}
+		}
+		return newElasticInventory(t, url)
+	})
+}
+
+// TestElasticInventoryCommitOfDroppedReservation drops a reservation from
+// one stock document behind the inventory's back, as pruning it once
+// expired would, and checks that Commit gives back what it took.
+func TestElasticInventoryCommitOfDroppedReservation(t *testing.T) {
+	s := elastictest.NewServer(t)
+	inv := newElasticInventory(t, s.URL)
+	ctx := context.Background()
+	for _, sku := range []string{"a", "b"} {
+		if err := inv.SetStock(ctx, sku, 5); err != nil {
+			t.Fatalf("SetStock: %v", err)
+		}
+	}
+	r := catalog.Reservation{
+		ID:        "reservation",
+		Items:     []catalog.StockItem{{SKU: "a", Quantity: 2}, {SKU: "b", Quantity: 2}},
+		ExpiresAt: time.Now().UTC().Add(time.Minute),
+	}
+	if err := inv.Reserve(ctx, r); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	_, err := newClient(t, s.URL).Index().Index("stock").Id("b").BodyString(`{"on_hand": 5, "reservations": {}}`).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := inv.Commit(ctx, r.ID); !errors.Is(err, catalog.ErrReservationNotFound) {
+		t.Errorf("Commit error = %v, want catalog.ErrReservationNotFound", err)
+	}
+	stock, err := inv.GetStock(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("GetStock: %v", err)
+	}
+	want := []catalog.Stock{{SKU: "a", Tracked: true, OnHand: 5}, {SKU: "b", Tracked: true, OnHand: 5}}
+	if !reflect.DeepEqual(stock, want) {
+		t.Errorf("GetStock = %+v, want %+v", stock, want)
+	}
+}
+
+func TestElasticRepositoryCreatesIndex(t *testing.T) {
+	s := elastictest.NewServer(t)
+	r, err := catalog.NewElasticRepository(s.URL)
+	if err != nil {
+		t.Fatalf("NewElasticRepository: %v", err)
+	}
+	r.Close()
+
+	mapping := s.Mapping("catalog")
+	if mapping["dynamic"] != "strict" {
+		t.Errorf("catalog mapping dynamic = %v, want strict", mapping["dynamic"])
+	}
+	properties, _ := mapping["properties"].(map[string]any)
+	for field, want := range map[string]string{"name": "text", "description": "text", "price_amount": "long", "price_currency": "keyword"} {
+		m, _ := properties[field].(map[string]any)
+		if m["type"] != want {
+			t.Errorf("catalog mapping of %s = %v, want type %s", field, properties[field], want)
+		}
+	}
+
+	// Opening the repository again finds the index and keeps it.
+	r, err = catalog.NewElasticRepository(s.URL)
+	if err != nil {
+		t.Fatalf("NewElasticRepository on an existing index: %v", err)
+	}
+	r.Close()
+}
+
+// TestElasticRepositoryReadsLegacyPrices opens an index written before
+// prices had a currency, whose prices are read as US dollars.
+func TestElasticRepositoryReadsLegacyPrices(t *testing.T) {
+	s := elastictest.NewServer(t)
+	client := newClient(t, s.URL)
+	ctx := context.Background()
+	_, err := client.CreateIndex("catalog").BodyString(`{"mappings": {
+		"dynamic": "strict",
+		"properties": {
+			"name": {"type": "text"},
+			"description": {"type": "text"},
+			"price": {"type": "double"},
+			"created_at": {"type": "date"},
+			"variants": {"properties": {"sku": {"type": "keyword"}, "price": {"type": "double"}}}
+		}
+	}}`).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Index().Index("catalog").Id("legacy").BodyString(`{
+		"name": "Shirt", "description": "Cotton shirt", "price": 19.99,
+		"created_at": "2024-01-02T03:04:05Z",
+		"variants": [{"sku": "SHIRT-M", "price": 20.1}]
+	}`).Do(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newElasticRepository(t, s.URL)
+	p, err := r.GetProductByID(ctx, "legacy")
+	if err != nil {
+		t.Fatalf("GetProductByID: %v", err)
+	}
+	want := []catalog.Variant{{SKU: "SHIRT-M", Price: money.Money{Amount: 2010, Currency: "USD"}}}
+	if p.Price != (money.Money{Amount: 1999, Currency: "USD"}) || !reflect.DeepEqual(p.Variants, want) {
+		t.Errorf("GetProductByID = %+v, want it priced 19.99 USD with a variant at 20.10 USD", p)
+	}
+
+	// Once written again it is found by its price.
+	if _, err = r.UpdateProduct(ctx, p); err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	found, _, err := r.SearchProducts(ctx, catalog.ProductSearch{
+		MinPrice: &money.Money{Amount: 1999, Currency: "USD"}, Sort: catalog.SortRelevance, Direction: catalog.SortDescending,
+	}, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchProducts: %v", err)
+	}
+	if len(*found) != 1 || (*found)[0].Price != p.Price {
+		t.Errorf("SearchProducts from 19.99 USD = %+v, want the shirt", *found)
+	}
+}
+
+func newClient(t *testing.T, url string) *elastic.Client {
+	client, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func newElasticRepository(t *testing.T, url string) catalog.Repository {
+	r, err := catalog.NewElasticRepository(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Close)
+	return &refreshingRepository{Repository: r, client: newClient(t, url)}
+}
+
+func newElasticInventory(t *testing.T, url string) catalog.Inventory {
+	inv, err := catalog.NewElasticInventory(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(inv.Close)
+	return inv
+}
+
+// refreshingRepository refreshes the index after every write so the suite
+// can read its own writes.
+type refreshingRepository struct {
+	catalog.Repository
+	client *elastic.Client
+}
+
+func (r *refreshingRepository) PutProduct(ctx context.Context, product catalog.Product) error {
+	if err := r.Repository.PutProduct(ctx, product); err != nil {
+		return err
+	}
+	_, err := r.client.Refresh("catalog").Do(ctx)
+	return err
+}
+
+func (r *refreshingRepository) UpdateProduct(ctx context.Context, product catalog.Product) (catalog.Product, error) {
+	updated, err := r.Repository.UpdateProduct(ctx, product)
+	if err != nil {
+		return catalog.Product{}, err
+	}
+	_, err = r.client.Refresh("catalog").Do(ctx)
+	return updated, err
+}
+
+func (r *refreshingRepository) DeleteProduct(ctx context.Context, productID string, version string) error {
+	if err := r.Repository.DeleteProduct(ctx, productID, version); err != nil {
+		return err
+	}
+	_, err := r.client.Refresh("catalog").Do(ctx)
+	return err
+}
+
+// TestElasticRepositoryListsManySKUs looks up more SKUs than one search can
+// return hits for, with one product owning SKUs at both ends of the list.
+func TestElasticRepositoryListsManySKUs(t *testing.T) {
+	r := newElasticRepository(t, elastictest.NewServer(t).URL)
+	ctx := context.Background()
+	products := make([]catalog.Product, 10000)
+	skus := []string{}
+	for i := range products {
+		sku := fmt.Sprintf("SKU-%d", i)
+		products[i] = catalog.Product{
+			Id:       ksuid.New().String(),
+			Name:     "Product",
+			Price:    money.Money{Amount: 100, Currency: "USD"},
+			Variants: []catalog.Variant{{SKU: sku, Price: money.Money{Amount: 100, Currency: "USD"}}},
+		}
+		skus = append(skus, sku)
+	}
+	products[0].Variants = append(products[0].Variants, catalog.Variant{SKU: "SKU-last", Price: money.Money{Amount: 100, Currency: "USD"}})
+	skus = append(skus, "SKU-last")
+	if _, err := r.PutProducts(ctx, products); err != nil {
+		t.Fatalf("PutProducts: %v", err)
+	}
+
+	found, err := r.ListProductsWithSKUs(ctx, skus)
+	if err != nil {
+		t.Fatalf("ListProductsWithSKUs: %v", err)
+	}
+	if len(*found) != len(products) {
+		t.Errorf("ListProductsWithSKUs found %d products, want %d", len(*found), len(products))
+	}
+}
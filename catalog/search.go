@@ -0,0 +1,217 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidSort       = errs.New(errs.InvalidArgument, "sort must be relevance, price, name or created_at, and direction asc or desc")
+	ErrInvalidPriceRange = errs.New(errs.InvalidArgument, "minimum and maximum price must be in the same currency, the minimum not above the maximum")
+)
+
+// ProductSearch selects the products a search returns. The zero value
+// matches every product.
+type ProductSearch struct {
+	// Query matches products with any of its words in their name or
+	// description, best matches first.
+	Query string
+	// Category matches products in the category or any of its subcategories.
+	Category string
+	// Tags matches products having every one of the tags.
+	Tags []string
+	// MinPrice and MaxPrice, if set, match products priced in their currency
+	// within them, both inclusive.
+	MinPrice *money.Money
+	MaxPrice *money.Money
+	// Sort orders the products, by relevance if empty. Direction is the
+	// default of Sort if empty.
+	Sort      ProductSort
+	Direction SortDirection
+}
+
+// ProductSort is what a search orders products by.
+type ProductSort string
+
+const (
+	// SortRelevance puts the best matches of the query first. Without a query
+	// every product matches equally well.
+	SortRelevance ProductSort = "relevance"
+	// SortPrice orders products by the currency of their price, then by its
+	// amount, as prices in different currencies cannot be compared.
+	SortPrice ProductSort = "price"
+	// SortName orders products by name, ignoring case.
+	SortName      ProductSort = "name"
+	SortCreatedAt ProductSort = "created_at"
+)
+
+type SortDirection string
+
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
+
+// defaultDirection is descending for relevance and creation date, so the
+// best matches and the newest products come first, and ascending otherwise.
+func (s ProductSort) defaultDirection() SortDirection {
+	if s == SortRelevance || s == SortCreatedAt {
+		return SortDescending
+	}
+	return SortAscending
+}
+
+// Facets counts the products matching a search by category, tag and price,
+// regardless of which page of them was returned.
+type Facets struct {
+	// Categories counts products per category, including the ancestors of
+	// the category they are in.
+	Categories []FacetCount
+	Tags       []FacetCount
+	// Prices counts products per bucket of PriceBuckets, all buckets included.
+	Prices []PriceBucket
+}
+
+// FacetCount is the number of products with a category or tag.
+type FacetCount struct {
+	Value string
+	Count uint64
+}
+
+// PriceBucket counts the products priced from From, inclusive, up to To,
+// exclusive. A nil From or To leaves the bucket unbounded on that side.
+type PriceBucket struct {
+	From  *int64
+	To    *int64
+	Count uint64
+}
+
+// PriceBuckets are the bounds between the price buckets of Facets. They are
+// amounts in minor units, compared with prices in any currency, so search
+// in a single currency to make sense of them.
+var PriceBuckets = []int64{1000, 2500, 5000, 10000, 25000}
+
+// facetSize is how many of the most common categories and tags Facets
+// counts.
+const facetSize = 50
+
+// categorySeparator separates the levels of a category, as in
+// "Clothing/Shirts".
+const categorySeparator = "/"
+
+// normalizeCategory trims the levels of category and drops empty ones.
+func normalizeCategory(category string) string {
+	levels := []string{}
+	for _, level := range strings.Split(category, categorySeparator) {
+		if level = strings.TrimSpace(level); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, categorySeparator)
+}
+
+// categoryPath returns the category and its ancestors, top level first, as
+// stored for filtering and counting products by category.
+func categoryPath(category string) []string {
+	if category == "" {
+		return nil
+	}
+	levels := strings.Split(category, categorySeparator)
+	path := make([]string, len(levels))
+	for i := range levels {
+		path[i] = strings.Join(levels[:i+1], categorySeparator)
+	}
+	return path
+}
+
+// normalizeTags lower-cases and trims tags, dropping empty ones and
+// duplicates, and sorts them. No tags are nil.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// priceBuckets returns the empty buckets of PriceBuckets.
+func priceBuckets() []PriceBucket {
+	buckets := make([]PriceBucket, len(PriceBuckets)+1)
+	for i, bound := range PriceBuckets {
+		to, from := bound, bound
+		buckets[i].To = &to
+		buckets[i+1].From = &from
+	}
+	return buckets
+}
+
+// priceBucket returns the index in priceBuckets of the bucket holding price.
+func priceBucket(price money.Money) int {
+	return sort.Search(len(PriceBuckets), func(i int) bool { return price.Amount < PriceBuckets[i] })
+}
+
+// sortFacetCounts orders counts the way Elasticsearch orders terms buckets,
+// most common first, and keeps the first facetSize.
+func sortFacetCounts(counts map[string]uint64) []FacetCount {
+	facets := []FacetCount{}
+	for value, count := range counts {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	if len(facets) > facetSize {
+		facets = facets[:facetSize]
+	}
+	return facets
+}
+
+// SearchProducts returns a page of the products matching search and the
+// facet counts of all of them.
+func (c *catalogService) SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error) {
+	if take > 100 || (skip == 0 && take == 0) {
+		take = 100
+	}
+	search.Category = normalizeCategory(search.Category)
+	search.Tags = normalizeTags(search.Tags)
+	if search.Sort == "" {
+		search.Sort = SortRelevance
+	}
+	switch search.Sort {
+	case SortRelevance, SortPrice, SortName, SortCreatedAt:
+	default:
+		return nil, Facets{}, ErrInvalidSort
+	}
+	switch search.Direction {
+	case "":
+		search.Direction = search.Sort.defaultDirection()
+	case SortAscending, SortDescending:
+	default:
+		return nil, Facets{}, ErrInvalidSort
+	}
+	for _, bound := range []*money.Money{search.MinPrice, search.MaxPrice} {
+		if bound == nil {
+			continue
+		}
+		if err := bound.Validate(); err != nil {
+			return nil, Facets{}, err
+		}
+	}
+	if search.MinPrice != nil && search.MaxPrice != nil &&
+		(search.MinPrice.Currency != search.MaxPrice.Currency || search.MinPrice.Amount > search.MaxPrice.Amount) {
+		return nil, Facets{}, ErrInvalidPriceRange
+	}
+	return c.repository.SearchProducts(ctx, search, skip, take)
+}
@@ -3,45 +3,85 @@ package catalog
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	pb "github.com/Mostbesep/microservice-com-temp/catalog/pb/microservice-com-temp.catalog.pb"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
+	"io"
 	"log"
 	"net"
+	"time"
 )
 
 type grpcServer struct {
 	service Service
+	imports ImportOptions
 	pb.UnimplementedCatalogServiceServer
 }
 
-func ListenGRPC(s Service, port int) error {
+// ImportOptions sets how ImportProducts batches the rows streamed to it.
+type ImportOptions struct {
+	// FlushSize is the most rows imported in one batch.
+	FlushSize int
+	// FlushInterval is the longest a row waits for its batch to fill up
+	// before the batch is imported anyway. Zero waits until the batch is
+	// full or the stream ends.
+	FlushInterval time.Duration
+}
+
+var policy = authz.Policy{
+	pb.CatalogService_PostProduct_FullMethodName:    authz.RequireRole(authz.RoleAdmin),
+	pb.CatalogService_GetProduct_FullMethodName:     authz.Public(),
+	pb.CatalogService_GetProducts_FullMethodName:    authz.Public(),
+	pb.CatalogService_UpdateProduct_FullMethodName:  authz.RequireRole(authz.RoleAdmin),
+	pb.CatalogService_DeleteProduct_FullMethodName:  authz.RequireRole(authz.RoleAdmin),
+	pb.CatalogService_ImportProducts_FullMethodName: authz.RequireRole(authz.RoleAdmin),
+	pb.CatalogService_SetStock_FullMethodName:       authz.RequireRole(authz.RoleAdmin),
+	pb.CatalogService_GetStock_FullMethodName:       authz.Public(),
+	// Only the order service holds stock, for the orders it stores, so
+	// customers cannot hold stock they do not order.
+	pb.CatalogService_ReserveStock_FullMethodName:       authz.RequireRole(authz.RoleService),
+	pb.CatalogService_CommitReservation_FullMethodName:  authz.RequireRole(authz.RoleService),
+	pb.CatalogService_ReleaseReservation_FullMethodName: authz.RequireRole(authz.RoleService),
+}
+
+func ListenGRPC(s Service, keys idempotency.Store, keyWindow time.Duration, key authz.Key, imports ImportOptions, port int) error {
+	if imports.FlushSize < 1 {
+		return fmt.Errorf("import flush size is %d, want at least 1", imports.FlushSize)
+	}
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return err
 	}
-	server := grpc.NewServer()
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			errs.UnaryServerInterceptor(),
+			authz.UnaryServerInterceptor(key, policy),
+			idempotency.UnaryServerInterceptor(keys, keyWindow, pb.CatalogService_PostProduct_FullMethodName),
+		),
+		grpc.ChainStreamInterceptor(errs.StreamServerInterceptor(), authz.StreamServerInterceptor(key, policy)),
+	)
 	pb.RegisterCatalogServiceServer(server, &grpcServer{
 		UnimplementedCatalogServiceServer: pb.UnimplementedCatalogServiceServer{},
 		service:                           s,
+		imports:                           imports,
 	})
 	reflection.Register(server)
 	return server.Serve(lis)
 }
 
 func (s *grpcServer) PostProduct(ctx context.Context, r *pb.PostProductRequest) (*pb.PostProductResponse, error) {
-	p, err := s.service.PostProduct(ctx, r.Name, r.Description, r.Price)
+	p, err := s.service.PostProduct(ctx, r.Name, r.Description, moneyFromProto(r.Price), r.Category, r.Tags, variantsFromProto(r.Variants))
 	if err != nil {
 		return nil, err
 	}
 	return &pb.PostProductResponse{
-		Product: &pb.Product{
-			Id:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
-		},
+		Product: productToProto(p),
 	}, nil
 }
 
@@ -51,22 +91,159 @@ func (s *grpcServer) GetProduct(ctx context.Context, r *pb.GetProductRequest) (*
 		return nil, err
 	}
 	return &pb.GetProductResponse{
-		Product: &pb.Product{
-			Id:          p.Id,
-			Name:        p.Name,
-			Description: p.Description,
-			Price:       p.Price,
+		Product: productToProto(p),
+	}, nil
+}
+
+func (s *grpcServer) UpdateProduct(ctx context.Context, r *pb.UpdateProductRequest) (*pb.UpdateProductResponse, error) {
+	p, err := s.service.UpdateProduct(
+		ctx,
+		Product{
+			Id:          r.GetProduct().GetId(),
+			Name:        r.GetProduct().GetName(),
+			Description: r.GetProduct().GetDescription(),
+			Price:       moneyFromProto(r.GetProduct().GetPrice()),
+			Category:    r.GetProduct().GetCategory(),
+			Tags:        r.GetProduct().GetTags(),
+			Variants:    variantsFromProto(r.GetProduct().GetVariants()),
+			Version:     r.GetProduct().GetVersion(),
 		},
+		r.GetUpdateMask().GetPaths(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateProductResponse{
+		Product: productToProto(p),
 	}, nil
 }
 
+func (s *grpcServer) DeleteProduct(ctx context.Context, r *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
+	if err := s.service.DeleteProduct(ctx, r.Id, r.Version); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteProductResponse{}, nil
+}
+
+// ImportProducts imports the rows of the stream in batches, each written
+// with one request to the repository. A batch is imported once it has
+// FlushSize rows, or FlushInterval after its first row arrived, so a slow
+// stream still makes progress. If a batch fails, the call fails; earlier
+// batches stay imported.
+func (s *grpcServer) ImportProducts(stream pb.CatalogService_ImportProductsServer) error {
+	response := &pb.ImportProductsResponse{}
+	batch := []ProductImport{}
+	flush := func() error {
+		results, err := s.service.ImportProducts(stream.Context(), batch)
+		if err != nil {
+			return err
+		}
+		offset := len(response.Results)
+		for _, r := range results {
+			result := &pb.ImportProductsResponse_Result{Row: uint64(offset + r.Row)}
+			if r.Err != nil {
+				result.Code, result.Message = importError(r.Err)
+				response.Failed++
+			} else {
+				result.Product = productToProto(r.Product)
+				response.Imported++
+			}
+			response.Results = append(response.Results, result)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	// Recv blocks, so it runs on its own goroutine to let a batch be
+	// flushed while waiting for the next row. It stops at the end of the
+	// stream, or once the call is over.
+	rows := make(chan *pb.ImportProductsRequest)
+	ended := make(chan error, 1)
+	go func() {
+		for {
+			r, err := stream.Recv()
+			if err != nil {
+				ended <- err
+				return
+			}
+			select {
+			case rows <- r:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	var flushAt <-chan time.Time
+	for {
+		select {
+		case r := <-rows:
+			batch = append(batch, ProductImport{
+				Name:        r.GetName(),
+				Description: r.GetDescription(),
+				Price:       moneyFromProto(r.GetPrice()),
+				Category:    r.GetCategory(),
+				Tags:        r.GetTags(),
+				Variants:    variantsFromProto(r.GetVariants()),
+			})
+			if len(batch) == 1 && s.imports.FlushInterval > 0 {
+				flushAt = time.After(s.imports.FlushInterval)
+			}
+			if len(batch) < s.imports.FlushSize {
+				continue
+			}
+		case <-flushAt:
+		case err := <-ended:
+			if err != io.EOF {
+				return err
+			}
+			if len(batch) > 0 {
+				if err = flush(); err != nil {
+					return err
+				}
+			}
+			return stream.SendAndClose(response)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		flushAt = nil
+	}
+}
+
+// importError returns the code and message reported for a row that was not
+// imported, hiding the details of errors that are not domain errors.
+func importError(err error) (string, string) {
+	var e *errs.Error
+	if errors.As(err, &e) {
+		return string(e.Code), e.Message
+	}
+	log.Println(err)
+	return "INTERNAL", "internal error"
+}
+
+// GetProducts looks products up by id or SKU if ids or SKUs are given, and
+// otherwise searches them if there is a query, a filter, a sort order or a
+// request for facets. With none of these it lists them.
 func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
 	var res *[]Product
+	var facets Facets
 	var err error
-	if r.Query != "" {
-		res, err = s.service.SearchProducts(ctx, r.Query, r.Skip, r.Take)
-	} else if len(r.Ids) != 0 {
-		res, err = s.service.ListProductsByIDs(ctx, r.Ids)
+	if len(r.Ids) != 0 || len(r.Skus) != 0 {
+		res, err = s.lookUpProducts(ctx, r.Ids, r.Skus)
+	} else if r.Query != "" || r.Category != "" || len(r.Tags) != 0 || r.Facets ||
+		r.MinPrice != nil || r.MaxPrice != nil ||
+		r.Sort != pb.ProductSort_PRODUCT_SORT_RELEVANCE || r.Direction != pb.SortDirection_SORT_DIRECTION_DEFAULT {
+		search := ProductSearch{
+			Query:    r.Query,
+			Category: r.Category,
+			Tags:     r.Tags,
+			MinPrice: priceBoundFromProto(r.MinPrice),
+			MaxPrice: priceBoundFromProto(r.MaxPrice),
+		}
+		if search.Sort, search.Direction, err = sortFromProto(r.Sort, r.Direction); err == nil {
+			res, facets, err = s.service.SearchProducts(ctx, search, r.Skip, r.Take)
+		}
 	} else {
 		res, err = s.service.ListProducts(ctx, r.Skip, r.Take)
 	}
@@ -77,15 +254,201 @@ func (s *grpcServer) GetProducts(ctx context.Context, r *pb.GetProductsRequest)
 
 	var products []*pb.Product
 	for _, p := range *res {
-		products = append(
-			products,
-			&pb.Product{
-				Id:          p.Id,
-				Name:        p.Name,
-				Description: p.Description,
-				Price:       p.Price,
-			},
-		)
-	}
-	return &pb.GetProductsResponse{Products: products}, nil
+		products = append(products, productToProto(p))
+	}
+	response := &pb.GetProductsResponse{Products: products}
+	if r.Facets {
+		response.Facets = facetsToProto(facets)
+	}
+	return response, nil
+}
+
+// lookUpProducts returns the products with the ids followed by the ones
+// having variants with the SKUs, each product once.
+func (s *grpcServer) lookUpProducts(ctx context.Context, ids []string, skus []string) (*[]Product, error) {
+	products := &[]Product{}
+	var err error
+	if len(ids) != 0 {
+		if products, err = s.service.ListProductsByIDs(ctx, ids); err != nil {
+			return nil, err
+		}
+	}
+	if len(skus) == 0 {
+		return products, nil
+	}
+	bySKU, err := s.service.ListProductsBySKUs(ctx, skus)
+	if err != nil {
+		return nil, err
+	}
+	found := map[string]bool{}
+	for _, p := range *products {
+		found[p.Id] = true
+	}
+	for _, p := range *bySKU {
+		if !found[p.Id] {
+			found[p.Id] = true
+			*products = append(*products, p)
+		}
+	}
+	return products, nil
+}
+
+func (s *grpcServer) SetStock(ctx context.Context, r *pb.SetStockRequest) (*pb.SetStockResponse, error) {
+	stock, err := s.service.SetStock(ctx, r.Sku, r.OnHand)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.SetStockResponse{Stock: stockToProto(stock)}, nil
+}
+
+func (s *grpcServer) GetStock(ctx context.Context, r *pb.GetStockRequest) (*pb.GetStockResponse, error) {
+	stock, err := s.service.GetStock(ctx, r.Skus)
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.GetStockResponse{}
+	for _, st := range stock {
+		res.Stock = append(res.Stock, stockToProto(st))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) ReserveStock(ctx context.Context, r *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	items := []StockItem{}
+	for _, item := range r.Items {
+		items = append(items, StockItem{SKU: item.Sku, Quantity: item.Quantity})
+	}
+	reservation, err := s.service.ReserveStock(ctx, items, r.GetTtl().AsDuration())
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.ReserveStockResponse{ReservationId: reservation.ID}
+	for _, item := range reservation.Items {
+		res.Items = append(res.Items, &pb.StockItem{Sku: item.SKU, Quantity: item.Quantity})
+	}
+	res.ExpiresAt, _ = reservation.ExpiresAt.MarshalBinary()
+	return res, nil
+}
+
+func (s *grpcServer) CommitReservation(ctx context.Context, r *pb.CommitReservationRequest) (*pb.CommitReservationResponse, error) {
+	if err := s.service.CommitReservation(ctx, r.ReservationId); err != nil {
+		return nil, err
+	}
+	return &pb.CommitReservationResponse{}, nil
+}
+
+func (s *grpcServer) ReleaseReservation(ctx context.Context, r *pb.ReleaseReservationRequest) (*pb.ReleaseReservationResponse, error) {
+	if err := s.service.ReleaseReservation(ctx, r.ReservationId); err != nil {
+		return nil, err
+	}
+	return &pb.ReleaseReservationResponse{}, nil
+}
+
+func stockToProto(s Stock) *pb.Stock {
+	return &pb.Stock{
+		Sku:       s.SKU,
+		Tracked:   s.Tracked,
+		OnHand:    s.OnHand,
+		Reserved:  s.Reserved,
+		Available: s.Available(),
+	}
+}
+
+func productToProto(p Product) *pb.Product {
+	product := &pb.Product{
+		Id:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       moneyToProto(p.Price),
+		Category:    p.Category,
+		Tags:        p.Tags,
+		Variants:    variantsToProto(p.Variants),
+		Version:     p.Version,
+	}
+	if !p.CreatedAt.IsZero() {
+		product.CreatedAt, _ = p.CreatedAt.MarshalBinary()
+	}
+	return product
+}
+
+func variantsToProto(variants []Variant) []*pb.Variant {
+	var protos []*pb.Variant
+	for _, v := range variants {
+		protos = append(protos, &pb.Variant{Sku: v.SKU, Attributes: v.Attributes, Price: moneyToProto(v.Price)})
+	}
+	return protos
+}
+
+// variantsFromProto translates variants, leaving them nil if there are none.
+func variantsFromProto(protos []*pb.Variant) []Variant {
+	var variants []Variant
+	for _, v := range protos {
+		variant := Variant{SKU: v.GetSku(), Price: moneyFromProto(v.GetPrice())}
+		if len(v.GetAttributes()) > 0 {
+			variant.Attributes = v.GetAttributes()
+		}
+		variants = append(variants, variant)
+	}
+	return variants
+}
+
+func moneyToProto(m money.Money) *pb.Money {
+	return &pb.Money{Amount: m.Amount, Currency: m.Currency}
+}
+
+// moneyFromProto translates an amount, which is zero and without a currency
+// if unset.
+func moneyFromProto(m *pb.Money) money.Money {
+	return money.Money{Amount: m.GetAmount(), Currency: m.GetCurrency()}
+}
+
+// priceBoundFromProto translates a bound of a price range, leaving it nil if
+// unset.
+func priceBoundFromProto(m *pb.Money) *money.Money {
+	if m == nil {
+		return nil
+	}
+	bound := moneyFromProto(m)
+	return &bound
+}
+
+// sortFromProto translates the sort order of a request, leaving the
+// direction empty for the default one.
+func sortFromProto(sort pb.ProductSort, direction pb.SortDirection) (ProductSort, SortDirection, error) {
+	var s ProductSort
+	switch sort {
+	case pb.ProductSort_PRODUCT_SORT_RELEVANCE:
+		s = SortRelevance
+	case pb.ProductSort_PRODUCT_SORT_PRICE:
+		s = SortPrice
+	case pb.ProductSort_PRODUCT_SORT_NAME:
+		s = SortName
+	case pb.ProductSort_PRODUCT_SORT_CREATED_AT:
+		s = SortCreatedAt
+	default:
+		return "", "", ErrInvalidSort
+	}
+	switch direction {
+	case pb.SortDirection_SORT_DIRECTION_DEFAULT:
+		return s, "", nil
+	case pb.SortDirection_SORT_DIRECTION_ASC:
+		return s, SortAscending, nil
+	case pb.SortDirection_SORT_DIRECTION_DESC:
+		return s, SortDescending, nil
+	}
+	return "", "", ErrInvalidSort
+}
+
+func facetsToProto(facets Facets) *pb.Facets {
+	f := &pb.Facets{}
+	for _, c := range facets.Categories {
+		f.Categories = append(f.Categories, &pb.FacetCount{Value: c.Value, Count: c.Count})
+	}
+	for _, t := range facets.Tags {
+		f.Tags = append(f.Tags, &pb.FacetCount{Value: t.Value, Count: t.Count})
+	}
+	for _, b := range facets.Prices {
+		f.Prices = append(f.Prices, &pb.PriceBucket{From: b.From, To: b.To, Count: b.Count})
+	}
+	return f
 }
@@ -2,65 +2,197 @@ package catalog
 
 import (
 	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	"github.com/segmentio/ksuid"
+	"time"
 )
 
+var (
+	ErrInvalidUpdateMask = errs.New(errs.InvalidArgument, "update mask may only name name, description, price, category, tags and variants")
+	ErrInvalidPrice      = errs.New(errs.InvalidArgument, "prices must not be negative, and the variants of a product are priced in its currency")
+)
+
+// Product is an item for sale. Version changes with every write; it is only
+// set on products read by id or returned from an update.
+//
+// Category is a path of levels separated by slashes, such as
+// "Clothing/Shirts", and may be empty. Tags are lower-case and sorted, and
+// nil rather than empty. CreatedAt is zero for products indexed in
+// Elasticsearch before it was introduced. Variants are nil rather than
+// empty; products without them are stocked under their id. Price and the
+// prices of the variants are in the same currency.
 type Product struct {
-	Id          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Id          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	Category    string      `json:"category,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Variants    []Variant   `json:"variants,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Version     string      `json:"version,omitempty"`
 }
 
+// Product fields that an update mask can name.
+const (
+	FieldName        = "name"
+	FieldDescription = "description"
+	FieldPrice       = "price"
+	FieldCategory    = "category"
+	FieldTags        = "tags"
+	FieldVariants    = "variants"
+)
+
 type Service interface {
-	PostProduct(ctx context.Context, name, description string, price float64) (Product, error)
+	PostProduct(ctx context.Context, name, description string, price money.Money, category string, tags []string, variants []Variant) (Product, error)
 	GetProduct(ctx context.Context, productID string) (Product, error)
 	ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error)
 	ListProductsByIDs(ctx context.Context, productIDs []string) (*[]Product, error)
-	SearchProducts(ctx context.Context, query string, skip uint64, take uint64) (*[]Product, error)
+	ListProductsBySKUs(ctx context.Context, skus []string) (*[]Product, error)
+	SearchProducts(ctx context.Context, search ProductSearch, skip uint64, take uint64) (*[]Product, Facets, error)
+	UpdateProduct(ctx context.Context, product Product, fields []string) (Product, error)
+	DeleteProduct(ctx context.Context, productID string, version string) error
+	ImportProducts(ctx context.Context, rows []ProductImport) ([]ImportResult, error)
+	SetStock(ctx context.Context, sku string, onHand uint64) (Stock, error)
+	GetStock(ctx context.Context, skus []string) ([]Stock, error)
+	ReserveStock(ctx context.Context, items []StockItem, ttl time.Duration) (Reservation, error)
+	CommitReservation(ctx context.Context, reservationID string) error
+	ReleaseReservation(ctx context.Context, reservationID string) error
 }
 
 type catalogService struct {
 	repository Repository
+	inventory  Inventory
+}
+
+func (c *catalogService) PostProduct(ctx context.Context, name, description string, price money.Money, category string, tags []string, variants []Variant) (Product, error) {
+	product, err := newProduct(name, description, price, category, tags, variants)
+	if err != nil {
+		return Product{}, err
+	}
+	if err = c.checkSKUs(ctx, product); err != nil {
+		return Product{}, err
+	}
+	err = c.repository.PutProduct(ctx, product)
+	if err != nil {
+		return Product{}, err
+	}
+	return product, nil
 }
 
-func (c *catalogService) PostProduct(ctx context.Context, name, description string, price float64) (Product, error) {
-	newProduct := Product{
+// newProduct returns a valid product with a new id, or the reason the fields
+// do not make one. It does not check that the SKUs are free.
+func newProduct(name, description string, price money.Money, category string, tags []string, variants []Variant) (Product, error) {
+	variants, err := normalizeVariants(variants)
+	if err != nil {
+		return Product{}, err
+	}
+	product := Product{
 		Id:          ksuid.New().String(),
 		Name:        name,
 		Description: description,
 		Price:       price,
+		Category:    normalizeCategory(category),
+		Tags:        normalizeTags(tags),
+		Variants:    variants,
+		// Postgres keeps microseconds, so truncate to return what is stored.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
 	}
-
-	err := c.repository.PutProduct(ctx, newProduct)
-	if err != nil {
+	if err = checkPrices(product); err != nil {
 		return Product{}, err
 	}
-	return newProduct, nil
+	return product, nil
 }
 
 func (c *catalogService) GetProduct(ctx context.Context, productID string) (Product, error) {
-	return c.GetProduct(ctx, productID)
+	return c.repository.GetProductByID(ctx, productID)
 }
 
 func (c *catalogService) ListProducts(ctx context.Context, skip uint64, take uint64) (*[]Product, error) {
 	if take > 100 || (skip == 0 && take == 0) {
 		take = 100
 	}
-	return c.ListProducts(ctx, skip, take)
+	return c.repository.ListProducts(ctx, skip, take)
 }
 
 func (c *catalogService) ListProductsByIDs(ctx context.Context, productIDs []string) (*[]Product, error) {
-	return c.ListProductsByIDs(ctx, productIDs)
+	return c.repository.ListProductsWithIDs(ctx, productIDs)
 }
 
-func (c catalogService) SearchProducts(ctx context.Context, query string, skip uint64, take uint64) (*[]Product, error) {
-	if take > 100 || (skip == 0 && take == 0) {
-		take = 100
+// UpdateProduct copies the named fields, or all of them if fields is empty,
+// from product to the stored product with the same id. If product.Version is
+// set, the update fails with ErrVersionConflict unless the stored product is
+// still at that version. Either way, an update made between reading the
+// stored product and writing it back is never overwritten.
+func (c *catalogService) UpdateProduct(ctx context.Context, product Product, fields []string) (Product, error) {
+	if len(fields) == 0 {
+		fields = []string{FieldName, FieldDescription, FieldPrice, FieldCategory, FieldTags, FieldVariants}
+	}
+	for _, f := range fields {
+		switch f {
+		case FieldName, FieldDescription, FieldPrice, FieldCategory, FieldTags, FieldVariants:
+		default:
+			return Product{}, ErrInvalidUpdateMask
+		}
+	}
+	updated, err := c.repository.GetProductByID(ctx, product.Id)
+	if err != nil {
+		return Product{}, err
+	}
+	if product.Version != "" && product.Version != updated.Version {
+		return Product{}, ErrVersionConflict
+	}
+	for _, f := range fields {
+		switch f {
+		case FieldName:
+			updated.Name = product.Name
+		case FieldDescription:
+			updated.Description = product.Description
+		case FieldPrice:
+			updated.Price = product.Price
+		case FieldCategory:
+			updated.Category = normalizeCategory(product.Category)
+		case FieldTags:
+			updated.Tags = normalizeTags(product.Tags)
+		case FieldVariants:
+			if updated.Variants, err = normalizeVariants(product.Variants); err != nil {
+				return Product{}, err
+			}
+			if err = c.checkSKUs(ctx, updated); err != nil {
+				return Product{}, err
+			}
+		}
 	}
-	return c.SearchProducts(ctx, query, skip, take)
+	if err = checkPrices(updated); err != nil {
+		return Product{}, err
+	}
+	return c.repository.UpdateProduct(ctx, updated)
+}
+
+// checkPrices makes sure the prices of product are valid amounts, not
+// negative, and that its variants are priced in its currency.
+func checkPrices(product Product) error {
+	if err := product.Price.Validate(); err != nil {
+		return err
+	}
+	if product.Price.Amount < 0 {
+		return ErrInvalidPrice
+	}
+	for _, v := range product.Variants {
+		if v.Price.Currency != product.Price.Currency || v.Price.Amount < 0 {
+			return ErrInvalidPrice
+		}
+	}
+	return nil
+}
+
+// DeleteProduct deletes the product. If version is set, the product is only
+// deleted while it is at that version.
+func (c *catalogService) DeleteProduct(ctx context.Context, productID string, version string) error {
+	return c.repository.DeleteProduct(ctx, productID, version)
 }
 
-func NewService(repository Repository) Service {
-	return &catalogService{repository: repository}
+func NewService(repository Repository, inventory Inventory) Service {
+	return &catalogService{repository: repository, inventory: inventory}
 }
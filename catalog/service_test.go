@@ -0,0 +1,300 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/money"
+)
+
+func TestUpdateProduct(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	p, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := s.GetProduct(ctx, p.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the fields in the mask change.
+	updated, err := s.UpdateProduct(ctx, catalog.Product{Id: p.Id, Price: usd(700)}, []string{catalog.FieldPrice})
+	if err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if updated.Name != "Mug" || updated.Description != "Ceramic mug" || updated.Price != usd(700) {
+		t.Errorf("UpdateProduct = %+v, want only the price changed", updated)
+	}
+
+	// An update based on what was read before the price change is refused.
+	stale := catalog.Product{Id: p.Id, Name: "Cup", Version: read.Version}
+	if _, err := s.UpdateProduct(ctx, stale, []string{catalog.FieldName}); !errors.Is(err, catalog.ErrVersionConflict) {
+		t.Errorf("UpdateProduct at a stale version error = %v, want catalog.ErrVersionConflict", err)
+	}
+	stale.Version = updated.Version
+	if _, err := s.UpdateProduct(ctx, stale, []string{catalog.FieldName}); err != nil {
+		t.Errorf("UpdateProduct at the current version: %v", err)
+	}
+
+	if _, err := s.UpdateProduct(ctx, catalog.Product{Id: p.Id}, []string{"id"}); !errors.Is(err, catalog.ErrInvalidUpdateMask) {
+		t.Errorf("UpdateProduct of the id error = %v, want catalog.ErrInvalidUpdateMask", err)
+	}
+	if _, err := s.UpdateProduct(ctx, catalog.Product{Id: "missing"}, nil); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("UpdateProduct of a missing product error = %v, want catalog.ErrNotFound", err)
+	}
+}
+
+func TestCategoriesAndTagsAreNormalized(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	p, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), " Kitchen / /Mugs ", []string{"Gift", " ceramic", "gift", ""}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Category != "Kitchen/Mugs" || !reflect.DeepEqual(p.Tags, []string{"ceramic", "gift"}) {
+		t.Errorf("PostProduct stored category %q and tags %q, want \"Kitchen/Mugs\" and [ceramic gift]", p.Category, p.Tags)
+	}
+
+	found, facets, err := s.SearchProducts(ctx, catalog.ProductSearch{Category: "Kitchen/ ", Tags: []string{"GIFT "}}, 0, 0)
+	if err != nil {
+		t.Fatalf("SearchProducts: %v", err)
+	}
+	if len(*found) != 1 || (*found)[0].Id != p.Id {
+		t.Errorf("SearchProducts with unnormalized filters = %+v, want the mug", *found)
+	}
+	if want := []catalog.FacetCount{{Value: "Kitchen", Count: 1}, {Value: "Kitchen/Mugs", Count: 1}}; !reflect.DeepEqual(facets.Categories, want) {
+		t.Errorf("category facets = %+v, want %+v", facets.Categories, want)
+	}
+}
+
+func TestSearchSortDefaultsAndValidation(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	cheap, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dear, err := s.PostProduct(ctx, "Teapot", "Ceramic teapot", usd(4000), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Price sorts cheapest first unless told otherwise.
+	found, _, err := s.SearchProducts(ctx, catalog.ProductSearch{Sort: catalog.SortPrice}, 0, 0)
+	if err != nil {
+		t.Fatalf("SearchProducts: %v", err)
+	}
+	if len(*found) != 2 || (*found)[0].Id != cheap.Id || (*found)[1].Id != dear.Id {
+		t.Errorf("SearchProducts by price = %+v, want the mug then the teapot", *found)
+	}
+
+	for _, search := range []catalog.ProductSearch{
+		{Sort: "popularity"},
+		{Sort: catalog.SortName, Direction: "up"},
+	} {
+		if _, _, err := s.SearchProducts(ctx, search, 0, 0); !errors.Is(err, catalog.ErrInvalidSort) {
+			t.Errorf("SearchProducts(%+v) error = %v, want catalog.ErrInvalidSort", search, err)
+		}
+	}
+	low, high, euros := usd(1000), usd(500), money.Money{Amount: 2000, Currency: "EUR"}
+	if _, _, err := s.SearchProducts(ctx, catalog.ProductSearch{MinPrice: &low, MaxPrice: &high}, 0, 0); !errors.Is(err, catalog.ErrInvalidPriceRange) {
+		t.Errorf("SearchProducts with the minimum price above the maximum error = %v, want catalog.ErrInvalidPriceRange", err)
+	}
+	if _, _, err := s.SearchProducts(ctx, catalog.ProductSearch{MinPrice: &low, MaxPrice: &euros}, 0, 0); !errors.Is(err, catalog.ErrInvalidPriceRange) {
+		t.Errorf("SearchProducts with prices in two currencies error = %v, want catalog.ErrInvalidPriceRange", err)
+	}
+	if _, _, err := s.SearchProducts(ctx, catalog.ProductSearch{MinPrice: &money.Money{Amount: 1000}}, 0, 0); !errors.Is(err, money.ErrInvalidCurrency) {
+		t.Errorf("SearchProducts with a price without a currency error = %v, want money.ErrInvalidCurrency", err)
+	}
+}
+
+func TestPricesAreChecked(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	if _, err := s.PostProduct(ctx, "Mug", "Ceramic mug", money.Money{Amount: 500}, "", nil, nil); !errors.Is(err, money.ErrInvalidCurrency) {
+		t.Errorf("PostProduct without a currency error = %v, want money.ErrInvalidCurrency", err)
+	}
+	if _, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(-500), "", nil, nil); !errors.Is(err, catalog.ErrInvalidPrice) {
+		t.Errorf("PostProduct with a negative price error = %v, want catalog.ErrInvalidPrice", err)
+	}
+	euros := []catalog.Variant{{SKU: "MUG-EU", Price: money.Money{Amount: 500, Currency: "EUR"}}}
+	if _, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, euros); !errors.Is(err, catalog.ErrInvalidPrice) {
+		t.Errorf("PostProduct with a variant in another currency error = %v, want catalog.ErrInvalidPrice", err)
+	}
+
+	// The price and the variants can change currency together.
+	p, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, []catalog.Variant{{SKU: "MUG-US", Price: usd(500)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpdateProduct(ctx, catalog.Product{Id: p.Id, Price: euros[0].Price}, []string{catalog.FieldPrice}); !errors.Is(err, catalog.ErrInvalidPrice) {
+		t.Errorf("UpdateProduct of the price alone to another currency error = %v, want catalog.ErrInvalidPrice", err)
+	}
+	updated, err := s.UpdateProduct(ctx, catalog.Product{Id: p.Id, Price: euros[0].Price, Variants: euros}, []string{catalog.FieldPrice, catalog.FieldVariants})
+	if err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if updated.Price != euros[0].Price || !reflect.DeepEqual(updated.Variants, euros) {
+		t.Errorf("UpdateProduct = %+v, want it priced in euros", updated)
+	}
+}
+
+func TestReserveStock(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	p, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetStock(ctx, "missing", 1); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("SetStock of a missing SKU error = %v, want catalog.ErrNotFound", err)
+	}
+	if _, err := s.SetStock(ctx, p.Id, 3); err != nil {
+		t.Fatalf("SetStock: %v", err)
+	}
+
+	// Quantities of the same product add up.
+	r, err := s.ReserveStock(ctx, []catalog.StockItem{{SKU: p.Id, Quantity: 1}, {SKU: p.Id, Quantity: 1}}, 0)
+	if err != nil {
+		t.Fatalf("ReserveStock: %v", err)
+	}
+	if want := []catalog.StockItem{{SKU: p.Id, Quantity: 2}}; !reflect.DeepEqual(r.Items, want) {
+		t.Errorf("ReserveStock held %+v, want %+v", r.Items, want)
+	}
+	if ttl := time.Until(r.ExpiresAt); ttl <= 0 || ttl > catalog.DefaultReservationTTL {
+		t.Errorf("ReserveStock without a ttl expires in %v, want about %v", ttl, catalog.DefaultReservationTTL)
+	}
+	if _, err := s.ReserveStock(ctx, []catalog.StockItem{{SKU: p.Id, Quantity: 2}}, time.Minute); !errors.Is(err, catalog.ErrOutOfStock) {
+		t.Errorf("ReserveStock of more than is left error = %v, want catalog.ErrOutOfStock", err)
+	}
+
+	for _, tc := range []struct {
+		items []catalog.StockItem
+		ttl   time.Duration
+	}{
+		{nil, time.Minute},
+		{[]catalog.StockItem{{SKU: p.Id}}, time.Minute},
+		{[]catalog.StockItem{{SKU: p.Id, Quantity: 1}}, catalog.MaxReservationTTL + time.Second},
+	} {
+		if _, err := s.ReserveStock(ctx, tc.items, tc.ttl); !errors.Is(err, catalog.ErrInvalidReservation) {
+			t.Errorf("ReserveStock(%+v, %v) error = %v, want catalog.ErrInvalidReservation", tc.items, tc.ttl, err)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	shirt, err := s.PostProduct(ctx, "Shirt", "Cotton shirt", usd(2000), "", nil, []catalog.Variant{
+		{SKU: " SHIRT-M ", Attributes: map[string]string{" size ": "M"}, Price: usd(2000)},
+		{SKU: "SHIRT-L", Attributes: map[string]string{"size": "L"}, Price: usd(2200)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []catalog.Variant{
+		{SKU: "SHIRT-M", Attributes: map[string]string{"size": "M"}, Price: usd(2000)},
+		{SKU: "SHIRT-L", Attributes: map[string]string{"size": "L"}, Price: usd(2200)},
+	}
+	if !reflect.DeepEqual(shirt.Variants, want) {
+		t.Errorf("PostProduct stored variants %+v, want %+v", shirt.Variants, want)
+	}
+
+	for _, variants := range [][]catalog.Variant{
+		{{SKU: ""}},
+		{{SKU: "MUG 1"}},
+		{{SKU: "MUG-1"}, {SKU: "MUG-1"}},
+		{{SKU: "MUG-1", Attributes: map[string]string{" ": "blue"}}},
+	} {
+		if _, err := s.PostProduct(ctx, "Mug", "Ceramic mug", usd(500), "", nil, variants); !errors.Is(err, catalog.ErrInvalidVariant) {
+			t.Errorf("PostProduct with variants %+v error = %v, want catalog.ErrInvalidVariant", variants, err)
+		}
+	}
+	if _, err := s.PostProduct(ctx, "Other shirt", "", usd(2000), "", nil, []catalog.Variant{{SKU: "SHIRT-L", Price: usd(2000)}}); !errors.Is(err, catalog.ErrSKUExists) {
+		t.Errorf("PostProduct with a taken SKU error = %v, want catalog.ErrSKUExists", err)
+	}
+
+	// A product can keep its own SKUs when its variants change.
+	updated, err := s.UpdateProduct(ctx, catalog.Product{Id: shirt.Id, Variants: want[1:]}, []string{catalog.FieldVariants})
+	if err != nil {
+		t.Fatalf("UpdateProduct: %v", err)
+	}
+	if !reflect.DeepEqual(updated.Variants, want[1:]) || updated.Price != usd(2000) {
+		t.Errorf("UpdateProduct = %+v, want only the large variant left", updated)
+	}
+	products, err := s.ListProductsBySKUs(ctx, []string{"SHIRT-L", "SHIRT-M"})
+	if err != nil {
+		t.Fatalf("ListProductsBySKUs: %v", err)
+	}
+	if len(*products) != 1 || (*products)[0].Id != shirt.Id {
+		t.Errorf("ListProductsBySKUs = %+v, want the shirt", *products)
+	}
+
+	// Variants are stocked under their SKU, never under their product's id.
+	if _, err := s.SetStock(ctx, "SHIRT-L", 3); err != nil {
+		t.Errorf("SetStock of a variant: %v", err)
+	}
+	if _, err := s.SetStock(ctx, "SHIRT-M", 3); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("SetStock of a removed variant error = %v, want catalog.ErrNotFound", err)
+	}
+	if _, err := s.SetStock(ctx, shirt.Id, 3); !errors.Is(err, catalog.ErrVariantRequired) {
+		t.Errorf("SetStock of a product with variants error = %v, want catalog.ErrVariantRequired", err)
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	s := catalog.NewService(catalog.NewMemoryRepository(), catalog.NewMemoryInventory())
+	ctx := context.Background()
+	if _, err := s.PostProduct(ctx, "Shirt", "Cotton shirt", usd(2000), "", nil, []catalog.Variant{{SKU: "SHIRT-M", Price: usd(2000)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.ImportProducts(ctx, []catalog.ProductImport{
+		{Name: "Mug", Description: "Ceramic mug", Price: usd(500), Category: "Kitchen/Mugs", Tags: []string{"Gift"}},
+		{Name: "Free mug", Price: usd(-1)},
+		{Name: "Hoodie", Price: usd(4000), Variants: []catalog.Variant{{SKU: "HOODIE-M", Price: usd(4000)}}},
+		{Name: "Other hoodie", Price: usd(4000), Variants: []catalog.Variant{{SKU: "HOODIE-M", Price: usd(4000)}}},
+		{Name: "Other shirt", Price: usd(2000), Variants: []catalog.Variant{{SKU: "SHIRT-M", Price: usd(2000)}}},
+	})
+	if err != nil {
+		t.Fatalf("ImportProducts: %v", err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("ImportProducts returned %d results, want 5", len(results))
+	}
+	wantErrs := []error{nil, catalog.ErrInvalidPrice, nil, catalog.ErrSKUExists, catalog.ErrSKUExists}
+	for i, r := range results {
+		if r.Row != i+1 {
+			t.Errorf("result %d is for row %d", i, r.Row)
+		}
+		if !errors.Is(r.Err, wantErrs[i]) || (r.Err == nil) != (wantErrs[i] == nil) {
+			t.Errorf("row %d error = %v, want %v", r.Row, r.Err, wantErrs[i])
+		}
+	}
+
+	// Imported products are normalized and stored like posted ones.
+	mug := results[0].Product
+	if mug.Id == "" || mug.Category != "Kitchen/Mugs" || !reflect.DeepEqual(mug.Tags, []string{"gift"}) {
+		t.Errorf("imported %+v, want a normalized mug with an id", mug)
+	}
+	if stored, err := s.GetProduct(ctx, mug.Id); err != nil || stored.Name != "Mug" {
+		t.Errorf("GetProduct of the imported mug = %+v, %v", stored, err)
+	}
+	products, err := s.ListProductsBySKUs(ctx, []string{"HOODIE-M"})
+	if err != nil {
+		t.Fatalf("ListProductsBySKUs: %v", err)
+	}
+	if len(*products) != 1 || (*products)[0].Id != results[2].Product.Id {
+		t.Errorf("ListProductsBySKUs = %+v, want only the first hoodie", *products)
+	}
+}
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
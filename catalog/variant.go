@@ -0,0 +1,115 @@
+package catalog
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrInvalidVariant  = errs.New(errs.InvalidArgument, "variants need distinct SKUs without spaces and named attributes")
+	ErrSKUExists       = errs.New(errs.AlreadyExists, "SKU belongs to another product")
+	ErrVariantRequired = errs.New(errs.InvalidArgument, "product comes in variants; name one of them by its SKU")
+)
+
+// Variant is a version of a product, such as a size or a color, sold under
+// its own SKU at its own price. SKUs are unique across the catalog, and the
+// stock of a variant is kept under its SKU.
+type Variant struct {
+	SKU string `json:"sku"`
+	// Attributes tell the variants of a product apart, such as
+	// {"size": "M", "color": "red"}. They are nil rather than empty.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Price      money.Money       `json:"price"`
+}
+
+// Variant returns the variant of the product with sku.
+func (p Product) Variant(sku string) (Variant, bool) {
+	for _, v := range p.Variants {
+		if v.SKU == sku && sku != "" {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// normalizeVariants trims the SKUs and attributes of variants, keeping their
+// order, and returns nil if there are none.
+func normalizeVariants(variants []Variant) ([]Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	normalized := make([]Variant, len(variants))
+	skus := map[string]bool{}
+	for i, v := range variants {
+		sku := strings.TrimSpace(v.SKU)
+		if sku == "" || strings.ContainsFunc(sku, unicode.IsSpace) || skus[sku] {
+			return nil, ErrInvalidVariant
+		}
+		skus[sku] = true
+		normalized[i] = Variant{SKU: sku, Price: v.Price}
+		for name, value := range v.Attributes {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				return nil, ErrInvalidVariant
+			}
+			if normalized[i].Attributes == nil {
+				normalized[i].Attributes = map[string]string{}
+			}
+			normalized[i].Attributes[name] = strings.TrimSpace(value)
+		}
+	}
+	return normalized, nil
+}
+
+// checkSKUs fails with ErrSKUExists if another product has a variant with
+// one of the SKUs of product. Elasticsearch searches lag behind writes, so
+// two writes racing for the same SKU can both pass there; Postgres keeps
+// SKUs unique and fails the second of them anyway.
+func (c *catalogService) checkSKUs(ctx context.Context, product Product) error {
+	if len(product.Variants) == 0 {
+		return nil
+	}
+	skus := []string{}
+	for _, v := range product.Variants {
+		skus = append(skus, v.SKU)
+	}
+	owners, err := c.repository.ListProductsWithSKUs(ctx, skus)
+	if err != nil {
+		return err
+	}
+	for _, owner := range *owners {
+		if owner.Id != product.Id {
+			return ErrSKUExists
+		}
+	}
+	return nil
+}
+
+// ListProductsBySKUs returns the products having variants with any of the
+// SKUs.
+func (c *catalogService) ListProductsBySKUs(ctx context.Context, skus []string) (*[]Product, error) {
+	return c.repository.ListProductsWithSKUs(ctx, skus)
+}
+
+// checkStockSKU makes sure stock can be kept under sku: it must be the SKU
+// of a variant, or the id of a product without variants.
+func (c *catalogService) checkStockSKU(ctx context.Context, sku string) error {
+	owners, err := c.repository.ListProductsWithSKUs(ctx, []string{sku})
+	if err != nil {
+		return err
+	}
+	if len(*owners) > 0 {
+		return nil
+	}
+	product, err := c.repository.GetProductByID(ctx, sku)
+	if err != nil {
+		return err
+	}
+	if len(product.Variants) > 0 {
+		return ErrVariantRequired
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package errs is the error model shared by the services. Repositories and
+// services return *Error values carrying a Code; the gRPC interceptors in
+// this package turn them into status codes on the server and back into
+// *Error values in the clients, and the GraphQL gateway exposes the Code to
+// its callers.
+package errs
+
+import "errors"
+
+// Code classifies an error. The values double as the machine-readable codes
+// seen by API clients, so they must not change.
+type Code string
+
+const (
+	NotFound           Code = "NOT_FOUND"
+	InvalidArgument    Code = "INVALID_ARGUMENT"
+	AlreadyExists      Code = "ALREADY_EXISTS"
+	FailedPrecondition Code = "FAILED_PRECONDITION"
+	Aborted            Code = "ABORTED"
+	Unavailable        Code = "UNAVAILABLE"
+	Unauthenticated    Code = "UNAUTHENTICATED"
+	PermissionDenied   Code = "PERMISSION_DENIED"
+)
+
+// Error is a domain error. Message is safe to show to callers; Err, if set,
+// is the underlying cause and stays on the side that produced it.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap returns an error of the given code that keeps err as its cause.
+func Wrap(code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors with the same code and message, so a sentinel such as
+// account.ErrNotFound still matches once it has crossed a gRPC call.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Message == e.Message
+}
+
+// CodeOf returns the code of the first *Error in err's chain, or "" if there
+// is none.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
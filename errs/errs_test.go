@@ -0,0 +1,83 @@
+package errs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRoundTrip(t *testing.T) {
+	sentinel := New(NotFound, "account not found")
+	err := ToStatus(fmt.Errorf("loading account: %w", sentinel))
+	if got := status.Code(err); got != codes.NotFound {
+		t.Fatalf("status code = %v, want %v", got, codes.NotFound)
+	}
+
+	back := FromStatus(err)
+	if !errors.Is(back, sentinel) {
+		t.Errorf("FromStatus(%v) does not match the sentinel", back)
+	}
+	if CodeOf(back) != NotFound {
+		t.Errorf("CodeOf = %q, want %q", CodeOf(back), NotFound)
+	}
+}
+
+func TestToStatusHidesUnknownErrors(t *testing.T) {
+	err := ToStatus(errors.New("pq: relation \"accounts\" does not exist"))
+	st, _ := status.FromError(err)
+	if st.Code() != codes.Internal || st.Message() != "internal error" {
+		t.Errorf("ToStatus = %v, want a bare internal error", err)
+	}
+	if FromStatus(err) != err {
+		t.Errorf("FromStatus translated an internal error")
+	}
+}
+
+func TestToStatusKeepsCause(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := Wrap(Unavailable, "database unavailable", cause)
+	if !errors.Is(err, cause) {
+		t.Errorf("Wrap lost its cause")
+	}
+	st, _ := status.FromError(ToStatus(err))
+	if st.Code() != codes.Unavailable || st.Message() != "database unavailable" {
+		t.Errorf("ToStatus = %v, want the message without its cause", st.Err())
+	}
+}
+
+func TestFromStatusWithoutDetails(t *testing.T) {
+	err := FromStatus(status.Error(codes.PermissionDenied, "permission denied"))
+	if CodeOf(err) != PermissionDenied {
+		t.Errorf("CodeOf = %q, want %q", CodeOf(err), PermissionDenied)
+	}
+	if got := ToStatus(context.Canceled); status.Code(got) != codes.Canceled {
+		t.Errorf("ToStatus(context.Canceled) = %v", got)
+	}
+}
+
+func TestFromSQL(t *testing.T) {
+	notFound := New(NotFound, "account not found")
+	if err := FromSQL(nil, "account", notFound); err != nil {
+		t.Errorf("FromSQL(nil) = %v", err)
+	}
+	if err := FromSQL(fmt.Errorf("scanning: %w", sql.ErrNoRows), "account", notFound); err != notFound {
+		t.Errorf("FromSQL(sql.ErrNoRows) = %v, want %v", err, notFound)
+	}
+	if err := FromSQL(sql.ErrNoRows, "order", nil); err != sql.ErrNoRows {
+		t.Errorf("FromSQL(sql.ErrNoRows) without notFound = %v, want it unchanged", err)
+	}
+	err := FromSQL(driver.ErrBadConn, "account", notFound)
+	if CodeOf(err) != Unavailable || !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("FromSQL(driver.ErrBadConn) = %v, want Unavailable with the cause", err)
+	}
+	other := errors.New("pq: syntax error")
+	if err := FromSQL(other, "account", notFound); err != other {
+		t.Errorf("FromSQL(%v) = %v, want it unchanged", other, err)
+	}
+}
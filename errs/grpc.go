@@ -0,0 +1,154 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Domain identifies this project's errors in the ErrorInfo detail attached
+// to status errors.
+const Domain = "microservice-com-temp"
+
+var grpcCodes = map[Code]codes.Code{
+	NotFound:           codes.NotFound,
+	InvalidArgument:    codes.InvalidArgument,
+	AlreadyExists:      codes.AlreadyExists,
+	FailedPrecondition: codes.FailedPrecondition,
+	Aborted:            codes.Aborted,
+	Unavailable:        codes.Unavailable,
+	Unauthenticated:    codes.Unauthenticated,
+	PermissionDenied:   codes.PermissionDenied,
+}
+
+var domainCodes = map[codes.Code]Code{}
+
+func init() {
+	for code, grpcCode := range grpcCodes {
+		domainCodes[grpcCode] = code
+	}
+}
+
+// ToStatus converts err into a gRPC status error. Domain errors keep their
+// code and message and carry an ErrorInfo detail; errors that already are
+// status errors pass through. Anything else is logged and reported as
+// codes.Internal without its message, so storage details do not leak.
+func ToStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		st := status.New(grpcCodes[e.Code], e.Message)
+		if detailed, derr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(e.Code), Domain: Domain}); derr == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	log.Println(err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// FromStatus converts a status error returned by a call back into an
+// *Error. Status codes without a domain counterpart are returned unchanged.
+func FromStatus(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || err == nil {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == Domain {
+			return New(Code(info.Reason), st.Message())
+		}
+	}
+	if code, ok := domainCodes[st.Code()]; ok {
+		return New(code, st.Message())
+	}
+	return err
+}
+
+// UnaryServerInterceptor converts the errors returned by handlers with
+// ToStatus. Install it first so it also sees errors of later interceptors.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		resp, err := handler(ctx, req)
+		return resp, ToStatus(err)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return ToStatus(handler(srv, ss))
+	}
+}
+
+// UnaryClientInterceptor converts the errors of calls with FromStatus.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return FromStatus(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientInterceptor is the streaming counterpart of
+// UnaryClientInterceptor.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, FromStatus(err)
+		}
+		return &clientStream{ClientStream: stream}, nil
+	}
+}
+
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	return FromStatus(s.ClientStream.SendMsg(m))
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	return FromStatus(s.ClientStream.RecvMsg(m))
+}
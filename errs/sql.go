@@ -0,0 +1,25 @@
+package errs
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+)
+
+// FromSQL translates errors from database/sql into the shared error model
+// for the named service's database: a missing row becomes notFound, unless
+// that is nil, and a lost connection becomes Unavailable. Anything else is
+// returned unchanged.
+func FromSQL(err error, service string, notFound error) error {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return nil
+	case notFound != nil && errors.Is(err, sql.ErrNoRows):
+		return notFound
+	case errors.Is(err, driver.ErrBadConn), errors.As(err, &netErr):
+		return Wrap(Unavailable, service+" database is unavailable", err)
+	}
+	return err
+}
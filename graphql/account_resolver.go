@@ -24,13 +24,17 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 	for _, o := range orderList {
 		var products []*OrderedProduct
 		for _, p := range o.Products {
-			products = append(products, &OrderedProduct{
+			product := &OrderedProduct{
 				ID:          p.Id,
 				Name:        p.Name,
 				Description: p.Description,
 				Price:       p.Price,
 				Quantity:    int(p.Quantity),
-			})
+			}
+			if p.SKU != "" {
+				product.Sku = &p.SKU
+			}
+			products = append(products, product)
 		}
 		orders = append(orders, &Order{
 			ID:         o.Id,
@@ -42,3 +46,89 @@ func (r *accountResolver) Orders(ctx context.Context, obj *Account) ([]*Order, e
 
 	return orders, nil
 }
+
+func (r *accountResolver) Addresses(ctx context.Context, obj *Account) ([]*Address, error) {
+	if err := authorizeAccount(ctx, obj.ID); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	addressList, err := r.server.accountClient.GetAddresses(ctx, obj.ID)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	addresses := []*Address{}
+	for _, a := range addressList {
+		addresses = append(addresses, &Address{
+			ID:              a.ID,
+			Recipient:       a.Recipient,
+			Line1:           a.Line1,
+			Line2:           a.Line2,
+			City:            a.City,
+			Region:          a.Region,
+			PostalCode:      a.PostalCode,
+			Country:         a.Country,
+			DefaultShipping: a.DefaultShipping,
+			DefaultBilling:  a.DefaultBilling,
+		})
+	}
+	return addresses, nil
+}
+
+func (r *accountResolver) AuditLog(ctx context.Context, obj *Account, take *int, cursor *string) (*AuditLogPage, error) {
+	if err := authorizeAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	takeValue := uint64(0)
+	if take != nil {
+		if *take < 0 {
+			return nil, ErrInvalidParameter
+		}
+		takeValue = uint64(*take)
+	}
+	cursorValue := ""
+	if cursor != nil {
+		cursorValue = *cursor
+	}
+
+	entryList, nextCursor, err := r.server.accountClient.ListAccountAudit(ctx, obj.ID, cursorValue, takeValue)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	entries := []*AuditEntry{}
+	for _, e := range *entryList {
+		entry := &AuditEntry{
+			ID:        e.ID,
+			Action:    e.Action,
+			CreatedAt: e.CreatedAt,
+		}
+		if e.ActorID != "" {
+			entry.ActorID = &e.ActorID
+		}
+		if e.Before != nil {
+			before := string(e.Before)
+			entry.Before = &before
+		}
+		if e.After != nil {
+			after := string(e.After)
+			entry.After = &after
+		}
+		entries = append(entries, entry)
+	}
+
+	page := &AuditLogPage{Entries: entries}
+	if nextCursor != "" {
+		page.NextCursor = &nextCursor
+	}
+	return page, nil
+}
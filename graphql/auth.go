@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnauthenticated = errs.New(errs.Unauthenticated, "unauthenticated")
+	ErrInvalidToken    = errs.New(errs.Unauthenticated, "invalid access token")
+	ErrForbidden       = errs.New(errs.PermissionDenied, "forbidden")
+)
+
+// tokenClaims are the claims of an access token; the subject is the account
+// id.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// TokenAuthority issues and verifies the signed access tokens handed out by
+// the login mutation.
+type TokenAuthority struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenAuthority(secret []byte, ttl time.Duration) *TokenAuthority {
+	return &TokenAuthority{secret: secret, ttl: ttl}
+}
+
+func (t *TokenAuthority) Issue(id authz.Identity) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(t.ttl)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   id.AccountID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Roles: id.Roles,
+	})
+	signed, err := token.SignedString(t.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+func (t *TokenAuthority) Verify(token string) (authz.Identity, error) {
+	claims := tokenClaims{}
+	_, err := jwt.ParseWithClaims(
+		token,
+		&claims,
+		func(*jwt.Token) (interface{}, error) { return t.secret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" {
+		return authz.Identity{}, ErrInvalidToken
+	}
+	return authz.Identity{AccountID: claims.Subject, Roles: claims.Roles}, nil
+}
+
+// APIKeyAuthenticator resolves an API key to the account owning it.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (account.Account, error)
+}
+
+// Middleware resolves the caller from the Authorization header, which holds
+// either "Bearer <access token>" or "ApiKey <key>". Requests without the
+// header pass through anonymously; requests with a bad token or key are
+// rejected. The identity is forwarded to the services on every call made
+// while resolving the request.
+func (t *TokenAuthority) Middleware(apiKeys APIKeyAuthenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var id authz.Identity
+		var err error
+		if key, found := strings.CutPrefix(header, "ApiKey "); found {
+			id, err = authenticateAPIKey(r.Context(), apiKeys, key)
+		} else if token, found := strings.CutPrefix(header, "Bearer "); found {
+			id, err = t.Verify(token)
+		} else {
+			err = ErrInvalidToken
+		}
+		if errs.CodeOf(err) == errs.Unauthenticated {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(authz.ContextWithIdentity(r.Context(), id)))
+	})
+}
+
+func authenticateAPIKey(ctx context.Context, apiKeys APIKeyAuthenticator, key string) (authz.Identity, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	a, err := apiKeys.AuthenticateAPIKey(ctx, key)
+	if err != nil {
+		return authz.Identity{}, err
+	}
+	return authz.Identity{AccountID: a.ID, Roles: []string{a.Role}}, nil
+}
+
+// authorizeAccount checks that the caller is acting on their own account, or
+// is an admin.
+func authorizeAccount(ctx context.Context, accountID string) error {
+	caller, ok := authz.IdentityFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if caller.AccountID != accountID && !caller.HasRole(authz.RoleAdmin) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// authorizeAdmin checks that the caller is an admin.
+func authorizeAdmin(ctx context.Context) error {
+	caller, ok := authz.IdentityFromContext(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !caller.HasRole(authz.RoleAdmin) {
+		return ErrForbidden
+	}
+	return nil
+}
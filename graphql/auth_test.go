@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("test secret")
+
+var alice = authz.Identity{AccountID: "alice", Roles: []string{authz.RoleCustomer}}
+
+// signToken signs claims for alice with the given method and key.
+func signToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.Claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func aliceClaims(expiresAt time.Time) tokenClaims {
+	return tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{Subject: alice.AccountID, ExpiresAt: jwt.NewNumericDate(expiresAt)},
+		Roles:            alice.Roles,
+	}
+}
+
+func TestTokenAuthorityVerify(t *testing.T) {
+	tokens := NewTokenAuthority(testSecret, time.Hour)
+	valid, expiresAt, err := tokens.Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if d := time.Until(expiresAt); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("Issue expires in %v, want an hour", d)
+	}
+	expired, _, err := NewTokenAuthority(testSecret, -time.Minute).Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	otherSecret, _, err := NewTokenAuthority([]byte("other secret"), time.Hour).Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	later := time.Now().Add(time.Hour)
+
+	for _, tc := range []struct {
+		desc  string
+		token string
+		valid bool
+	}{
+		{"valid", valid, true},
+		{"expired", expired, false},
+		{"signed with another secret", otherSecret, false},
+		{"tampered signature", valid[:len(valid)-2] + "AA", false},
+		{"alg none", signToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, aliceClaims(later)), false},
+		{"alg HS512", signToken(t, jwt.SigningMethodHS512, testSecret, aliceClaims(later)), false},
+		{"no expiry", signToken(t, jwt.SigningMethodHS256, testSecret, tokenClaims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}}), false},
+		{"no subject", signToken(t, jwt.SigningMethodHS256, testSecret, tokenClaims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(later)}}), false},
+		{"garbage", "not.a.token", false},
+		{"empty", "", false},
+	} {
+		id, err := tokens.Verify(tc.token)
+		if tc.valid {
+			if err != nil {
+				t.Errorf("%s: Verify: %v", tc.desc, err)
+			} else if id.AccountID != alice.AccountID || !slices.Equal(id.Roles, alice.Roles) {
+				t.Errorf("%s: Verify = %+v, want %+v", tc.desc, id, alice)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: Verify error = %v, want ErrInvalidToken", tc.desc, err)
+		}
+	}
+}
+
+// apiKeys authenticates the key "good" as an admin account, and fails with
+// a non-domain error for the key "broken".
+type apiKeys struct{}
+
+func (apiKeys) AuthenticateAPIKey(ctx context.Context, key string) (account.Account, error) {
+	switch key {
+	case "good":
+		return account.Account{ID: "bot", Role: authz.RoleAdmin}, nil
+	case "broken":
+		return account.Account{}, errors.New("connection refused")
+	}
+	return account.Account{}, account.ErrInvalidAPIKey
+}
+
+func TestMiddleware(t *testing.T) {
+	tokens := NewTokenAuthority(testSecret, time.Hour)
+	token, _, err := tokens.Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	var seen *authz.Identity
+	handler := tokens.Middleware(apiKeys{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := authz.IdentityFromContext(r.Context())
+		seen = &id
+	}))
+
+	for _, tc := range []struct {
+		desc   string
+		header string
+		status int
+		caller string
+	}{
+		{"anonymous", "", http.StatusOK, ""},
+		{"bearer token", "Bearer " + token, http.StatusOK, "alice"},
+		{"lowercase bearer", "bearer " + token, http.StatusUnauthorized, ""},
+		{"bearer without a space", "Bearer" + token, http.StatusUnauthorized, ""},
+		{"bearer with two spaces", "Bearer  " + token, http.StatusUnauthorized, ""},
+		{"bearer without a token", "Bearer ", http.StatusUnauthorized, ""},
+		{"token without a scheme", token, http.StatusUnauthorized, ""},
+		{"unknown scheme", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, ""},
+		{"api key", "ApiKey good", http.StatusOK, "bot"},
+		{"unknown api key", "ApiKey bad", http.StatusUnauthorized, ""},
+		{"api key as a bearer token", "Bearer good", http.StatusUnauthorized, ""},
+		{"api key lookup failing", "ApiKey broken", http.StatusInternalServerError, ""},
+	} {
+		seen = nil
+		r := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+		if tc.header != "" {
+			r.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.desc, w.Code, tc.status)
+		}
+		if tc.status != http.StatusOK {
+			if seen != nil {
+				t.Errorf("%s: request reached the handler", tc.desc)
+			}
+			continue
+		}
+		if seen == nil || seen.AccountID != tc.caller {
+			t.Errorf("%s: handler saw %+v, want caller %q", tc.desc, seen, tc.caller)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// codeInternal is reported for errors that carry no domain code.
+const codeInternal = "INTERNAL"
+
+// presentError adds a machine-readable code to every error in the response,
+// under extensions.code. Domain errors from the services keep their code;
+// errors that already have one, such as validation errors, are left alone.
+func presentError(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	if _, ok := gqlErr.Extensions["code"]; ok {
+		return gqlErr
+	}
+	code := string(errs.CodeOf(err))
+	if code == "" {
+		code = codeInternal
+	}
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]interface{}{}
+	}
+	gqlErr.Extensions["code"] = code
+	return gqlErr
+}
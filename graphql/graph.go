@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	"github.com/Mostbesep/microservice-com-temp/catalog"
 	"github.com/Mostbesep/microservice-com-temp/order"
 )
@@ -11,23 +12,24 @@ type Server struct {
 	accountClient *account.Client
 	catalogClient *catalog.Client
 	orderClient   *order.Client
+	tokens        *TokenAuthority
 }
 
-func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error) {
-	accountClient, err := account.NewClient(accountUrl)
+func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string, key authz.Key, tokens *TokenAuthority) (*Server, error) {
+	accountClient, err := account.NewClient(accountUrl, key)
 
 	if err != nil {
 		accountClient.Close()
 		return nil, err
 	}
 
-	catalogClient, err := catalog.NewClient(catalogUrl)
+	catalogClient, err := catalog.NewClient(catalogUrl, key)
 
 	if err != nil {
 		catalogClient.Close()
 		return nil, err
 	}
-	orderClient, err := order.NewClient(orderUrl)
+	orderClient, err := order.NewClient(orderUrl, key)
 
 	if err != nil {
 		orderClient.Close()
@@ -38,6 +40,7 @@ func NewGraphQLServer(accountUrl, catalogUrl, orderUrl string) (*Server, error)
 		accountClient: accountClient,
 		catalogClient: catalogClient,
 		orderClient:   orderClient,
+		tokens:        tokens,
 	}, nil
 }
 
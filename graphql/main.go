@@ -3,15 +3,22 @@ package main
 import (
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	"github.com/kelseyhightower/envconfig"
 	"log"
 	"net/http"
+	"time"
 )
 
 type AppConfig struct {
-	AccountURL string `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
-	CatalogURL string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
-	OrderURL   string `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	AccountURL string        `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
+	CatalogURL string        `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+	OrderURL   string        `envconfig:"ORDER_SERVICE_URL" required:"true"`
+	JWTSecret  string        `envconfig:"JWT_SECRET" required:"true"`
+	TokenTTL   time.Duration `envconfig:"TOKEN_TTL" default:"24h"`
+	// IdentityKey signs the caller identities forwarded to the services,
+	// which must share it. At least 32 bytes.
+	IdentityKey authz.Key `envconfig:"IDENTITY_KEY" required:"true"`
 }
 
 func main() {
@@ -21,7 +28,8 @@ func main() {
 		log.Fatal(err)
 	}
 
-	s, err := NewGraphQLServer(cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL)
+	tokens := NewTokenAuthority([]byte(cfg.JWTSecret), cfg.TokenTTL)
+	s, err := NewGraphQLServer(cfg.AccountURL, cfg.CatalogURL, cfg.OrderURL, cfg.IdentityKey, tokens)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -29,7 +37,9 @@ func main() {
 	// use deprecated NewDefaultServer instead New reason: use playground option in browser
 	// for handle err in response:
 	// [{"message":"transport not supported"}],"data":null}
-	http.Handle("/graphql", handler.NewDefaultServer(s.ToExecutableSchema()))
+	srv := handler.NewDefaultServer(s.ToExecutableSchema())
+	srv.SetErrorPresenter(presentError)
+	http.Handle("/graphql", tokens.Middleware(s.accountClient, srv))
 	http.Handle("/playground", playground.Handler("GraphQL playground", "/graphql"))
 
 	log.Fatal(http.ListenAndServe(":8080", nil))
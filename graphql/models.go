@@ -3,5 +3,7 @@ package main
 type Account struct {
 	ID     string  `json:"id"`
 	Name   string  `json:"name"`
+	Email  string  `json:"email"`
+	Status string  `json:"status"`
 	Orders []Order `json:"orders"`
 }
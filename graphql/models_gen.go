@@ -3,11 +3,61 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"strconv"
 	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/money"
 )
 
 type AccountInput struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type AccountPage struct {
+	Accounts   []*Account `json:"accounts"`
+	NextCursor *string    `json:"nextCursor,omitempty"`
+}
+
+type Address struct {
+	ID              string `json:"id"`
+	Recipient       string `json:"recipient"`
+	Line1           string `json:"line1"`
+	Line2           string `json:"line2"`
+	City            string `json:"city"`
+	Region          string `json:"region"`
+	PostalCode      string `json:"postalCode"`
+	Country         string `json:"country"`
+	DefaultShipping bool   `json:"defaultShipping"`
+	DefaultBilling  bool   `json:"defaultBilling"`
+}
+
+type AuditEntry struct {
+	ID        string    `json:"id"`
+	ActorID   *string   `json:"actorId,omitempty"`
+	Action    string    `json:"action"`
+	Before    *string   `json:"before,omitempty"`
+	After     *string   `json:"after,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type AuditLogPage struct {
+	Entries    []*AuditEntry `json:"entries"`
+	NextCursor *string       `json:"nextCursor,omitempty"`
+}
+
+type AuthPayload struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Account   *Account  `json:"account"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 type Mutation struct {
@@ -16,26 +66,27 @@ type Mutation struct {
 type Order struct {
 	ID         string            `json:"id"`
 	CreatedAt  time.Time         `json:"createdAt"`
-	TotalPrice float64           `json:"totalPrice"`
+	TotalPrice money.Money       `json:"totalPrice"`
 	Products   []*OrderedProduct `json:"products"`
 }
 
 type OrderInput struct {
-	AccountID string               `json:"AccountId"`
-	Products  []*OrderProductInput `json:"Products"`
+	Products []*OrderProductInput `json:"Products"`
 }
 
 type OrderProductInput struct {
-	ID       string `json:"id"`
-	Quantity int    `json:"quantity"`
+	ID       *string `json:"id,omitempty"`
+	Sku      *string `json:"sku,omitempty"`
+	Quantity int     `json:"quantity"`
 }
 
 type OrderedProduct struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Quantity    int     `json:"quantity"`
+	ID          string      `json:"id"`
+	Sku         *string     `json:"sku,omitempty"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+	Quantity    int         `json:"quantity"`
 }
 
 type PaginationInput struct {
@@ -43,18 +94,165 @@ type PaginationInput struct {
 	Take int `json:"take"`
 }
 
+type PriceBucket struct {
+	From  *int `json:"from,omitempty"`
+	To    *int `json:"to,omitempty"`
+	Count int  `json:"count"`
+}
+
 type Product struct {
-	ID          string  `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Price       money.Money       `json:"price"`
+	Category    string            `json:"category"`
+	Tags        []string          `json:"tags"`
+	Variants    []*ProductVariant `json:"variants"`
+	CreatedAt   *time.Time        `json:"createdAt,omitempty"`
+	Version     *string           `json:"version,omitempty"`
+}
+
+type ProductFacets struct {
+	Categories []*FacetCount  `json:"categories"`
+	Tags       []*FacetCount  `json:"tags"`
+	Prices     []*PriceBucket `json:"prices"`
 }
 
 type ProductInput struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Price       money.Money            `json:"price"`
+	Category    *string                `json:"category,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Variants    []*ProductVariantInput `json:"variants,omitempty"`
+}
+
+type ProductSearchResult struct {
+	Hits   []*Product     `json:"hits"`
+	Facets *ProductFacets `json:"facets"`
+}
+
+type ProductVariant struct {
+	Sku        string              `json:"sku"`
+	Attributes []*VariantAttribute `json:"attributes"`
+	Price      money.Money         `json:"price"`
+}
+
+type ProductVariantInput struct {
+	Sku        string                   `json:"sku"`
+	Attributes []*VariantAttributeInput `json:"attributes,omitempty"`
+	Price      money.Money              `json:"price"`
 }
 
 type Query struct {
 }
+
+type UpdateAccountInput struct {
+	Name string `json:"name"`
+}
+
+type UpdateProductInput struct {
+	Name        *string                `json:"name,omitempty"`
+	Description *string                `json:"description,omitempty"`
+	Price       *money.Money           `json:"price,omitempty"`
+	Category    *string                `json:"category,omitempty"`
+	Tags        []string               `json:"tags,omitempty"`
+	Variants    []*ProductVariantInput `json:"variants,omitempty"`
+	Version     *string                `json:"version,omitempty"`
+}
+
+type VariantAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type VariantAttributeInput struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type ProductSort string
+
+const (
+	ProductSortRelevance ProductSort = "RELEVANCE"
+	ProductSortPrice     ProductSort = "PRICE"
+	ProductSortName      ProductSort = "NAME"
+	ProductSortCreatedAt ProductSort = "CREATED_AT"
+)
+
+var AllProductSort = []ProductSort{
+	ProductSortRelevance,
+	ProductSortPrice,
+	ProductSortName,
+	ProductSortCreatedAt,
+}
+
+func (e ProductSort) IsValid() bool {
+	switch e {
+	case ProductSortRelevance, ProductSortPrice, ProductSortName, ProductSortCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e ProductSort) String() string {
+	return string(e)
+}
+
+func (e *ProductSort) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSort(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSort", str)
+	}
+	return nil
+}
+
+func (e ProductSort) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SortDirection string
+
+const (
+	SortDirectionAsc  SortDirection = "ASC"
+	SortDirectionDesc SortDirection = "DESC"
+)
+
+var AllSortDirection = []SortDirection{
+	SortDirectionAsc,
+	SortDirectionDesc,
+}
+
+func (e SortDirection) IsValid() bool {
+	switch e {
+	case SortDirectionAsc, SortDirectionDesc:
+		return true
+	}
+	return false
+}
+
+func (e SortDirection) String() string {
+	return string(e)
+}
+
+func (e *SortDirection) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortDirection(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortDirection", str)
+	}
+	return nil
+}
+
+func (e SortDirection) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/Mostbesep/microservice-com-temp/money"
+)
+
+// MarshalMoney writes the Money scalar as its amount and currency, such as
+// "12.99 USD", so amounts keep their exact value over JSON.
+func MarshalMoney(m money.Money) graphql.Marshaler {
+	return graphql.MarshalString(m.String())
+}
+
+// UnmarshalMoney reads the Money scalar written the way MarshalMoney writes
+// it; decimals may be cut short, as in "12.5 USD".
+func UnmarshalMoney(v interface{}) (money.Money, error) {
+	s, ok := v.(string)
+	if !ok {
+		return money.Money{}, money.ErrInvalidAmount
+	}
+	return money.Parse(s)
+}
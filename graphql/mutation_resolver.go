@@ -2,69 +2,91 @@ package main
 
 import (
 	"context"
-	"errors"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
 	"github.com/Mostbesep/microservice-com-temp/order"
 	"log"
 	"time"
 )
 
 var (
-	ErrInvalidParameter = errors.New("invalid parameter")
+	ErrInvalidParameter = errs.New(errs.InvalidArgument, "invalid parameter")
 )
 
 type mutationResolver struct {
 	server *Server
 }
 
-func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput) (*Account, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+// withIdempotencyKey attaches the key given to a create mutation, if any, to
+// the context of the service call.
+func withIdempotencyKey(ctx context.Context, key *string) context.Context {
+	if key == nil {
+		return ctx
+	}
+	return idempotency.ContextWithKey(ctx, *key)
+}
+
+func (r *mutationResolver) CreateAccount(ctx context.Context, in AccountInput, idempotencyKey *string) (*Account, error) {
+	ctx, cancel := context.WithTimeout(withIdempotencyKey(ctx, idempotencyKey), 3*time.Second)
 	defer cancel()
 
-	a, err := r.server.accountClient.PostAccount(ctx, in.Name)
+	a, err := r.server.accountClient.PostAccount(ctx, in.Name, in.Email, in.Password)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
 	return &Account{
-		ID:   a.ID,
-		Name: a.Name,
+		ID:     a.ID,
+		Name:   a.Name,
+		Email:  a.Email,
+		Status: a.Status,
 	}, nil
 }
 
-func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput) (*Product, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+func (r *mutationResolver) CreateProduct(ctx context.Context, in ProductInput, idempotencyKey *string) (*Product, error) {
+	ctx, cancel := context.WithTimeout(withIdempotencyKey(ctx, idempotencyKey), 3*time.Second)
 	defer cancel()
 
-	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price)
+	category := ""
+	if in.Category != nil {
+		category = *in.Category
+	}
+	p, err := r.server.catalogClient.PostProduct(ctx, in.Name, in.Description, in.Price, category, in.Tags, variantsFromInput(in.Variants))
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return &Product{
-		ID:          p.Id,
-		Name:        p.Name,
-		Description: p.Description,
-		Price:       p.Price,
-	}, nil
+	return productFromCatalog(*p), nil
 }
 
-func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Order, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput, idempotencyKey *string) (*Order, error) {
+	caller, ok := authz.IdentityFromContext(ctx)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+
+	ctx, cancel := context.WithTimeout(withIdempotencyKey(ctx, idempotencyKey), 3*time.Second)
 	defer cancel()
 
 	var products []order.OrderedProduct
 	for _, p := range in.Products {
-		if p.Quantity <= 0 {
+		if p.Quantity <= 0 || p.ID == nil && p.Sku == nil {
 			return nil, ErrInvalidParameter
 		}
-		products = append(products, order.OrderedProduct{
-			Id:       p.ID,
-			Quantity: uint32(p.Quantity),
-		})
+		product := order.OrderedProduct{Quantity: uint32(p.Quantity)}
+		if p.ID != nil {
+			product.Id = *p.ID
+		}
+		if p.Sku != nil {
+			product.SKU = *p.Sku
+		}
+		products = append(products, product)
 	}
-	o, err := r.server.orderClient.PostOrder(ctx, in.AccountID, products)
+	o, err := r.server.orderClient.PostOrder(ctx, caller.AccountID, products)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -76,3 +98,150 @@ func (r *mutationResolver) CreateOrder(ctx context.Context, in OrderInput) (*Ord
 		TotalPrice: o.TotalPrice,
 	}, nil
 }
+
+func (r *mutationResolver) Login(ctx context.Context, email string, password string) (*AuthPayload, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.Authenticate(ctx, email, password)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	token, expiresAt, err := r.server.tokens.Issue(authz.Identity{
+		AccountID: a.ID,
+		Roles:     []string{a.Role},
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &AuthPayload{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		Account: &Account{
+			ID:     a.ID,
+			Name:   a.Name,
+			Email:  a.Email,
+			Status: a.Status,
+		},
+	}, nil
+}
+
+func (r *mutationResolver) UpdateAccount(ctx context.Context, id string, in UpdateAccountInput) (*Account, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	a, err := r.server.accountClient.UpdateAccount(ctx, id, in.Name)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return &Account{
+		ID:     a.ID,
+		Name:   a.Name,
+		Email:  a.Email,
+		Status: a.Status,
+	}, nil
+}
+
+func (r *mutationResolver) DeleteAccount(ctx context.Context, id string) (bool, error) {
+	if err := authorizeAccount(ctx, id); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := r.server.accountClient.DeleteAccount(ctx, id); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateProduct changes the fields set in the input. If the input carries
+// the version the change is based on, it fails with ABORTED when someone
+// else changed the product since.
+func (r *mutationResolver) UpdateProduct(ctx context.Context, id string, in UpdateProductInput) (*Product, error) {
+	product := catalog.Product{Id: id}
+	fields := []string{}
+	if in.Name != nil {
+		product.Name = *in.Name
+		fields = append(fields, catalog.FieldName)
+	}
+	if in.Description != nil {
+		product.Description = *in.Description
+		fields = append(fields, catalog.FieldDescription)
+	}
+	if in.Price != nil {
+		product.Price = *in.Price
+		fields = append(fields, catalog.FieldPrice)
+	}
+	if in.Category != nil {
+		product.Category = *in.Category
+		fields = append(fields, catalog.FieldCategory)
+	}
+	if in.Tags != nil {
+		product.Tags = in.Tags
+		fields = append(fields, catalog.FieldTags)
+	}
+	if in.Variants != nil {
+		product.Variants = variantsFromInput(in.Variants)
+		fields = append(fields, catalog.FieldVariants)
+	}
+	if len(fields) == 0 {
+		return nil, ErrInvalidParameter
+	}
+	if in.Version != nil {
+		product.Version = *in.Version
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	p, err := r.server.catalogClient.UpdateProduct(ctx, product, fields)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return productFromCatalog(*p), nil
+}
+
+func variantsFromInput(in []*ProductVariantInput) []catalog.Variant {
+	var variants []catalog.Variant
+	for _, v := range in {
+		variant := catalog.Variant{SKU: v.Sku, Price: v.Price}
+		for _, a := range v.Attributes {
+			if variant.Attributes == nil {
+				variant.Attributes = map[string]string{}
+			}
+			variant.Attributes[a.Name] = a.Value
+		}
+		variants = append(variants, variant)
+	}
+	return variants
+}
+
+func (r *mutationResolver) DeleteProduct(ctx context.Context, id string, version *string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	versionValue := ""
+	if version != nil {
+		versionValue = *version
+	}
+	if err := r.server.catalogClient.DeleteProduct(ctx, id, versionValue); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	return true, nil
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	"log"
+	"sort"
 	"time"
 )
 
@@ -10,7 +13,7 @@ type queryResolver struct {
 	server *Server
 }
 
-func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInput, id *string) ([]*Account, error) {
+func (r *queryResolver) Accounts(ctx context.Context, take *int, cursor *string, query *string, id *string) (*AccountPage, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -21,36 +24,59 @@ func (r *queryResolver) Accounts(ctx context.Context, pagination *PaginationInpu
 			log.Println(err)
 			return nil, err
 		}
-		return []*Account{{
-			ID:   r.ID,
-			Name: r.Name,
-		}}, nil
+		return &AccountPage{
+			Accounts: []*Account{{
+				ID:     r.ID,
+				Name:   r.Name,
+				Email:  r.Email,
+				Status: r.Status,
+			}},
+		}, nil
 	}
 
-	skip, take := uint64(0), uint64(0)
-	if pagination != nil {
-		skip, take = pagination.bounds()
+	takeValue := uint64(0)
+	if take != nil {
+		if *take < 0 {
+			return nil, ErrInvalidParameter
+		}
+		takeValue = uint64(*take)
+	}
+	cursorValue := ""
+	if cursor != nil {
+		cursorValue = *cursor
 	}
 
-	accountList, err := r.server.accountClient.GetAccounts(ctx, skip, take)
+	q := ""
+	if query != nil {
+		q = *query
+	}
+	accountList, nextCursor, err := r.server.accountClient.GetAccounts(ctx, cursorValue, takeValue, q)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	var accounts []*Account
+	accounts := []*Account{}
 	for _, a := range *accountList {
 		account := &Account{
-			ID:   a.ID,
-			Name: a.Name,
+			ID:     a.ID,
+			Name:   a.Name,
+			Email:  a.Email,
+			Status: a.Status,
 		}
 		accounts = append(accounts, account)
 	}
 
-	return accounts, nil
+	page := &AccountPage{Accounts: accounts}
+	if nextCursor != "" {
+		page.NextCursor = &nextCursor
+	}
+	return page, nil
 }
 
-func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string) ([]*Product, error) {
+// Products returns the product with id, or a page of the products matching
+// the query and price range in the order asked for.
+func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInput, query *string, id *string, minPrice *money.Money, maxPrice *money.Money, sort *ProductSort, direction *SortDirection) ([]*Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -61,12 +87,7 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 			log.Println(err)
 			return nil, err
 		}
-		return []*Product{{
-			ID:          r.Id,
-			Name:        r.Name,
-			Description: r.Description,
-			Price:       r.Price,
-		}}, nil
+		return []*Product{productFromCatalog(*r)}, nil
 	}
 
 	skip, take := uint64(0), uint64(0)
@@ -74,11 +95,12 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 		skip, take = pagination.bounds()
 	}
 
-	q := ""
+	search := catalog.ProductSearch{MinPrice: minPrice, MaxPrice: maxPrice}
 	if query != nil {
-		q = *query
+		search.Query = *query
 	}
-	productList, err := r.server.catalogClient.GetProducts(ctx, skip, take, nil, q)
+	search.Sort, search.Direction = productSort(sort, direction)
+	productList, err := r.server.catalogClient.FindProducts(ctx, search, skip, take)
 	if err != nil {
 		log.Println(err)
 		return nil, err
@@ -86,19 +108,131 @@ func (r *queryResolver) Products(ctx context.Context, pagination *PaginationInpu
 
 	var products []*Product
 	for _, a := range productList {
-		products = append(products,
-			&Product{
-				ID:          a.Id,
-				Name:        a.Name,
-				Description: a.Description,
-				Price:       a.Price,
-			},
-		)
+		products = append(products, productFromCatalog(a))
 	}
 
 	return products, nil
 }
 
+// ProductSearch returns a page of the products matching the query, category,
+// tags and price range, with the facet counts of all of them.
+func (r *queryResolver) ProductSearch(ctx context.Context, query *string, category *string, tags []string, pagination *PaginationInput, minPrice *money.Money, maxPrice *money.Money, sort *ProductSort, direction *SortDirection) (*ProductSearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	search := catalog.ProductSearch{Tags: tags, MinPrice: minPrice, MaxPrice: maxPrice}
+	if query != nil {
+		search.Query = *query
+	}
+	if category != nil {
+		search.Category = *category
+	}
+	search.Sort, search.Direction = productSort(sort, direction)
+	skip, take := uint64(0), uint64(0)
+	if pagination != nil {
+		skip, take = pagination.bounds()
+	}
+	productList, facets, err := r.server.catalogClient.SearchProducts(ctx, search, skip, take)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	result := &ProductSearchResult{
+		Hits: []*Product{},
+		Facets: &ProductFacets{
+			Categories: facetCounts(facets.Categories),
+			Tags:       facetCounts(facets.Tags),
+			Prices:     []*PriceBucket{},
+		},
+	}
+	for _, p := range productList {
+		result.Hits = append(result.Hits, productFromCatalog(p))
+	}
+	for _, b := range facets.Prices {
+		result.Facets.Prices = append(result.Facets.Prices, &PriceBucket{From: bucketBound(b.From), To: bucketBound(b.To), Count: int(b.Count)})
+	}
+	return result, nil
+}
+
+// bucketBound converts a price bucket bound, in minor units, to a GraphQL
+// Int. The catalog's bucket bounds are small enough to fit.
+func bucketBound(bound *int64) *int {
+	if bound == nil {
+		return nil
+	}
+	b := int(*bound)
+	return &b
+}
+
+// productSort translates the sort arguments, leaving what is not given to
+// the catalog's defaults.
+func productSort(sort *ProductSort, direction *SortDirection) (catalog.ProductSort, catalog.SortDirection) {
+	var s catalog.ProductSort
+	var d catalog.SortDirection
+	if sort != nil {
+		switch *sort {
+		case ProductSortRelevance:
+			s = catalog.SortRelevance
+		case ProductSortPrice:
+			s = catalog.SortPrice
+		case ProductSortName:
+			s = catalog.SortName
+		case ProductSortCreatedAt:
+			s = catalog.SortCreatedAt
+		}
+	}
+	if direction != nil {
+		switch *direction {
+		case SortDirectionAsc:
+			d = catalog.SortAscending
+		case SortDirectionDesc:
+			d = catalog.SortDescending
+		}
+	}
+	return s, d
+}
+
+func facetCounts(counts []catalog.FacetCount) []*FacetCount {
+	facets := []*FacetCount{}
+	for _, c := range counts {
+		facets = append(facets, &FacetCount{Value: c.Value, Count: int(c.Count)})
+	}
+	return facets
+}
+
+// productFromCatalog converts a catalog product, leaving Version unset if
+// the catalog did not return one.
+func productFromCatalog(p catalog.Product) *Product {
+	product := &Product{
+		ID:          p.Id,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price,
+		Category:    p.Category,
+		Tags:        p.Tags,
+	}
+	if product.Tags == nil {
+		product.Tags = []string{}
+	}
+	product.Variants = []*ProductVariant{}
+	for _, v := range p.Variants {
+		variant := &ProductVariant{Sku: v.SKU, Price: v.Price, Attributes: []*VariantAttribute{}}
+		for name, value := range v.Attributes {
+			variant.Attributes = append(variant.Attributes, &VariantAttribute{Name: name, Value: value})
+		}
+		sort.Slice(variant.Attributes, func(i, j int) bool { return variant.Attributes[i].Name < variant.Attributes[j].Name })
+		product.Variants = append(product.Variants, variant)
+	}
+	if !p.CreatedAt.IsZero() {
+		product.CreatedAt = &p.CreatedAt
+	}
+	if p.Version != "" {
+		product.Version = &p.Version
+	}
+	return product
+}
+
 func (p PaginationInput) bounds() (uint64, uint64) {
 	skipValue := uint64(0)
 	takeValue := uint64(100)
@@ -0,0 +1,111 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const elasticIndex = "idempotency"
+
+type keyDocument struct {
+	RequestHash string    `json:"request_hash"`
+	Response    []byte    `json:"response,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// elasticStore keeps records as documents of the idempotency index, for
+// services whose only datastore is Elasticsearch.
+type elasticStore struct {
+	client *elastic.Client
+}
+
+func NewElasticStore(url string) (Store, error) {
+	client, err := elastic.NewClient(
+		elastic.SetURL(url),
+		elastic.SetSniff(false),
+		elastic.SetHealthcheck(false),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &elasticStore{client: client}, nil
+}
+
+func (s *elasticStore) Close() error {
+	s.client.Stop()
+	return nil
+}
+
+// Claim creates the document, failing if it exists. An expired document is
+// replaced only if it still has the sequence number and primary term it was
+// read with, so only one call can take it over.
+func (s *elasticStore) Claim(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*Record, error) {
+	doc := keyDocument{RequestHash: requestHash, ExpiresAt: expiresAt}
+	_, err := s.client.Index().Index(elasticIndex).
+		Id(key).OpType("create").BodyJson(doc).Do(ctx)
+	if err == nil {
+		return nil, nil
+	}
+	if !elastic.IsConflict(err) {
+		return nil, err
+	}
+
+	busy := &Record{RequestHash: requestHash, ExpiresAt: expiresAt}
+	result, err := s.client.Get().Index(elasticIndex).Id(key).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return busy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	existing := keyDocument{}
+	if err = json.Unmarshal(result.Source, &existing); err != nil {
+		return nil, err
+	}
+	if existing.ExpiresAt.After(time.Now()) {
+		return &Record{
+			RequestHash: existing.RequestHash,
+			Response:    existing.Response,
+			ExpiresAt:   existing.ExpiresAt,
+		}, nil
+	}
+	if result.SeqNo == nil || result.PrimaryTerm == nil {
+		return busy, nil
+	}
+	_, err = s.client.Index().Index(elasticIndex).
+		Id(key).IfSeqNo(*result.SeqNo).IfPrimaryTerm(*result.PrimaryTerm).
+		BodyJson(doc).Do(ctx)
+	if elastic.IsConflict(err) {
+		return busy, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Complete stores the response and drops expired documents while at it.
+func (s *elasticStore) Complete(ctx context.Context, key string, response []byte, expiresAt time.Time) error {
+	_, err := s.client.Update().Index(elasticIndex).Id(key).
+		Doc(map[string]interface{}{"response": response, "expires_at": expiresAt}).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.DeleteByQuery(elasticIndex).
+		Query(elastic.NewRangeQuery("expires_at").Lte("now")).
+		ProceedOnVersionConflict().
+		Do(ctx)
+	return err
+}
+
+func (s *elasticStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.Delete().Index(elasticIndex).Id(key).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+// Package idempotency lets clients retry create calls safely. A client sends
+// an idempotency key in gRPC metadata; the server interceptor runs the first
+// call with a given key and stores its response, and replays that response
+// for later calls with the same key and request instead of running them
+// again.
+//
+// Keys are scoped by method and calling account, so two callers cannot
+// collide or read each other's results.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const keyMetadata = "idempotency-key"
+
+const maxKeyLength = 255
+
+// claimTimeout bounds how long a call holds its key before completing. A key
+// whose call crashed becomes usable again after it.
+const claimTimeout = time.Minute
+
+var (
+	ErrInvalidKey = errs.New(errs.InvalidArgument, "idempotency key must be at most 255 characters")
+	ErrKeyReused  = errs.New(errs.AlreadyExists, "idempotency key was already used for a different request")
+	ErrInProgress = errs.New(errs.Aborted, "a request with this idempotency key is still in progress")
+)
+
+type keyContextKey struct{}
+
+// ContextWithKey attaches an idempotency key to ctx. Clients built with
+// UnaryClientInterceptor send it along with the calls made with ctx.
+func ContextWithKey(ctx context.Context, key string) context.Context {
+	if key == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+func keyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(keyContextKey{}).(string)
+	return key
+}
+
+func keyFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(keyMetadata); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// UnaryClientInterceptor sends the key attached to the call's context along
+// as metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if key := keyFromContext(ctx); key != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, keyMetadata, key)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// UnaryServerInterceptor makes the given methods idempotent. Calls that carry
+// a key claim it in store; successful responses are kept for window and
+// replayed to calls with the same key and an identical request. A different
+// request under a used key fails with ErrKeyReused. Failed calls release
+// their key so they can be retried.
+//
+// Install it after the authz interceptor, which identifies the caller.
+func UnaryServerInterceptor(store Store, window time.Duration, methods ...string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		key := keyFromMetadata(ctx)
+		msg, ok := req.(proto.Message)
+		if key == "" || !ok || !slices.Contains(methods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		if len(key) > maxKeyLength {
+			return nil, ErrInvalidKey
+		}
+		requestHash, err := hash(msg)
+		if err != nil {
+			return nil, err
+		}
+		key = scopedKey(ctx, info.FullMethod, key)
+
+		existing, err := store.Claim(ctx, key, requestHash, time.Now().Add(claimTimeout))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			return replay(*existing, requestHash)
+		}
+
+		// Settle the key even if the caller has given up on the call.
+		settleCtx := context.WithoutCancel(ctx)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			if releaseErr := store.Release(settleCtx, key); releaseErr != nil {
+				log.Println(releaseErr)
+			}
+			return nil, err
+		}
+		if err = complete(settleCtx, store, key, resp, window); err != nil {
+			// The call succeeded; a retry finds the key claimed until the
+			// claim times out.
+			log.Println(err)
+		}
+		return resp, nil
+	}
+}
+
+func complete(ctx context.Context, store Store, key string, resp any, window time.Duration) error {
+	msg, ok := resp.(proto.Message)
+	if !ok {
+		return store.Release(ctx, key)
+	}
+	packed, err := anypb.New(msg)
+	if err != nil {
+		return err
+	}
+	response, err := proto.Marshal(packed)
+	if err != nil {
+		return err
+	}
+	return store.Complete(ctx, key, response, time.Now().Add(window))
+}
+
+func replay(r Record, requestHash string) (any, error) {
+	if r.RequestHash != requestHash {
+		return nil, ErrKeyReused
+	}
+	if r.Response == nil {
+		return nil, ErrInProgress
+	}
+	packed := &anypb.Any{}
+	if err := proto.Unmarshal(r.Response, packed); err != nil {
+		return nil, err
+	}
+	return packed.UnmarshalNew()
+}
+
+func hash(msg proto.Message) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// scopedKey derives the stored key from the client's key, the method and the
+// caller, so it has a fixed length and cannot collide across scopes.
+func scopedKey(ctx context.Context, method string, key string) string {
+	caller, _ := authz.IdentityFromContext(ctx)
+	sum := sha256.Sum256([]byte(method + "\x00" + caller.AccountID + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,125 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testMethod = "/test/Create"
+
+// call runs the interceptor for req with the given key and caller, counting
+// handler invocations in calls.
+func call(
+	interceptor grpc.UnaryServerInterceptor,
+	key, accountID string,
+	req proto.Message,
+	calls *int,
+	fail error,
+) (any, error) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(keyMetadata, key))
+	ctx = authz.ContextWithIdentity(ctx, authz.Identity{AccountID: accountID})
+	return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: testMethod}, func(ctx context.Context, req any) (any, error) {
+		*calls++
+		if fail != nil {
+			return nil, fail
+		}
+		return wrapperspb.String("created " + req.(*wrapperspb.StringValue).Value), nil
+	})
+}
+
+func TestReplay(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewMemoryStore(), time.Hour, testMethod)
+	calls := 0
+
+	first, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	if !proto.Equal(first.(proto.Message), second.(proto.Message)) {
+		t.Errorf("replayed %v, want %v", second, first)
+	}
+
+	if _, err = call(interceptor, "k1", "alice", wrapperspb.String("b"), &calls, nil); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("different request error = %v, want ErrKeyReused", err)
+	}
+
+	// The same key from another caller is a different key.
+	if _, err = call(interceptor, "k1", "bob", wrapperspb.String("b"), &calls, nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestFailedCallReleasesKey(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewMemoryStore(), time.Hour, testMethod)
+	calls := 0
+	failure := errors.New("boom")
+
+	if _, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, failure); err != failure {
+		t.Fatalf("error = %v, want %v", err, failure)
+	}
+	if _, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestClaimedKeyIsInProgress(t *testing.T) {
+	store := NewMemoryStore()
+	interceptor := UnaryServerInterceptor(store, time.Hour, testMethod)
+	ctx := authz.ContextWithIdentity(context.Background(), authz.Identity{AccountID: "alice"})
+	requestHash, _ := hash(wrapperspb.String("a"))
+	if _, err := store.Claim(ctx, scopedKey(ctx, testMethod, "k1"), requestHash, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	if _, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil); !errors.Is(err, ErrInProgress) {
+		t.Errorf("error = %v, want ErrInProgress", err)
+	}
+}
+
+func TestExpiredKeyRunsAgain(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewMemoryStore(), -time.Second, testMethod)
+	calls := 0
+	for i := 0; i < 2; i++ {
+		if _, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
+
+func TestUnlistedMethodsAreNotTracked(t *testing.T) {
+	interceptor := UnaryServerInterceptor(NewMemoryStore(), time.Hour)
+	calls := 0
+	for i := 0; i < 2; i++ {
+		if _, err := call(interceptor, "k1", "alice", wrapperspb.String("a"), &calls, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
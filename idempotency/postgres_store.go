@@ -0,0 +1,91 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresStore keeps records in the idempotency_keys table, which each
+// service creates in its own migrations.
+type postgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(url string) (Store, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		return nil, err
+	}
+	return &postgresStore{db: db}, nil
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Claim inserts the key, taking over an expired record in the same
+// statement so two calls cannot both claim it.
+func (s *postgresStore) Claim(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*Record, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`INSERT INTO idempotency_keys(idempotency_key, request_hash, expires_at) VALUES($1, $2, $3)
+		ON CONFLICT (idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, response = NULL, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		RETURNING idempotency_key`,
+		key,
+		requestHash,
+		expiresAt,
+	)
+	var claimed string
+	err := row.Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	r := Record{}
+	err = s.db.QueryRowContext(
+		ctx,
+		"SELECT request_hash, response, expires_at FROM idempotency_keys WHERE idempotency_key = $1",
+		key,
+	).Scan(&r.RequestHash, &r.Response, &r.ExpiresAt)
+	if err == sql.ErrNoRows {
+		// Released between the two statements; report it as still busy
+		// rather than racing for it.
+		return &Record{RequestHash: requestHash, ExpiresAt: expiresAt}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Complete stores the response and drops expired records while at it.
+func (s *postgresStore) Complete(ctx context.Context, key string, response []byte, expiresAt time.Time) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"UPDATE idempotency_keys SET response = $2, expires_at = $3 WHERE idempotency_key = $1",
+		key,
+		response,
+		expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at <= now()")
+	return err
+}
+
+func (s *postgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE idempotency_key = $1", key)
+	return err
+}
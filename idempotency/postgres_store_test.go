@@ -0,0 +1,69 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+// TestPostgresStore runs against the database in
+// IDEMPOTENCY_TEST_DATABASE_URL, migrated with the account schema.
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("IDEMPOTENCY_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("IDEMPOTENCY_TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = migrate.Up(ctx, db, account.Migrations); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec("TRUNCATE idempotency_keys"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := idempotency.NewPostgresStore(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	key := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	hash := "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	later := time.Now().Add(time.Hour)
+
+	if existing, err := s.Claim(ctx, key, hash, later); err != nil || existing != nil {
+		t.Fatalf("first Claim = %v, %v; want the key claimed", existing, err)
+	}
+	existing, err := s.Claim(ctx, key, hash, later)
+	if err != nil || existing == nil || existing.Response != nil {
+		t.Fatalf("second Claim = %v, %v; want the pending record", existing, err)
+	}
+	if err = s.Complete(ctx, key, []byte("response"), later); err != nil {
+		t.Fatal(err)
+	}
+	existing, err = s.Claim(ctx, key, hash, later)
+	if err != nil || existing == nil || string(existing.Response) != "response" {
+		t.Fatalf("Claim after Complete = %v, %v; want the stored response", existing, err)
+	}
+
+	if err = s.Release(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if existing, err = s.Claim(ctx, key, hash, time.Now().Add(-time.Second)); err != nil || existing != nil {
+		t.Fatalf("Claim after Release = %v, %v; want the key claimed", existing, err)
+	}
+	// The claim above expired at once, so it can be taken over.
+	if existing, err = s.Claim(ctx, key, hash, later); err != nil || existing != nil {
+		t.Fatalf("Claim of an expired key = %v, %v; want the key claimed", existing, err)
+	}
+}
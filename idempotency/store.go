@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Record is what a Store keeps for a key.
+type Record struct {
+	RequestHash string
+	// Response is the serialized response, or nil while the call that
+	// claimed the key is still running.
+	Response  []byte
+	ExpiresAt time.Time
+}
+
+// Store persists keys and the responses of their calls. Records past their
+// ExpiresAt are treated as absent.
+type Store interface {
+	Close() error
+	// Claim reserves key for a call with the given request hash until
+	// expiresAt. If a live record for key already exists, it is returned
+	// instead and the key is not claimed.
+	Claim(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*Record, error)
+	// Complete stores the response of the call holding key and keeps it
+	// until expiresAt.
+	Complete(ctx context.Context, key string, response []byte, expiresAt time.Time) error
+	// Release drops the claim of a call that failed.
+	Release(ctx context.Context, key string) error
+}
+
+// memoryStore keeps records in process memory, so they do not survive a
+// restart and are not shared between replicas.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{records: map[string]Record{}}
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) Claim(ctx context.Context, key string, requestHash string, expiresAt time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[key]; ok && r.ExpiresAt.After(time.Now()) {
+		return &r, nil
+	}
+	s.records[key] = Record{RequestHash: requestHash, ExpiresAt: expiresAt}
+	return nil, nil
+}
+
+func (s *memoryStore) Complete(ctx context.Context, key string, response []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.records[key]
+	r.Response = response
+	r.ExpiresAt = expiresAt
+	s.records[key] = r
+	s.purge()
+	return nil
+}
+
+func (s *memoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *memoryStore) purge() {
+	now := time.Now()
+	for key, r := range s.records {
+		if !r.ExpiresAt.After(now) {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_email.up.sql":      {Data: []byte("ALTER TABLE a ADD email TEXT;")},
+		"migrations/0002_add_email.down.sql":    {Data: []byte("ALTER TABLE a DROP email;")},
+		"migrations/0001_create_table.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"migrations/0001_create_table.down.sql": {Data: []byte("DROP TABLE a;")},
+	}
+	migrations, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if m := migrations[0]; m.Version != 1 || m.Name != "create_table" || m.Down != "DROP TABLE a;" {
+		t.Errorf("first migration = %+v", m)
+	}
+	if m := migrations[1]; m.Version != 2 || m.Name != "add_email" || m.Up != "ALTER TABLE a ADD email TEXT;" {
+		t.Errorf("second migration = %+v", m)
+	}
+}
+
+func TestLoadRejectsBadFiles(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_create.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"bad name": {
+			"m/create.up.sql": {Data: []byte("SELECT 1;")},
+		},
+		"conflicting names": {
+			"m/0001_create.up.sql":  {Data: []byte("SELECT 1;")},
+			"m/0001_other.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	} {
+		if _, err := Load(fsys, "m"); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+}
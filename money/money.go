@@ -0,0 +1,149 @@
+// Package money is the amount type shared by the services. An amount is a
+// whole number of the minor units of its currency, such as cents, so sums and
+// products of prices are exact, and it carries its ISO 4217 currency code, so
+// amounts in different currencies are never mixed up.
+package money
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Mostbesep/microservice-com-temp/errs"
+)
+
+var (
+	ErrInvalidCurrency  = errs.New(errs.InvalidArgument, "currency must be an ISO 4217 code such as USD")
+	ErrInvalidAmount    = errs.New(errs.InvalidArgument, `amount must be written as a decimal number and a currency, such as "12.99 USD", with no more decimals than the currency has`)
+	ErrCurrencyMismatch = errs.New(errs.InvalidArgument, "amounts are in different currencies")
+	ErrOverflow         = errs.New(errs.InvalidArgument, "amount is too large")
+)
+
+// Money is an amount of a currency. The zero value has no currency and is
+// not valid.
+type Money struct {
+	// Amount is in the minor units of Currency, such as cents for USD or
+	// yen for JPY.
+	Amount int64 `json:"amount"`
+	// Currency is an upper-case ISO 4217 code.
+	Currency string `json:"currency"`
+}
+
+// minorDigits holds the number of decimals of the currencies that do not
+// have two.
+var minorDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0,
+	"PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0,
+	"XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// Digits returns the number of decimals of currency, that is how many
+// minor units make up one of its major units as a power of ten.
+func Digits(currency string) int {
+	if d, ok := minorDigits[currency]; ok {
+		return d
+	}
+	return 2
+}
+
+// Validate checks that m has a currency code. Codes are three upper-case
+// letters; which of them are in use is not checked.
+func (m Money) Validate() error {
+	if len(m.Currency) != 3 {
+		return ErrInvalidCurrency
+	}
+	for _, c := range m.Currency {
+		if c < 'A' || c > 'Z' {
+			return ErrInvalidCurrency
+		}
+	}
+	return nil
+}
+
+// Add returns the sum of m and o, which must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.Amount + o.Amount
+	if (sum > m.Amount) != (o.Amount > 0) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns m times n.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || n == -1 && m.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// String formats m as its amount in major units followed by its currency,
+// such as "12.99 USD" or "-5 JPY", which Parse reads back.
+func (m Money) String() string {
+	digits := Digits(m.Currency)
+	amount := strconv.FormatUint(absolute(m.Amount), 10)
+	if digits > 0 {
+		if len(amount) <= digits {
+			amount = strings.Repeat("0", digits-len(amount)+1) + amount
+		}
+		amount = amount[:len(amount)-digits] + "." + amount[len(amount)-digits:]
+	}
+	if m.Amount < 0 {
+		amount = "-" + amount
+	}
+	return amount + " " + m.Currency
+}
+
+func absolute(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
+
+// Parse reads an amount written the way String writes it, except that the
+// decimals may be cut short, as in "12.5 USD" or "12 USD".
+func Parse(s string) (Money, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return Money{}, ErrInvalidAmount
+	}
+	m := Money{Currency: fields[1]}
+	if err := m.Validate(); err != nil {
+		return Money{}, err
+	}
+	digits := Digits(m.Currency)
+	number, negative := strings.CutPrefix(fields[0], "-")
+	whole, fraction, hasPoint := strings.Cut(number, ".")
+	if whole == "" || hasPoint && (fraction == "" || len(fraction) > digits) ||
+		!isDigits(whole) || !isDigits(fraction) {
+		return Money{}, ErrInvalidAmount
+	}
+	units, err := strconv.ParseUint(whole+fraction+strings.Repeat("0", digits-len(fraction)), 10, 64)
+	if err != nil || units > math.MaxInt64 {
+		return Money{}, ErrOverflow
+	}
+	m.Amount = int64(units)
+	if negative {
+		m.Amount = -m.Amount
+	}
+	return m, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestStringAndParse(t *testing.T) {
+	for _, tc := range []struct {
+		money Money
+		text  string
+	}{
+		{Money{1299, "USD"}, "12.99 USD"},
+		{Money{5, "EUR"}, "0.05 EUR"},
+		{Money{-150, "USD"}, "-1.50 USD"},
+		{Money{0, "USD"}, "0.00 USD"},
+		{Money{500, "JPY"}, "500 JPY"},
+		{Money{1234, "KWD"}, "1.234 KWD"},
+		{Money{math.MaxInt64, "USD"}, "92233720368547758.07 USD"},
+	} {
+		if got := tc.money.String(); got != tc.text {
+			t.Errorf("%#v.String() = %q, want %q", tc.money, got, tc.text)
+		}
+		if got, err := Parse(tc.text); err != nil || got != tc.money {
+			t.Errorf("Parse(%q) = %#v, %v, want %#v", tc.text, got, err, tc.money)
+		}
+	}
+}
+
+func TestParseShortDecimals(t *testing.T) {
+	for text, want := range map[string]Money{
+		"12 USD":     {1200, "USD"},
+		"12.5 USD":   {1250, "USD"},
+		" 7.1  KWD ": {7100, "KWD"},
+	} {
+		if got, err := Parse(text); err != nil || got != want {
+			t.Errorf("Parse(%q) = %#v, %v, want %#v", text, got, err, want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for text, want := range map[string]error{
+		"12.99":                    ErrInvalidAmount,
+		"12.99 USD extra":          ErrInvalidAmount,
+		"12.999 USD":               ErrInvalidAmount,
+		"12.5 JPY":                 ErrInvalidAmount,
+		"12. USD":                  ErrInvalidAmount,
+		".5 USD":                   ErrInvalidAmount,
+		"1e3 USD":                  ErrInvalidAmount,
+		"+1 USD":                   ErrInvalidAmount,
+		"12.99 usd":                ErrInvalidCurrency,
+		"12.99 DOLLARS":            ErrInvalidCurrency,
+		"92233720368547758.08 USD": ErrOverflow,
+	} {
+		if _, err := Parse(text); !errors.Is(err, want) {
+			t.Errorf("Parse(%q) error = %v, want %v", text, err, want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	price := Money{1999, "USD"}
+	line, err := price.Mul(3)
+	if err != nil || line != (Money{5997, "USD"}) {
+		t.Errorf("Mul(3) = %#v, %v, want 59.97 USD", line, err)
+	}
+	total, err := line.Add(Money{1, "USD"})
+	if err != nil || total != (Money{5998, "USD"}) {
+		t.Errorf("Add = %#v, %v, want 59.98 USD", total, err)
+	}
+
+	if _, err := price.Add(Money{1, "EUR"}); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add of another currency error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := (Money{math.MaxInt64, "USD"}).Add(Money{1, "USD"}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add past the largest amount error = %v, want ErrOverflow", err)
+	}
+	if _, err := (Money{math.MinInt64, "USD"}).Add(Money{-1, "USD"}); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add past the smallest amount error = %v, want ErrOverflow", err)
+	}
+	if _, err := (Money{math.MaxInt64 / 2, "USD"}).Mul(3); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul past the largest amount error = %v, want ErrOverflow", err)
+	}
+	if _, err := (Money{math.MinInt64, "USD"}).Mul(-1); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Mul of the smallest amount by -1 error = %v, want ErrOverflow", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Money{100, "CHF"}).Validate(); err != nil {
+		t.Errorf("Validate of CHF: %v", err)
+	}
+	for _, currency := range []string{"", "us", "usd", "US1", "USDT"} {
+		if err := (Money{100, currency}).Validate(); !errors.Is(err, ErrInvalidCurrency) {
+			t.Errorf("Validate of currency %q error = %v, want ErrInvalidCurrency", currency, err)
+		}
+	}
+}
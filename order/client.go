@@ -2,6 +2,9 @@ package order
 
 import (
 	"context"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
 	pb "github.com/Mostbesep/microservice-com-temp/order/pb/microservice-com-temp.order.pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -14,8 +17,17 @@ type Client struct {
 	service pb.OrderServiceClient
 }
 
-func NewClient(url string) (*Client, error) {
-	conn, err := grpc.NewClient(url, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewClient(url string, key authz.Key) (*Client, error) {
+	conn, err := grpc.NewClient(
+		url,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(
+			authz.UnaryClientInterceptor(key),
+			idempotency.UnaryClientInterceptor(),
+			errs.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(authz.StreamClientInterceptor(key), errs.StreamClientInterceptor()),
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -37,6 +49,7 @@ func (c *Client) PostOrder(
 		protoProducts = append(protoProducts, &pb.PostOrderRequest_OrderProduct{
 			ProductId: p.Id,
 			Quantity:  p.Quantity,
+			Sku:       p.SKU,
 		})
 	}
 	r, err := c.service.PostOrder(
@@ -61,7 +74,7 @@ func (c *Client) PostOrder(
 	return &Order{
 		Id:         newOrder.Id,
 		CreatedAt:  newOrderCreatedAt,
-		TotalPrice: newOrder.TotalPrice,
+		TotalPrice: moneyFromProto(newOrder.TotalPrice),
 		AccountId:  newOrder.AccountId,
 		Products:   products,
 	}, nil
@@ -81,7 +94,7 @@ func (c *Client) GetAccountOrders(ctx context.Context, accountID string) ([]Orde
 	for _, orderProto := range r.Orders {
 		newOrder := Order{
 			Id:         orderProto.Id,
-			TotalPrice: orderProto.TotalPrice,
+			TotalPrice: moneyFromProto(orderProto.TotalPrice),
 			AccountId:  orderProto.AccountId,
 		}
 		newOrder.CreatedAt = time.Time{}
@@ -94,10 +107,11 @@ func (c *Client) GetAccountOrders(ctx context.Context, accountID string) ([]Orde
 		for _, p := range orderProto.Products {
 			products = append(products, OrderedProduct{
 				Id:          p.Id,
+				SKU:         p.Sku,
 				Quantity:    p.Quantity,
 				Name:        p.Name,
 				Description: p.Description,
-				Price:       p.Price,
+				Price:       moneyFromProto(p.Price),
 			})
 		}
 		newOrder.Products = products
@@ -125,10 +139,11 @@ func (c *Client) GetOrder(ctx context.Context, id string) (Order, error) {
 	for _, product := range r.Order.Products {
 		order.Products = append(order.Products, OrderedProduct{
 			Id:          product.Id,
+			SKU:         product.Sku,
 			Quantity:    product.Quantity,
 			Name:        product.Name,
 			Description: product.Description,
-			Price:       product.Price,
+			Price:       moneyFromProto(product.Price),
 		})
 	}
 
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
 	"github.com/Mostbesep/microservice-com-temp/order"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/tinrab/retry"
 	"log"
+	"os"
 	"time"
 )
 
@@ -12,9 +18,22 @@ type Config struct {
 	DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
 	AccountURL  string `envconfig:"ACCOUNT_SERVICE_URL" required:"true"`
 	CatalogURL  string `envconfig:"CATALOG_SERVICE_URL" required:"true"`
+	// IdentityKey signs and verifies the caller identities passed between
+	// the gateway and the services, which must all share it. At least 32
+	// bytes.
+	IdentityKey authz.Key `envconfig:"IDENTITY_KEY" required:"true"`
+	// IdempotencyWindow is how long the result of a PostOrder call is
+	// replayed to retries with the same idempotency key.
+	IdempotencyWindow time.Duration `envconfig:"IDEMPOTENCY_WINDOW" default:"24h"`
 }
 
 func main() {
+	// order migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+
 	var cfg Config
 	err := envconfig.Process("", &cfg)
 	if err != nil {
@@ -22,15 +41,53 @@ func main() {
 	}
 
 	var r order.Repository
+	var keys idempotency.Store
 	retry.ForeverSleep(2*time.Second, func(_ int) error {
+		if err = migrateUp(cfg.DatabaseURL); err != nil {
+			log.Println(err)
+			return err
+		}
 		r, err = order.NewPostgresqlRepository(cfg.DatabaseURL)
 		if err != nil {
 			println(err)
+			return err
+		}
+		keys, err = idempotency.NewPostgresStore(cfg.DatabaseURL)
+		if err != nil {
+			r.Close()
+			log.Println(err)
 		}
 		return err
 	})
 	defer r.Close()
+	defer keys.Close()
 	log.Println("Listening on port 8080...")
 	s := order.NewService(r)
-	log.Fatal(order.ListenGRPC(s, cfg.AccountURL, cfg.CatalogURL, 8080))
+	log.Fatal(order.ListenGRPC(s, keys, cfg.IdempotencyWindow, cfg.IdentityKey, cfg.AccountURL, cfg.CatalogURL, 8080))
+}
+
+func migrateUp(url string) error {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return migrate.Up(context.Background(), db, order.Migrations)
+}
+
+func runMigrate(args []string) {
+	var cfg struct {
+		DatabaseURL string `envconfig:"DATABASE_URL" required:"true"`
+	}
+	if err := envconfig.Process("", &cfg); err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+	if err = migrate.Run(context.Background(), db, order.Migrations, args, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
 }
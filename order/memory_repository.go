@@ -0,0 +1,67 @@
+package order
+
+import (
+	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"sort"
+	"sync"
+)
+
+// memoryRepository keeps orders in process memory. Like postgresqlRepository
+// it only persists the id, SKU, quantity and price of each ordered product,
+// the rest is looked up in the catalog.
+type memoryRepository struct {
+	mu     sync.RWMutex
+	orders map[string]Order
+}
+
+func NewMemoryRepository() Repository {
+	return &memoryRepository{orders: map[string]Order{}}
+}
+
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+func (r *memoryRepository) PutOrder(ctx context.Context, order Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.orders[order.Id]; ok {
+		return errs.New(errs.AlreadyExists, "order already exists")
+	}
+	stored := order
+	stored.Products = make([]OrderedProduct, len(order.Products))
+	for i, p := range order.Products {
+		stored.Products[i] = OrderedProduct{Id: p.Id, SKU: p.SKU, Quantity: p.Quantity, Price: p.Price}
+	}
+	r.orders[order.Id] = stored
+	return nil
+}
+
+func (r *memoryRepository) GetOrder(ctx context.Context, id string) (Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return copyOrder(order), nil
+}
+
+func (r *memoryRepository) GetAccountOrders(ctx context.Context, accountId string) (*[]Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	orders := []Order{}
+	for _, order := range r.orders {
+		if order.AccountId == accountId {
+			orders = append(orders, copyOrder(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Id < orders[j].Id })
+	return &orders, nil
+}
+
+func copyOrder(order Order) Order {
+	order.Products = append([]OrderedProduct(nil), order.Products...)
+	return order
+}
@@ -0,0 +1,14 @@
+package order_test
+
+import (
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/order"
+	"github.com/Mostbesep/microservice-com-temp/order/ordertest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	ordertest.TestRepository(t, func(t *testing.T) order.Repository {
+		return order.NewMemoryRepository()
+	})
+}
@@ -0,0 +1,13 @@
+package order
+
+import (
+	"embed"
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migrations is the schema history of the order database, applied by
+// cmd/order on startup.
+var Migrations = migrate.MustLoad(migrationFiles, "migrations")
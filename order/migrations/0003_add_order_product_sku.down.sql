@@ -0,0 +1,6 @@
+-- Orders for several variants of a product keep only one of them.
+ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_pkey;
+DELETE FROM order_products a USING order_products b
+WHERE a.order_id = b.order_id AND a.product_id = b.product_id AND a.sku > b.sku;
+ALTER TABLE order_products DROP COLUMN IF EXISTS sku;
+ALTER TABLE order_products ADD PRIMARY KEY (product_id, order_id);
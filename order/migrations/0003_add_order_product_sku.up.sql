@@ -0,0 +1,5 @@
+-- A product can be ordered as several of its variants at once, each a line
+-- of its own. Products without variants have an empty SKU.
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS sku TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_products DROP CONSTRAINT IF EXISTS order_products_pkey;
+ALTER TABLE order_products ADD PRIMARY KEY (product_id, order_id, sku);
@@ -0,0 +1,8 @@
+-- Prices lose their currency, and are taken to have two decimals.
+ALTER TABLE order_products DROP COLUMN IF EXISTS price_currency;
+ALTER TABLE order_products RENAME COLUMN price_amount TO price;
+ALTER TABLE order_products ALTER COLUMN price TYPE MONEY USING (price / 100.0)::numeric::money;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS total_currency;
+ALTER TABLE orders RENAME COLUMN total_amount TO total_price;
+ALTER TABLE orders ALTER COLUMN total_price TYPE MONEY USING (total_price / 100.0)::numeric::money;
@@ -0,0 +1,11 @@
+-- Prices are whole numbers of the minor units of a currency, such as cents.
+-- The prices stored until now were in US dollars.
+ALTER TABLE orders ALTER COLUMN total_price TYPE BIGINT USING round(total_price::numeric * 100);
+ALTER TABLE orders RENAME COLUMN total_price TO total_amount;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE orders ALTER COLUMN total_currency DROP DEFAULT;
+
+ALTER TABLE order_products ALTER COLUMN price TYPE BIGINT USING round(price::numeric * 100);
+ALTER TABLE order_products RENAME COLUMN price TO price_amount;
+ALTER TABLE order_products ADD COLUMN IF NOT EXISTS price_currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE order_products ALTER COLUMN price_currency DROP DEFAULT;
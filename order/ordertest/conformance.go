@@ -0,0 +1,139 @@
+// Package ordertest provides a conformance suite that every order.Repository
+// implementation must pass.
+package ordertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"github.com/Mostbesep/microservice-com-temp/order"
+	"github.com/segmentio/ksuid"
+)
+
+// TestRepository runs the conformance suite. newRepository must return an
+// empty repository on every call.
+func TestRepository(t *testing.T, newRepository func(t *testing.T) order.Repository) {
+	t.Run("PutAndGet", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		o := newOrder(ksuid.New().String(), 2)
+		if err := r.PutOrder(ctx, o); err != nil {
+			t.Fatalf("PutOrder: %v", err)
+		}
+		got, err := r.GetOrder(ctx, o.Id)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		assertOrder(t, got, o)
+	})
+
+	t.Run("Variants", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		o := newOrder(ksuid.New().String(), 1)
+		for _, sku := range []string{"SHIRT-M", "SHIRT-L"} {
+			p := order.OrderedProduct{Id: o.Products[0].Id, SKU: sku, Price: usd(2000), Quantity: 2}
+			o.Products = append(o.Products, p)
+			o.TotalPrice.Amount += p.Price.Amount * int64(p.Quantity)
+		}
+		if err := r.PutOrder(ctx, o); err != nil {
+			t.Fatalf("PutOrder: %v", err)
+		}
+		got, err := r.GetOrder(ctx, o.Id)
+		if err != nil {
+			t.Fatalf("GetOrder: %v", err)
+		}
+		assertOrder(t, got, o)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		r := newRepository(t)
+		if _, err := r.GetOrder(context.Background(), ksuid.New().String()); !errors.Is(err, order.ErrNotFound) {
+			t.Errorf("GetOrder error = %v, want order.ErrNotFound", err)
+		}
+	})
+
+	t.Run("AccountOrders", func(t *testing.T) {
+		r := newRepository(t)
+		ctx := context.Background()
+		accountID := ksuid.New().String()
+		first := newOrder(accountID, 1)
+		second := newOrder(accountID, 3)
+		if first.Id > second.Id {
+			first, second = second, first
+		}
+		other := newOrder(ksuid.New().String(), 1)
+		for _, o := range []order.Order{second, other, first} {
+			if err := r.PutOrder(ctx, o); err != nil {
+				t.Fatalf("PutOrder: %v", err)
+			}
+		}
+
+		orders, err := r.GetAccountOrders(ctx, accountID)
+		if err != nil {
+			t.Fatalf("GetAccountOrders: %v", err)
+		}
+		if len(*orders) != 2 {
+			t.Fatalf("GetAccountOrders returned %d orders, want 2", len(*orders))
+		}
+		assertOrder(t, (*orders)[0], first)
+		assertOrder(t, (*orders)[1], second)
+
+		orders, err = r.GetAccountOrders(ctx, ksuid.New().String())
+		if err != nil {
+			t.Fatalf("GetAccountOrders: %v", err)
+		}
+		if len(*orders) != 0 {
+			t.Errorf("GetAccountOrders for an account without orders returned %d orders", len(*orders))
+		}
+	})
+}
+
+func newOrder(accountID string, products int) order.Order {
+	o := order.Order{
+		Id:         ksuid.New().String(),
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		AccountId:  accountID,
+		TotalPrice: usd(0),
+	}
+	for i := 0; i < products; i++ {
+		p := order.OrderedProduct{
+			Id:       ksuid.New().String(),
+			Price:    usd(250 + int64(i)),
+			Quantity: uint32(i + 1),
+		}
+		o.Products = append(o.Products, p)
+		o.TotalPrice.Amount += p.Price.Amount * int64(p.Quantity)
+	}
+	return o
+}
+
+func usd(cents int64) money.Money {
+	return money.Money{Amount: cents, Currency: "USD"}
+}
+
+func assertOrder(t *testing.T, got order.Order, want order.Order) {
+	t.Helper()
+	if got.Id != want.Id || got.AccountId != want.AccountId || got.TotalPrice != want.TotalPrice {
+		t.Errorf("order = %+v, want %+v", got, want)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("order created at %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+	type line struct{ id, sku string }
+	lines := map[line]order.OrderedProduct{}
+	for _, p := range got.Products {
+		lines[line{p.Id, p.SKU}] = p
+	}
+	if len(lines) != len(want.Products) {
+		t.Fatalf("order has %d products, want %d", len(lines), len(want.Products))
+	}
+	for _, p := range want.Products {
+		if l := lines[line{p.Id, p.SKU}]; l.Quantity != p.Quantity || l.Price != p.Price {
+			t.Errorf("product %s %q has quantity %d at %v, want %d at %v", p.Id, p.SKU, l.Quantity, l.Price, p.Quantity, p.Price)
+		}
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/Mostbesep/microservice-com-temp/errs"
 	"github.com/lib/pq"
 )
 
+var (
+	ErrNotFound = errs.New(errs.NotFound, "order not found")
+)
+
 type Repository interface {
 	Close() error
 	PutOrder(ctx context.Context, order Order) error
@@ -26,25 +31,27 @@ func (r *postgresqlRepository) Close() error {
 	return nil
 }
 
-func (r *postgresqlRepository) PutOrder(ctx context.Context, order Order) error {
+func (r *postgresqlRepository) PutOrder(ctx context.Context, order Order) (err error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return dbError(err)
 	}
 	defer func() {
 		if err != nil {
 			tx.Rollback()
-			return
+		} else {
+			err = tx.Commit()
 		}
-		err = tx.Commit()
+		err = dbError(err)
 	}()
 	_, err = tx.ExecContext(
 		ctx,
-		"INSERT INTO orders (id, created_at, account_id, total_price) VALUES ($1, $2, $3, $4)",
+		"INSERT INTO orders (id, created_at, account_id, total_amount, total_currency) VALUES ($1, $2, $3, $4, $5)",
 		order.Id,
 		order.CreatedAt,
 		order.AccountId,
-		order.TotalPrice,
+		order.TotalPrice.Amount,
+		order.TotalPrice.Currency,
 	)
 	if err != nil {
 		return err
@@ -52,12 +59,12 @@ func (r *postgresqlRepository) PutOrder(ctx context.Context, order Order) error
 	stmt, err := tx.PrepareContext(
 		ctx, pq.CopyIn(
 			"order_products",
-			"order_id", "product_id", "quantity", "price"))
+			"order_id", "product_id", "sku", "quantity", "price_amount", "price_currency"))
 	if err != nil {
 		return err
 	}
 	for _, p := range order.Products {
-		_, err = stmt.ExecContext(ctx, order.AccountId, p.Id, p.Quantity)
+		_, err = stmt.ExecContext(ctx, order.Id, p.Id, p.SKU, p.Quantity, p.Price.Amount, p.Price.Currency)
 		if err != nil {
 			return err
 		}
@@ -78,15 +85,19 @@ func (r *postgresqlRepository) GetOrder(ctx context.Context, id string) (Order,
 			o.id,
 			o.created_at,
 			o.account_id,
-			o.total_price::float8,
+			o.total_amount,
+			o.total_currency,
 			op.product_id,
-			op.quantity
+			op.sku,
+			op.quantity,
+			op.price_amount,
+			op.price_currency
 		FROM orders o
 		JOIN order_products op ON (o.id = op.order_id)
 		WHERE o.id = $1`,
 		id)
 	if err != nil {
-		return Order{}, fmt.Errorf("failed to query order: %w", err)
+		return Order{}, dbError(fmt.Errorf("failed to query order: %w", err))
 	}
 	defer rows.Close()
 
@@ -100,12 +111,16 @@ func (r *postgresqlRepository) GetOrder(ctx context.Context, id string) (Order,
 		if err := rows.Scan(
 			&order.Id,
 			&order.CreatedAt,
-			&order.Id,
-			&order.TotalPrice,
+			&order.AccountId,
+			&order.TotalPrice.Amount,
+			&order.TotalPrice.Currency,
 			&product.Id,
-			product.Quantity,
+			&product.SKU,
+			&product.Quantity,
+			&product.Price.Amount,
+			&product.Price.Currency,
 		); err != nil {
-			return Order{}, fmt.Errorf("failed to scan row: %w", err)
+			return Order{}, dbError(fmt.Errorf("failed to scan row: %w", err))
 		}
 		products = append(products, product)
 		orderFetched = true
@@ -113,12 +128,12 @@ func (r *postgresqlRepository) GetOrder(ctx context.Context, id string) (Order,
 
 	// Check for iteration errors
 	if err := rows.Err(); err != nil {
-		return Order{}, fmt.Errorf("row iteration error: %w", err)
+		return Order{}, dbError(fmt.Errorf("row iteration error: %w", err))
 	}
 
 	// Handle empty result set
 	if !orderFetched {
-		return Order{}, fmt.Errorf("order with ID %s not found", id)
+		return Order{}, ErrNotFound
 	}
 
 	order.Products = products
@@ -133,15 +148,19 @@ func (r *postgresqlRepository) GetAccountOrders(ctx context.Context, accountId s
 	o.id, 
 	o.created_at, 
 	o.account_id, 
-	o.total_price::money::numeric::float8, 
+	o.total_amount,
+	o.total_currency,
 	op.product_id, 
-	op.quantity 
+	op.sku, 
+	op.quantity,
+	op.price_amount,
+	op.price_currency
 	FROM orders o JOIN order_products op ON (o.id = op.order_id) 
 	WHERE o.account_id = $1
 	ORDER BY o.id`,
 		accountId)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	defer rows.Close()
 	orders := []Order{}
@@ -155,11 +174,15 @@ func (r *postgresqlRepository) GetAccountOrders(ctx context.Context, accountId s
 			&order.Id,
 			&order.CreatedAt,
 			&order.AccountId,
-			&order.TotalPrice,
+			&order.TotalPrice.Amount,
+			&order.TotalPrice.Currency,
 			&orderedProduct.Id,
+			&orderedProduct.SKU,
 			&orderedProduct.Quantity,
+			&orderedProduct.Price.Amount,
+			&orderedProduct.Price.Currency,
 		); err != nil {
-			return nil, err
+			return nil, dbError(err)
 		}
 		// Scan order
 		if lastOrder.Id != "" && lastOrder.Id != order.Id {
@@ -176,14 +199,16 @@ func (r *postgresqlRepository) GetAccountOrders(ctx context.Context, accountId s
 		// Scan products
 		products = append(products, OrderedProduct{
 			Id:       orderedProduct.Id,
+			SKU:      orderedProduct.SKU,
 			Quantity: orderedProduct.Quantity,
+			Price:    orderedProduct.Price,
 		})
 
 		*lastOrder = *order
 	}
 
 	// Add last order (or first :D)
-	if lastOrder != nil {
+	if lastOrder.Id != "" {
 		newOrder := Order{
 			Id:         lastOrder.Id,
 			AccountId:  lastOrder.AccountId,
@@ -195,7 +220,7 @@ func (r *postgresqlRepository) GetAccountOrders(ctx context.Context, accountId s
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 
 	return &orders, nil
@@ -213,3 +238,9 @@ func NewPostgresqlRepository(url string) (Repository, error) {
 	}
 	return &postgresqlRepository{db: db}, nil
 }
+
+// dbError reports a lost database connection as errs.Unavailable and returns
+// other errors unchanged.
+func dbError(err error) error {
+	return errs.FromSQL(err, "order", nil)
+}
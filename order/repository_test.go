@@ -0,0 +1,40 @@
+package order_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/migrate"
+	"github.com/Mostbesep/microservice-com-temp/order"
+	"github.com/Mostbesep/microservice-com-temp/order/ordertest"
+)
+
+// TestPostgresqlRepository runs against the database in
+// ORDER_TEST_DATABASE_URL, migrated and with its tables emptied before every case.
+func TestPostgresqlRepository(t *testing.T) {
+	url := os.Getenv("ORDER_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("ORDER_TEST_DATABASE_URL is not set")
+	}
+	ordertest.TestRepository(t, func(t *testing.T) order.Repository {
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err = migrate.Up(context.Background(), db, order.Migrations); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.Exec("TRUNCATE orders, order_products"); err != nil {
+			t.Fatal(err)
+		}
+		r, err := order.NewPostgresqlRepository(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return r
+	})
+}
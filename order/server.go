@@ -3,17 +3,26 @@ package order
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Mostbesep/microservice-com-temp/account"
+	"github.com/Mostbesep/microservice-com-temp/authz"
 	"github.com/Mostbesep/microservice-com-temp/catalog"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/idempotency"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	pb "github.com/Mostbesep/microservice-com-temp/order/pb/microservice-com-temp.order.pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"log"
 	"net"
+	"time"
 )
 
+// stockReservationTTL is how long PostOrder holds stock while it stores the
+// order. If the order service goes away before committing the reservation,
+// the stock becomes available again after this long.
+const stockReservationTTL = time.Minute
+
 type grpcServer struct {
 	service       Service
 	accountClient *account.Client
@@ -21,13 +30,24 @@ type grpcServer struct {
 	pb.UnimplementedOrderServiceServer
 }
 
-func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
-	accountClient, err := account.NewClient(accountURL)
+var policy = authz.Policy{
+	pb.OrderService_PostOrder_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.PostOrderRequest).AccountId
+	}),
+	// Ownership of a single order is checked once it has been loaded.
+	pb.OrderService_GetOrder_FullMethodName: authz.Authenticated(),
+	pb.OrderService_GetAccountOrders_FullMethodName: authz.Owner(func(req any) string {
+		return req.(*pb.GetAccountOrdersRequest).AccountId
+	}),
+}
+
+func ListenGRPC(s Service, keys idempotency.Store, keyWindow time.Duration, key authz.Key, accountURL, catalogURL string, port int) error {
+	accountClient, err := account.NewClient(accountURL, key)
 	if err != nil {
 		return err
 	}
 
-	catalogClient, err := catalog.NewClient(catalogURL)
+	catalogClient, err := catalog.NewClient(catalogURL, key)
 	if err != nil {
 		accountClient.Close()
 		return err
@@ -40,7 +60,14 @@ func ListenGRPC(s Service, accountURL, catalogURL string, port int) error {
 		return err
 	}
 
-	serv := grpc.NewServer()
+	serv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			errs.UnaryServerInterceptor(),
+			authz.UnaryServerInterceptor(key, policy),
+			idempotency.UnaryServerInterceptor(keys, keyWindow, pb.OrderService_PostOrder_FullMethodName),
+		),
+		grpc.ChainStreamInterceptor(errs.StreamServerInterceptor(), authz.StreamServerInterceptor(key, policy)),
+	)
 	pb.RegisterOrderServiceServer(serv, &grpcServer{
 		service:       s,
 		accountClient: accountClient,
@@ -55,67 +82,100 @@ func (s *grpcServer) PostOrder(
 	ctx context.Context,
 	r *pb.PostOrderRequest,
 ) (*pb.PostOrderResponse, error) {
-	// Check if account exists
-	_, err := s.accountClient.GetAccount(ctx, r.AccountId)
+	// Check if account exists and may place orders
+	a, err := s.accountClient.GetAccount(ctx, r.AccountId)
 	if err != nil {
 		log.Println("Error getting account: ", err)
-		return nil, errors.New("account not found")
+		return nil, err
+	}
+	if a.Status != account.StatusActive {
+		return nil, errs.New(errs.FailedPrecondition, fmt.Sprintf("account %s is %s and cannot place orders", a.ID, a.Status))
 	}
 
-	// Get ordered products
-	productIDs := []string{}
+	// Get ordered products, named by id or by the SKU of a variant
+	productIDs, skus := []string{}, []string{}
 	for _, p := range r.Products {
-		productIDs = append(productIDs, p.ProductId)
+		if p.Sku != "" {
+			skus = append(skus, p.Sku)
+		} else {
+			productIDs = append(productIDs, p.ProductId)
+		}
 	}
-	orderedProducts, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
-	if err != nil {
-		log.Println("Error getting products: ", err)
-		return nil, errors.New("products not found")
+	orderedProducts := []catalog.Product{}
+	if len(productIDs) > 0 {
+		if orderedProducts, err = s.catalogClient.GetProducts(ctx, 0, 0, productIDs, ""); err != nil {
+			log.Println("Error getting products: ", err)
+			return nil, err
+		}
+	}
+	if len(skus) > 0 {
+		variantProducts, err := s.catalogClient.GetProductsBySKUs(ctx, skus)
+		if err != nil {
+			log.Println("Error getting products: ", err)
+			return nil, err
+		}
+		orderedProducts = append(orderedProducts, variantProducts...)
 	}
 
 	// Construct products
-	products := []OrderedProduct{}
-	for _, p := range orderedProducts {
-		product := OrderedProduct{
-			Id:          p.Id,
-			Quantity:    0,
-			Price:       p.Price,
-			Name:        p.Name,
-			Description: p.Description,
-		}
-		for _, rp := range r.Products {
-			if rp.ProductId == p.Id {
-				product.Quantity = rp.Quantity
-				break
-			}
-		}
+	products, err := orderLines(r.Products, orderedProducts)
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, ErrNoProducts
+	}
 
-		if product.Quantity != 0 {
-			products = append(products, product)
+	// Hold the stock of the products, refusing the order if any is short.
+	// Variants are stocked under their SKU, other products under their id.
+	items := []catalog.StockItem{}
+	for _, p := range products {
+		sku := p.SKU
+		if sku == "" {
+			sku = p.Id
 		}
+		items = append(items, catalog.StockItem{SKU: sku, Quantity: uint64(p.Quantity)})
+	}
+	// The stock is held by this service, not the customer.
+	stockCtx := authz.ContextWithIdentity(ctx, authz.ServiceIdentity("order"))
+	reservation, err := s.catalogClient.ReserveStock(stockCtx, items, stockReservationTTL)
+	if err != nil {
+		log.Println("Error reserving stock: ", err)
+		return nil, err
 	}
 
-	// Call service implementation
+	// Call service implementation. Whatever happens to the caller, the
+	// reservation is settled to match what was stored.
 	order, err := s.service.PostOrder(ctx, r.AccountId, products)
+	settleCtx := context.WithoutCancel(stockCtx)
 	if err != nil {
 		log.Println("Error posting order: ", err)
-		return nil, errors.New("could not post order")
+		if err := s.catalogClient.ReleaseReservation(settleCtx, reservation.ID); err != nil {
+			log.Println("Error releasing stock reservation", reservation.ID, err)
+		}
+		return nil, err
+	}
+	if err := s.catalogClient.CommitReservation(settleCtx, reservation.ID); err != nil {
+		// The order is stored, so it stands, but its stock will be freed
+		// when the reservation expires.
+		log.Println("Error committing stock reservation", reservation.ID, "of order", order.Id, err)
 	}
 
 	// Make response order
 	orderProto := &pb.Order{
 		Id:         order.Id,
 		AccountId:  order.AccountId,
-		TotalPrice: order.TotalPrice,
+		TotalPrice: moneyToProto(order.TotalPrice),
 		Products:   []*pb.Order_OrderProduct{},
 	}
 	orderProto.CreatedAt, _ = order.CreatedAt.MarshalBinary()
 	for _, p := range order.Products {
 		orderProto.Products = append(orderProto.Products, &pb.Order_OrderProduct{
 			Id:          p.Id,
+			Sku:         p.SKU,
 			Name:        p.Name,
 			Description: p.Description,
-			Price:       p.Price,
+			Price:       moneyToProto(p.Price),
 			Quantity:    p.Quantity,
 		})
 	}
@@ -124,6 +184,79 @@ func (s *grpcServer) PostOrder(
 	}, nil
 }
 
+// orderLines turns the products of an order request into order lines priced
+// from the catalog, adding up the quantities of lines for the same product or
+// variant. Lines naming products that are not in the catalog are left out,
+// and lines naming a product with variants by its id are refused.
+func orderLines(requested []*pb.PostOrderRequest_OrderProduct, catalogProducts []catalog.Product) ([]OrderedProduct, error) {
+	byID, bySKU := map[string]catalog.Product{}, map[string]catalog.Product{}
+	for _, p := range catalogProducts {
+		byID[p.Id] = p
+		for _, v := range p.Variants {
+			bySKU[v.SKU] = p
+		}
+	}
+	type line struct{ id, sku string }
+	lines := map[line]int{}
+	products := []OrderedProduct{}
+	for _, rp := range requested {
+		if rp.Quantity == 0 {
+			continue
+		}
+		var product OrderedProduct
+		if rp.Sku != "" {
+			p, ok := bySKU[rp.Sku]
+			if !ok || rp.ProductId != "" && rp.ProductId != p.Id {
+				continue
+			}
+			v, _ := p.Variant(rp.Sku)
+			product = OrderedProduct{Id: p.Id, SKU: v.SKU, Name: p.Name, Description: p.Description, Price: v.Price}
+		} else {
+			p, ok := byID[rp.ProductId]
+			if !ok {
+				continue
+			}
+			if len(p.Variants) > 0 {
+				return nil, catalog.ErrVariantRequired
+			}
+			product = OrderedProduct{Id: p.Id, Name: p.Name, Description: p.Description, Price: p.Price}
+		}
+		key := line{product.Id, product.SKU}
+		if i, ok := lines[key]; ok {
+			products[i].Quantity += rp.Quantity
+			continue
+		}
+		product.Quantity = rp.Quantity
+		lines[key] = len(products)
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// orderedProductToProto describes a stored order line, at the price it was
+// ordered at, with the current name and description of its product.
+func orderedProductToProto(p OrderedProduct, products map[string]catalog.Product) *pb.Order_OrderProduct {
+	product := products[p.Id]
+	return &pb.Order_OrderProduct{
+		Id:          p.Id,
+		Sku:         p.SKU,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       moneyToProto(p.Price),
+		Quantity:    p.Quantity,
+	}
+}
+
+func moneyToProto(m money.Money) *pb.OrderMoney {
+	return &pb.OrderMoney{Amount: m.Amount, Currency: m.Currency}
+}
+
+// moneyFromProto translates an amount, which is zero and without a currency
+// if unset.
+func moneyFromProto(m *pb.OrderMoney) money.Money {
+	return money.Money{Amount: m.GetAmount(), Currency: m.GetCurrency()}
+}
+
 func (s *grpcServer) GetOrder(ctx context.Context, request *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
 	// Fetch the order using the service layer
 	order, err := s.service.GetOrder(ctx, request.Id)
@@ -131,6 +264,9 @@ func (s *grpcServer) GetOrder(ctx context.Context, request *pb.GetOrderRequest)
 		log.Println("Error fetching order:", err)
 		return nil, err
 	}
+	if err = authz.AuthorizeOwner(ctx, order.AccountId); err != nil {
+		return nil, err
+	}
 
 	productIDs := []string{}
 	for _, p := range order.Products {
@@ -148,7 +284,7 @@ func (s *grpcServer) GetOrder(ctx context.Context, request *pb.GetOrderRequest)
 	responseOrder := &pb.Order{
 		AccountId:  order.AccountId,
 		Id:         order.Id,
-		TotalPrice: order.TotalPrice,
+		TotalPrice: moneyToProto(order.TotalPrice),
 		Products:   []*pb.Order_OrderProduct{},
 	}
 	responseOrder.CreatedAt, _ = order.CreatedAt.MarshalBinary()
@@ -159,13 +295,7 @@ func (s *grpcServer) GetOrder(ctx context.Context, request *pb.GetOrderRequest)
 	}
 
 	for _, product := range order.Products {
-		responseOrder.Products = append(responseOrder.Products, &pb.Order_OrderProduct{
-			Id:          product.Id,
-			Name:        orderProducts[product.Id].Name,
-			Description: orderProducts[product.Id].Description,
-			Price:       orderProducts[product.Id].Price,
-			Quantity:    product.Quantity,
-		})
+		responseOrder.Products = append(responseOrder.Products, orderedProductToProto(product, orderProducts))
 	}
 
 	return &pb.GetOrderResponse{Order: responseOrder}, nil
@@ -190,6 +320,10 @@ func (s *grpcServer) GetAccountOrders(
 		}
 	}
 	products, err := s.catalogClient.GetProducts(ctx, 0, 0, productIDs, "")
+	if err != nil {
+		log.Println("Error fetching products for orders:", err)
+		return nil, err
+	}
 
 	productsMap := make(map[string]catalog.Product)
 	for _, product := range products {
@@ -201,19 +335,13 @@ func (s *grpcServer) GetAccountOrders(
 		newOrder := &pb.Order{
 			AccountId:  order.AccountId,
 			Id:         order.Id,
-			TotalPrice: order.TotalPrice,
+			TotalPrice: moneyToProto(order.TotalPrice),
 		}
+		newOrder.CreatedAt, _ = order.CreatedAt.MarshalBinary()
 		for _, product := range order.Products {
-			orderProduct := &pb.Order_OrderProduct{
-				Id:          product.Id,
-				Name:        productsMap[product.Id].Name,
-				Description: productsMap[product.Id].Description,
-				Price:       productsMap[product.Id].Price,
-				Quantity:    product.Quantity,
-			}
-			newOrder.Products = append(newOrder.Products, orderProduct)
+			newOrder.Products = append(newOrder.Products, orderedProductToProto(product, productsMap))
 		}
-		responseOrders = append(responseOrders)
+		responseOrders = append(responseOrders, newOrder)
 	}
 	return &pb.GetAccountOrdersResponse{Orders: responseOrders}, nil
 }
@@ -0,0 +1,55 @@
+package order
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/account"
+	accountpb "github.com/Mostbesep/microservice-com-temp/account/pb/microservice-com-temp.account.pb"
+	"github.com/Mostbesep/microservice-com-temp/authz"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	pb "github.com/Mostbesep/microservice-com-temp/order/pb/microservice-com-temp.order.pb"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/grpc"
+)
+
+// accountServer answers GetAccount with a fixed account.
+type accountServer struct {
+	account *accountpb.Account
+	accountpb.UnimplementedAccountServiceServer
+}
+
+func (s *accountServer) GetAccount(ctx context.Context, r *accountpb.GetAccountRequest) (*accountpb.GetAccountResponse, error) {
+	return &accountpb.GetAccountResponse{Account: s.account}, nil
+}
+
+func TestPostOrderRejectsInactiveAccounts(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := &accountServer{}
+	srv := grpc.NewServer()
+	accountpb.RegisterAccountServiceServer(srv, accounts)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	accountClient, err := account.NewClient(lis.Addr().String(), authz.Key("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accountClient.Close()
+
+	// The account is checked before the catalog is asked for products.
+	s := &grpcServer{service: NewService(NewMemoryRepository()), accountClient: accountClient}
+	for _, status := range []string{account.StatusSuspended, account.StatusClosed} {
+		accounts.account = &accountpb.Account{Id: ksuid.New().String(), Name: "Alice", Status: status}
+		_, err := s.PostOrder(context.Background(), &pb.PostOrderRequest{
+			AccountId: accounts.account.Id,
+			Products:  []*pb.PostOrderRequest_OrderProduct{{ProductId: ksuid.New().String(), Quantity: 1}},
+		})
+		if errs.CodeOf(err) != errs.FailedPrecondition {
+			t.Errorf("PostOrder for a %s account error = %v, want code %s", status, err, errs.FailedPrecondition)
+		}
+	}
+}
@@ -2,29 +2,42 @@ package order
 
 import (
 	"context"
+	"github.com/Mostbesep/microservice-com-temp/errs"
+	"github.com/Mostbesep/microservice-com-temp/money"
 	"github.com/segmentio/ksuid"
 	"time"
 )
 
+var (
+	ErrNoProducts       = errs.New(errs.InvalidArgument, "order contains no known products")
+	ErrCurrencyMismatch = errs.New(errs.InvalidArgument, "the products of an order must be priced in the same currency")
+)
+
 type Service interface {
 	PostOrder(ctx context.Context, accountID string, products []OrderedProduct) (Order, error)
 	GetOrder(ctx context.Context, id string) (Order, error)
 	GetAccountOrders(ctx context.Context, accountID string) (*[]Order, error)
 }
 
+// Order is a placed order. TotalPrice is the sum of the prices of its
+// products times their quantities, in the currency they are all priced in.
 type Order struct {
 	Id         string
 	CreatedAt  time.Time
-	TotalPrice float64
+	TotalPrice money.Money
 	AccountId  string
 	Products   []OrderedProduct
 }
 
+// OrderedProduct is a line of an order. SKU is set if the product was ordered
+// as one of its variants. Price is the unit price of the product, or of the
+// variant, when it was ordered.
 type OrderedProduct struct {
 	Id          string
+	SKU         string
 	Name        string
 	Description string
-	Price       float64
+	Price       money.Money
 	Quantity    uint32
 }
 
@@ -48,18 +61,40 @@ func (s *orderService) PostOrder(ctx context.Context, accountID string, products
 		AccountId: accountID,
 		Products:  products,
 	}
-	// Calculate total price
-	o.TotalPrice = 0.0
-	for _, p := range products {
-		o.TotalPrice += p.Price * float64(p.Quantity)
+	total, err := totalPrice(products)
+	if err != nil {
+		return Order{}, err
 	}
-	err := s.repository.PutOrder(ctx, o)
+	o.TotalPrice = total
+	err = s.repository.PutOrder(ctx, o)
 	if err != nil {
 		return Order{}, err
 	}
 	return o, nil
 }
 
+// totalPrice adds up the prices of the products times their quantities,
+// which are all in the same currency.
+func totalPrice(products []OrderedProduct) (money.Money, error) {
+	if len(products) == 0 {
+		return money.Money{}, ErrNoProducts
+	}
+	total := money.Money{Currency: products[0].Price.Currency}
+	for _, p := range products {
+		if p.Price.Currency != total.Currency {
+			return money.Money{}, ErrCurrencyMismatch
+		}
+		line, err := p.Price.Mul(int64(p.Quantity))
+		if err != nil {
+			return money.Money{}, err
+		}
+		if total, err = total.Add(line); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
 func (s *orderService) GetAccountOrders(ctx context.Context, accountID string) (*[]Order, error) {
 	return s.repository.GetAccountOrders(ctx, accountID)
 }
@@ -0,0 +1,43 @@
+package order_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Mostbesep/microservice-com-temp/money"
+	"github.com/Mostbesep/microservice-com-temp/order"
+	"github.com/segmentio/ksuid"
+)
+
+func TestPostOrderTotalsExactly(t *testing.T) {
+	s := order.NewService(order.NewMemoryRepository())
+	ctx := context.Background()
+	dime := money.Money{Amount: 10, Currency: "USD"}
+	o, err := s.PostOrder(ctx, ksuid.New().String(), []order.OrderedProduct{
+		{Id: ksuid.New().String(), Price: dime, Quantity: 3},
+		{Id: ksuid.New().String(), Price: money.Money{Amount: 20, Currency: "USD"}, Quantity: 1},
+	})
+	if err != nil {
+		t.Fatalf("PostOrder: %v", err)
+	}
+	if want := (money.Money{Amount: 50, Currency: "USD"}); o.TotalPrice != want {
+		t.Errorf("PostOrder totalled %v, want %v", o.TotalPrice, want)
+	}
+
+	stored, err := s.GetOrder(ctx, o.Id)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+	if stored.TotalPrice != o.TotalPrice || stored.Products[0].Price != dime {
+		t.Errorf("GetOrder = %+v, want the prices it was posted with", stored)
+	}
+
+	_, err = s.PostOrder(ctx, ksuid.New().String(), []order.OrderedProduct{
+		{Id: ksuid.New().String(), Price: dime, Quantity: 1},
+		{Id: ksuid.New().String(), Price: money.Money{Amount: 10, Currency: "EUR"}, Quantity: 1},
+	})
+	if !errors.Is(err, order.ErrCurrencyMismatch) {
+		t.Errorf("PostOrder in two currencies error = %v, want order.ErrCurrencyMismatch", err)
+	}
+}